@@ -0,0 +1,1604 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// errLotNotCreated is reported for commands issued before create_parking_lot
+var errLotNotCreated = errors.New("parking lot is not created")
+
+// shell parses text commands and dispatches them to a Carpark, printing the results
+type shell struct {
+	cp         *parking.Carpark
+	out        io.Writer
+	json       bool // Whether results are written as JSON instead of human-readable text
+	accessible bool // Whether text is written for screen readers, as labelled sentences instead of tables
+
+	*store // Files the lot is kept in across restarts
+}
+
+// slotJSON is the JSON form of a parked car
+type slotJSON struct {
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Color        string    `json:"color"`
+	Vehicle      string    `json:"vehicle,omitempty"` // Omitted for cars
+	Ticket       string    `json:"ticket,omitempty"`
+	ParkedAt     time.Time `json:"parked_at"`
+}
+
+// evidenceJSON is the JSON form of the photo references attached to a parked car
+type evidenceJSON struct {
+	Slot         int      `json:"slot"`
+	Registration string   `json:"registration"`
+	Evidence     []string `json:"evidence"`
+}
+
+// notesJSON is the JSON form of the notes attached to a parked car
+type notesJSON struct {
+	Slot         int            `json:"slot"`
+	Registration string         `json:"registration"`
+	Notes        []parking.Note `json:"notes"`
+}
+
+// slotUsageJSON is the JSON form of how many times a slot has been allocated
+type slotUsageJSON struct {
+	Slot        int `json:"slot"`
+	Allocations int `json:"allocations"`
+}
+
+// errorJSON is the JSON form of a failed command
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// command describes one shell command and how many arguments it takes
+type command struct {
+	usage    string
+	args     int
+	optional int  // Further arguments the command accepts after args, -1 for any number
+	needsLot bool // Whether the lot must be created before the command can run
+	mutates  bool // Whether the command changes the lot, so the state file must be saved after it
+	evacuate bool // Whether the command may change the lot while it is being evacuated
+	run      func(s *shell, args []string)
+}
+
+var commands = map[string]command{
+	"create_parking_lot": {usage: "create_parking_lot <slots> [<slots>...]", args: 1, optional: -1, mutates: true, run: (*shell).createParkingLot},
+	"park":               {usage: "park <registration> <colour> [motorcycle|compact|car|truck] [<slot>]", args: 2, optional: 2, needsLot: true, mutates: true, run: (*shell).park},
+	"park_permit":        {usage: "park_permit <registration> <colour> [motorcycle|compact|car|truck]", args: 2, optional: 1, needsLot: true, mutates: true, run: (*shell).parkPermit},
+	"park_charging":      {usage: "park_charging <registration> <colour> [motorcycle|compact|car|truck]", args: 2, optional: 1, needsLot: true, mutates: true, run: (*shell).parkCharging},
+	"start_charging":     {usage: "start_charging <registration>", args: 1, needsLot: true, mutates: true, run: (*shell).startCharging},
+	"end_charging":       {usage: "end_charging <registration> <kWh>", args: 2, needsLot: true, mutates: true, run: (*shell).endCharging},
+	"add_service":        {usage: "add_service <registration> <service>", args: 2, needsLot: true, mutates: true, run: (*shell).addService},
+	"attach_evidence":    {usage: "attach_evidence <registration> <ref>", args: 2, needsLot: true, mutates: true, run: (*shell).attachEvidence},
+	"evidence":           {usage: "evidence <registration>", args: 1, needsLot: true, run: (*shell).evidence},
+	"add_note":           {usage: "add_note <registration> <text>...", args: 2, optional: -1, needsLot: true, mutates: true, run: (*shell).addNote},
+	"add_incident":       {usage: "add_incident <registration> <text>...", args: 2, optional: -1, needsLot: true, mutates: true, run: (*shell).addIncident},
+	"notes":              {usage: "notes <registration>", args: 1, needsLot: true, run: (*shell).notes},
+	"services":           {usage: "services", run: (*shell).services},
+	"park_at":            {usage: "park_at <gate> <registration> <colour> [motorcycle|compact|car|truck]", args: 3, optional: 1, needsLot: true, mutates: true, run: (*shell).parkAt},
+	"queue":              {usage: "queue <gate> <cars>", args: 2, needsLot: true, mutates: true, run: (*shell).queue},
+	"join_queue":         {usage: "join_queue <gate>", args: 1, needsLot: true, mutates: true, run: (*shell).joinQueue},
+	"queues":             {usage: "queues", needsLot: true, run: (*shell).queues},
+	"gate_throughput":    {usage: "gate_throughput <from> <to>", args: 2, needsLot: true, run: (*shell).gateThroughput},
+	"report_mismatch":    {usage: "report_mismatch <registration> <motorcycle|compact|car|truck> [<source>]", args: 2, optional: 1, needsLot: true, mutates: true, run: (*shell).reportMismatch},
+	"mismatches":         {usage: "mismatches", needsLot: true, run: (*shell).mismatches},
+	"leave":              {usage: "leave <slot>", args: 1, needsLot: true, mutates: true, evacuate: true, run: (*shell).leave},
+	"force_free":         {usage: "force_free <slot> <reason>...", args: 2, optional: -1, needsLot: true, mutates: true, evacuate: true, run: (*shell).forceFree},
+	"restore":            {usage: "restore <registration>", args: 1, needsLot: true, mutates: true, run: (*shell).restore},
+	"checkout":           {usage: "checkout <ticket|registration>", args: 1, needsLot: true, mutates: true, evacuate: true, run: (*shell).checkout},
+	"ticket":             {usage: "ticket <ticket>", args: 1, needsLot: true, run: (*shell).ticket},
+	"exit_car":           {usage: "exit_car <registration>", args: 1, needsLot: true, mutates: true, evacuate: true, run: (*shell).exitCar},
+	"pay_and_exit":       {usage: "pay_and_exit <registration> <payment-method>", args: 2, needsLot: true, mutates: true, evacuate: true, run: (*shell).payAndExit},
+	"refund":             {usage: "refund <payment-id> <amount>", args: 2, needsLot: true, mutates: true, run: (*shell).refund},
+	"payment_status":     {usage: "payment_status <payment-id>", args: 1, needsLot: true, run: (*shell).paymentStatus},
+	"status":             {usage: "status [<floor>]", optional: 1, needsLot: true, run: (*shell).status},
+	"stats":              {usage: "stats", needsLot: true, run: (*shell).stats},
+	"vacancies":          {usage: "vacancies [<min-duration>]", optional: 1, needsLot: true, run: (*shell).vacancies},
+	"slot_usage":         {usage: "slot_usage", needsLot: true, run: (*shell).slotUsage},
+	"free_slots":         {usage: "free_slots", needsLot: true, run: (*shell).freeSlots},
+	"registration_numbers_for_cars_with_colour": {
+		usage: "registration_numbers_for_cars_with_colour <colour>", args: 1, needsLot: true,
+		run: (*shell).registrationNumbersForColor,
+	},
+	"slot_numbers_for_cars_with_colour": {
+		usage: "slot_numbers_for_cars_with_colour <colour>", args: 1, needsLot: true,
+		run: (*shell).slotNumbersForColor,
+	},
+	"slot_number_for_registration_number": {
+		usage: "slot_number_for_registration_number <registration>", args: 1, needsLot: true,
+		run: (*shell).slotNumberForRegistrationNumber,
+	},
+	"revenue_report":      {usage: "revenue_report <from> <to>", args: 2, needsLot: true, run: (*shell).revenueReport},
+	"export_commissions":  {usage: "export_commissions <from> <to>", args: 2, needsLot: true, run: (*shell).exportCommissions},
+	"origin_mix":          {usage: "origin_mix <from> <to>", args: 2, needsLot: true, run: (*shell).originMix},
+	"reconcile_no_shows":  {usage: "reconcile_no_shows", needsLot: true, mutates: true, run: (*shell).reconcileNoShows},
+	"reserve":             {usage: "reserve <registration> <from> <to>", args: 3, needsLot: true, mutates: true, run: (*shell).reserve},
+	"reservations":        {usage: "reservations", needsLot: true, run: (*shell).reservations},
+	"expire_reservations": {usage: "expire_reservations", needsLot: true, mutates: true, run: (*shell).expireReservations},
+	"log_violation":       {usage: "log_violation <registration> <location>...", args: 2, optional: -1, needsLot: true, mutates: true, run: (*shell).logViolation},
+	"clear_violation":     {usage: "clear_violation <id>", args: 1, needsLot: true, mutates: true, run: (*shell).clearViolation},
+	"violations":          {usage: "violations", needsLot: true, run: (*shell).violations},
+	"tow_list":            {usage: "tow_list", needsLot: true, run: (*shell).towList},
+	"slot_note":           {usage: "slot_note <slot> <text>...", args: 2, optional: -1, needsLot: true, mutates: true, run: (*shell).slotNote},
+	"slot_issue":          {usage: "slot_issue <slot> <text>...", args: 2, optional: -1, needsLot: true, mutates: true, run: (*shell).slotIssue},
+	"resolve_slot_issue":  {usage: "resolve_slot_issue <id>", args: 1, needsLot: true, mutates: true, run: (*shell).resolveSlotIssue},
+	"slot_asset":          {usage: "slot_asset <slot> <key> [<value>...]", args: 2, optional: -1, needsLot: true, mutates: true, run: (*shell).slotAsset},
+	"slot_info":           {usage: "slot_info <slot>", args: 1, needsLot: true, run: (*shell).slotInfo},
+	"maintenance":         {usage: "maintenance", needsLot: true, run: (*shell).maintenance},
+	"cleaning":            {usage: "cleaning", needsLot: true, run: (*shell).cleaning},
+	"end_cleaning":        {usage: "end_cleaning <slot>", args: 1, needsLot: true, mutates: true, run: (*shell).endCleaning},
+	"evacuate":            {usage: "evacuate", needsLot: true, mutates: true, evacuate: true, run: (*shell).evacuate},
+	"end_evacuation":      {usage: "end_evacuation", needsLot: true, mutates: true, evacuate: true, run: (*shell).endEvacuation},
+	"evacuation_report":   {usage: "evacuation_report", needsLot: true, run: (*shell).evacuationReport},
+	"dump_state":          {usage: "dump_state", needsLot: true, run: (*shell).dumpState},
+	"integrity":           {usage: "integrity", needsLot: true, run: (*shell).integrity},
+	"verify_event_log":    {usage: "verify_event_log", run: (*shell).verifyEventLog},
+}
+
+// run executes commands line by line until the input ends or an exit command, prompting when interactive,
+// and saves the state file on the way out
+func (s *shell) run(in io.Reader, interactive bool) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if interactive {
+			s.prompt()
+		}
+		if !scanner.Scan() {
+			break
+		}
+		ok, err := s.execute(scanner.Text())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return s.save()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// prompt asks for the next command
+func (s *shell) prompt() {
+	if s.accessible {
+		fmt.Fprint(s.out, "Command: ")
+		return
+	}
+	fmt.Fprint(s.out, "$ ")
+}
+
+// execute runs one command line, returning false once the shell should stop and an error if a
+// change could not be logged or saved
+func (s *shell) execute(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true, nil
+	}
+
+	name, args := fields[0], fields[1:]
+	if name == "exit" {
+		return false, nil
+	}
+
+	c, ok := commands[name]
+	if !ok {
+		s.fail(fmt.Sprintf("Unknown command: %s", name), fmt.Errorf("unknown command: %s", name))
+		return true, nil
+	}
+	if len(args) < c.args || c.optional >= 0 && len(args) > c.args+c.optional {
+		s.fail(fmt.Sprintf("Usage: %s", c.usage), fmt.Errorf("usage: %s", c.usage))
+		return true, nil
+	}
+	if c.needsLot && s.cp.Capacity() == 0 {
+		s.fail("Sorry, parking lot is not created", errLotNotCreated)
+		return true, nil
+	}
+
+	if c.mutates && !c.evacuate && s.cp.Evacuating() {
+		s.fail("Sorry, the parking lot is being evacuated", parking.ErrEvacuating)
+		return true, nil
+	}
+
+	c.run(s, args)
+	if !c.mutates {
+		return true, nil
+	}
+	return true, s.commit()
+}
+
+// writeJSON writes a single JSON document on its own line
+func (s *shell) writeJSON(v interface{}) {
+	if err := json.NewEncoder(s.out).Encode(v); err != nil {
+		fmt.Fprintln(s.out, err)
+	}
+}
+
+// fail reports a failed command, as the given text or as a JSON error object
+func (s *shell) fail(text string, err error) {
+	if s.json {
+		s.writeJSON(errorJSON{Error: err.Error()})
+		return
+	}
+	fmt.Fprintln(s.out, text)
+}
+
+// createParkingLot initializes the parking lot and confirms its size. Given more than one number of slots,
+// it creates a floor for each, lowest first.
+func (s *shell) createParkingLot(args []string) {
+	sizes := make([]int, 0, len(args))
+	total := 0
+	for _, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			s.fail(fmt.Sprintf("Invalid number of slots: %s", arg), fmt.Errorf("invalid number of slots: %s", arg))
+			return
+		}
+		sizes = append(sizes, n)
+		total += n
+	}
+
+	floors := sizes
+	if len(sizes) == 1 {
+		floors = nil
+		s.cp.CreateParkingLot(total)
+	} else {
+		s.cp.CreateFloors(sizes...)
+	}
+	if s.json {
+		s.writeJSON(struct {
+			Slots  int   `json:"slots"`
+			Floors []int `json:"floors,omitempty"` // Slots on each floor, lowest first
+		}{total, floors})
+		return
+	}
+	if len(floors) > 0 {
+		fmt.Fprintf(s.out, "Created a parking lot with %d slots on %d floors\n", total, len(sizes))
+		return
+	}
+	fmt.Fprintf(s.out, "Created a parking lot with %d slots\n", total)
+}
+
+// park parks a car, or a vehicle of the given type, and prints the allocated slot number
+func (s *shell) park(args []string) {
+	// The slot is the last argument, after the vehicle type if one is given
+	opts := args[2:]
+	slotNo := 0
+	if n := len(opts); n > 0 {
+		v, err := strconv.Atoi(opts[n-1])
+		if err == nil {
+			slotNo, opts = v, opts[:n-1]
+		} else if n == 2 {
+			s.fail(fmt.Sprintf("Invalid slot number: %s", opts[1]), fmt.Errorf("invalid slot number: %s", opts[1]))
+			return
+		}
+	}
+	vehicle, ok := s.vehicleType(opts)
+	if !ok {
+		return
+	}
+
+	if slotNo == 0 {
+		ticket, err := s.cp.ParkVehicle(args[0], args[1], vehicle)
+		s.printParked(args[0], ticket, args[1], vehicle, err)
+		return
+	}
+	if vehicle != parking.VehicleCar {
+		s.fail("Sorry, only a car can ask for a slot", fmt.Errorf("only a car can ask for a slot, not a %s", vehicle))
+		return
+	}
+	_, err := s.cp.ParkInSlot(args[0], args[1], slotNo, parking.RequireSlot)
+	if errors.Is(err, parking.ErrSlotUnavailable) {
+		s.fail(fmt.Sprintf("Sorry, slot %d is not available", slotNo), err)
+		return
+	}
+	var ticket parking.Ticket
+	if err == nil {
+		var parked parking.ParkedCar
+		if parked, err = s.cp.FindCar(args[0]); err == nil {
+			ticket = parking.Ticket{ID: parked.Ticket, Slot: parked.Slot, Registration: parked.Registration, EntryTime: parked.ParkedAt}
+		}
+	}
+	s.printParked(args[0], ticket, args[1], vehicle, err)
+}
+
+// parkAt parks a vehicle arriving through a gate in the free slot nearest to it and prints the allocated slot number
+func (s *shell) parkAt(args []string) {
+	vehicle, ok := s.vehicleType(args[3:])
+	if !ok {
+		return
+	}
+
+	ticket, err := s.cp.ParkFromGate(args[0], args[1], args[2], vehicle)
+	if errors.Is(err, parking.ErrGateNotFound) {
+		s.fail(fmt.Sprintf("Gate not found: %s", args[0]), err)
+		return
+	}
+	s.printParked(args[1], ticket, args[2], vehicle, err)
+}
+
+// queue records the number of cars an attendant counted queuing at a gate and prints the queue
+func (s *shell) queue(args []string) {
+	length, err := strconv.Atoi(args[1])
+	if err != nil || length < 0 {
+		s.fail(fmt.Sprintf("Invalid number of cars: %s", args[1]), fmt.Errorf("invalid number of cars: %s", args[1]))
+		return
+	}
+
+	q, err := s.cp.ReportQueue(args[0], length)
+	s.printQueue(args[0], q, err)
+}
+
+// joinQueue records a car joining the queue at a gate and prints the queue
+func (s *shell) joinQueue(args []string) {
+	q, err := s.cp.JoinQueue(args[0])
+	s.printQueue(args[0], q, err)
+}
+
+// printQueue prints a gate's queue after a change to it, or why the change failed
+func (s *shell) printQueue(gate string, q parking.GateQueue, err error) {
+	if errors.Is(err, parking.ErrGateNotFound) {
+		s.fail(fmt.Sprintf("Gate not found: %s", gate), err)
+		return
+	}
+	if err != nil {
+		s.fail(err.Error(), err)
+		return
+	}
+	s.printQueues([]parking.GateQueue{q})
+}
+
+// queues prints the queue at each gate with the expected wait, as shown on the entry signs
+func (s *shell) queues(args []string) {
+	s.printQueues(s.cp.GateQueues())
+}
+
+// printQueues prints the length of each gate's queue and the expected wait
+func (s *shell) printQueues(queues []parking.GateQueue) {
+	if s.json {
+		s.writeJSON(queues)
+		return
+	}
+	for _, q := range queues {
+		if s.accessible {
+			fmt.Fprintf(s.out, "Gate %s, %d car(s) queued, wait about %d minute(s).\n", q.Gate, q.Length, q.WaitMinutes)
+			continue
+		}
+		fmt.Fprintf(s.out, "Gate %s: %d car(s), entry wait ~%d min\n", q.Gate, q.Length, q.WaitMinutes)
+	}
+}
+
+// gateThroughput prints how many cars entered through each gate between two days and the longest queue
+func (s *shell) gateThroughput(args []string) {
+	from, to, ok := s.parsePeriod(args)
+	if !ok {
+		return
+	}
+
+	throughput := s.cp.GateThroughput(from, to)
+	if s.json {
+		s.writeJSON(throughput)
+		return
+	}
+	for _, t := range throughput {
+		fmt.Fprintf(s.out, "Gate %s: %d entries, longest queue %d\n", t.Gate, t.Entries, t.PeakQueue)
+	}
+}
+
+// parkPermit parks a vehicle with an accessibility permit, in an accessible slot if one is free, and prints
+// the allocated slot number
+func (s *shell) parkPermit(args []string) {
+	vehicle, ok := s.vehicleType(args[2:])
+	if !ok {
+		return
+	}
+
+	ticket, err := s.cp.ParkWithPermit(args[0], args[1], vehicle)
+	s.printParked(args[0], ticket, args[1], vehicle, err)
+}
+
+// parkCharging parks a vehicle in a free slot with a charger and prints the allocated slot number
+func (s *shell) parkCharging(args []string) {
+	vehicle, ok := s.vehicleType(args[2:])
+	if !ok {
+		return
+	}
+
+	ticket, err := s.cp.ParkCharging(args[0], args[1], vehicle)
+	if errors.Is(err, parking.ErrNoFreeCharger) {
+		s.fail(fmt.Sprintf("Sorry, no free slot with a charger fits a %s", vehicle), err)
+		return
+	}
+	s.printParked(args[0], ticket, args[1], vehicle, err)
+}
+
+// startCharging starts a charging session for a parked vehicle
+func (s *shell) startCharging(args []string) {
+	session, err := s.cp.StartCharging(args[0])
+	switch {
+	case errors.Is(err, parking.ErrNoCharger):
+		s.fail(fmt.Sprintf("The slot of %s has no charger", args[0]), err)
+		return
+	case errors.Is(err, parking.ErrCharging):
+		s.fail(fmt.Sprintf("%s is already charging", args[0]), err)
+		return
+	case err != nil:
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(session)
+		return
+	}
+	fmt.Fprintf(s.out, "Charging started in slot %d\n", session.Slot)
+}
+
+// endCharging ends the charging session of a parked vehicle with the energy the charger delivered
+func (s *shell) endCharging(args []string) {
+	kWh, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid energy: %s", args[1]), err)
+		return
+	}
+
+	session, err := s.cp.EndCharging(args[0], kWh)
+	switch {
+	case errors.Is(err, parking.ErrEnergy):
+		s.fail(fmt.Sprintf("Invalid energy: %s", args[1]), err)
+		return
+	case errors.Is(err, parking.ErrNotCharging):
+		s.fail(fmt.Sprintf("%s is not charging", args[0]), err)
+		return
+	case err != nil:
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(session)
+		return
+	}
+	fmt.Fprintf(s.out, "Charging ended in slot %d: %.2f kWh\n", session.Slot, session.KWh)
+}
+
+// addService adds a service from the lot's catalog to the stay of a parked car
+func (s *shell) addService(args []string) {
+	ordered, err := s.cp.AddService(args[0], args[1])
+	if errors.Is(err, parking.ErrUnknownService) {
+		s.fail(fmt.Sprintf("Unknown service: %s", args[1]), err)
+		return
+	}
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(ordered)
+		return
+	}
+	added := ordered[len(ordered)-1]
+	fmt.Fprintf(s.out, "Added %s for %s to the stay of %s\n", added.Name, parking.FormatAmount(added.Price), args[0])
+}
+
+// attachEvidence records a photo reference against a parked car and confirms its slot
+func (s *shell) attachEvidence(args []string) {
+	slotNo, err := s.cp.AttachEvidence(args[0], args[1])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		evidence, _ := s.cp.EvidenceForRegistration(args[0])
+		s.writeJSON(evidenceJSON{Slot: slotNo, Registration: args[0], Evidence: evidence})
+		return
+	}
+	fmt.Fprintf(s.out, "Evidence attached to %s in slot %d\n", args[0], slotNo)
+}
+
+// evidence prints the photo references attached to a parked car, one per line
+func (s *shell) evidence(args []string) {
+	parked, err := s.cp.FindCar(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	evidence := append([]string{}, parked.Evidence...)
+	if s.json {
+		s.writeJSON(evidenceJSON{Slot: parked.Slot, Registration: parked.Registration, Evidence: evidence})
+		return
+	}
+	if len(evidence) == 0 {
+		fmt.Fprintln(s.out, "No evidence")
+		return
+	}
+	for _, ref := range evidence {
+		fmt.Fprintln(s.out, ref)
+	}
+}
+
+// addNote attaches the text after the registration number to the parked car
+func (s *shell) addNote(args []string) {
+	s.addCarNote(args, false)
+}
+
+// addIncident attaches a note to the parked car that flags an incident such as observed damage
+func (s *shell) addIncident(args []string) {
+	s.addCarNote(args, true)
+}
+
+// addCarNote attaches the text after the registration number to the parked car and confirms its slot
+func (s *shell) addCarNote(args []string, incident bool) {
+	slotNo, err := s.cp.AddNote(args[0], strings.Join(args[1:], " "), incident)
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		parked, _ := s.cp.FindCar(args[0])
+		s.writeJSON(notesJSON{Slot: slotNo, Registration: args[0], Notes: parked.Notes})
+		return
+	}
+	fmt.Fprintf(s.out, "Note added to %s in slot %d\n", args[0], slotNo)
+}
+
+// notes prints the notes attached to a parked car, oldest first
+func (s *shell) notes(args []string) {
+	parked, err := s.cp.FindCar(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(notesJSON{Slot: parked.Slot, Registration: parked.Registration, Notes: parked.Notes})
+		return
+	}
+	if len(parked.Notes) == 0 {
+		fmt.Fprintln(s.out, "No notes")
+		return
+	}
+	for _, note := range parked.Notes {
+		kind := "Note"
+		if note.Incident {
+			kind = "Incident"
+		}
+		if s.accessible {
+			fmt.Fprintf(s.out, "%s, %s, added %s.\n", kind, note.Text, note.Time.Format("2006-01-02 15:04"))
+			continue
+		}
+		fmt.Fprintf(s.out, "%s  %-8s  %s\n", note.Time.Format("2006-01-02 15:04"), kind, note.Text)
+	}
+}
+
+// services prints the services the lot offers with their prices
+func (s *shell) services(args []string) {
+	catalog := s.cp.ServiceCatalog()
+	if s.json {
+		s.writeJSON(catalog)
+		return
+	}
+	for _, service := range catalog {
+		if s.accessible {
+			fmt.Fprintf(s.out, "%s, %s.\n", service.Name, parking.FormatAmount(service.Price))
+			continue
+		}
+		line := fmt.Sprintf("%-20s %10s   %s", service.Name, parking.FormatAmount(service.Price), service.Description)
+		fmt.Fprintln(s.out, strings.TrimRight(line, " "))
+	}
+}
+
+// vehicleType parses the optional vehicle type ending a park command, a car if it is left out
+func (s *shell) vehicleType(args []string) (parking.VehicleType, bool) {
+	if len(args) == 0 {
+		return parking.VehicleCar, true
+	}
+	vehicle, err := parking.ParseVehicleType(args[0])
+	if err != nil {
+		s.fail(fmt.Sprintf("Unknown vehicle type: %s", args[0]), err)
+		return "", false
+	}
+	return vehicle, true
+}
+
+// printParked prints the slot a vehicle was parked in and the visit it was linked to on re-entry,
+// or why it could not be parked
+func (s *shell) printParked(registration string, ticket parking.Ticket, color string, vehicle parking.VehicleType, err error) {
+	if errors.Is(err, parking.ErrInvalidRegistration) {
+		s.fail(fmt.Sprintf("Invalid registration number: %s", registration), err)
+		return
+	}
+	if errors.Is(err, parking.ErrAlreadyParked) {
+		parked, _ := s.cp.FindCar(registration)
+		s.fail(fmt.Sprintf("Sorry, %s is already parked in slot %d", registration, parked.Slot), err)
+		return
+	}
+	if errors.Is(err, parking.ErrNoFittingSlot) {
+		s.fail(fmt.Sprintf("Sorry, no free slot fits a %s", vehicle), err)
+		return
+	}
+	if err != nil {
+		s.fail("Sorry, parking lot is full", err)
+		return
+	}
+
+	slotNo := ticket.Slot
+	if s.json {
+		parked := slotJSON{Slot: slotNo, Registration: ticket.Registration, Color: color, Ticket: ticket.ID, ParkedAt: ticket.EntryTime}
+		if vehicle != parking.VehicleCar {
+			parked.Vehicle = string(vehicle)
+		}
+		s.writeJSON(parked)
+		return
+	}
+
+	fmt.Fprintf(s.out, "Allocated slot number: %d\n", slotNo)
+	if parked, err := s.cp.StatusDetail(slotNo); err == nil && !parked.PreviousExit.IsZero() {
+		fmt.Fprintf(s.out, "Re-entry linked to visit that left at %s\n", parked.PreviousExit.Format(time.Kitchen))
+	}
+}
+
+// reportMismatch records that a parked vehicle is too big for its slot and prints an alert with the slot
+// suggested for moving it to
+func (s *shell) reportMismatch(args []string) {
+	vehicle, err := parking.ParseVehicleType(args[1])
+	if err != nil {
+		s.fail(fmt.Sprintf("Unknown vehicle type: %s", args[1]), err)
+		return
+	}
+	source := "attendant"
+	if len(args) == 3 {
+		source = args[2]
+	}
+
+	m, err := s.cp.ReportSizeMismatch(args[0], vehicle, source)
+	switch {
+	case errors.Is(err, parking.ErrNoMismatch):
+		s.fail(fmt.Sprintf("A %s fits %s", vehicle, args[0]), err)
+		return
+	case err != nil:
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(m)
+		return
+	}
+	s.printMismatch(m)
+}
+
+// mismatches prints the vehicles reported as too big for their slot that are still parked in it
+func (s *shell) mismatches(args []string) {
+	open := s.cp.OpenMismatches()
+	if s.json {
+		s.writeJSON(open)
+		return
+	}
+	for _, m := range open {
+		s.printMismatch(m)
+	}
+}
+
+// printMismatch prints an alert for a vehicle too big for its slot and where to move it
+func (s *shell) printMismatch(m parking.Mismatch) {
+	fmt.Fprintf(s.out, "Alert: %s is a %s and does not fit %s slot %d", m.Registration, m.Vehicle, m.Size, m.Slot)
+	if m.Target == 0 {
+		fmt.Fprintln(s.out, "; no free slot fits it")
+		return
+	}
+	fmt.Fprintf(s.out, "; move it to slot %d\n", m.Target)
+}
+
+// leave frees a slot and confirms it
+func (s *shell) leave(args []string) {
+	slotNo, err := strconv.Atoi(args[0])
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid slot number: %s", args[0]), fmt.Errorf("invalid slot number: %s", args[0]))
+		return
+	}
+
+	car, err := s.cp.Leave(slotNo)
+	if err != nil {
+		s.fail("Slot not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(slotJSON{Slot: slotNo, Registration: car.Registration, Color: car.Color, ParkedAt: car.ParkedAt})
+		return
+	}
+	fmt.Fprintf(s.out, "Slot number %d is free\n", slotNo)
+}
+
+// forceFree frees a slot whose bay is empty though a car is recorded in it, giving the reason after the slot number
+func (s *shell) forceFree(args []string) {
+	slotNo, err := strconv.Atoi(args[0])
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid slot number: %s", args[0]), fmt.Errorf("invalid slot number: %s", args[0]))
+		return
+	}
+
+	rec, err := s.cp.ForceFree(slotNo, strings.Join(args[1:], " "))
+	if err != nil {
+		s.fail("Slot not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(rec)
+		return
+	}
+	fmt.Fprintf(s.out, "Slot number %d is free, %s was recorded there\n", slotNo, rec.Registration)
+}
+
+// restore puts back a car that left by mistake within the restore window and prints the slot it is back in
+func (s *shell) restore(args []string) {
+	slotNo, err := s.cp.Restore(args[0])
+	if errors.Is(err, parking.ErrLotFull) {
+		s.fail("Sorry, parking lot is full", err)
+		return
+	}
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		parked, _ := s.cp.FindCar(args[0])
+		restored := slotJSON{Slot: slotNo, Registration: parked.Registration, Color: parked.Color, Ticket: parked.Ticket, ParkedAt: parked.ParkedAt}
+		if parked.Vehicle != "" && parked.Vehicle != parking.VehicleCar {
+			restored.Vehicle = string(parked.Vehicle)
+		}
+		s.writeJSON(restored)
+		return
+	}
+	fmt.Fprintf(s.out, "Restored %s to slot number: %d\n", args[0], slotNo)
+}
+
+// checkout frees the slot of the car with a ticket or registration number and confirms it
+func (s *shell) checkout(args []string) {
+	ticket, err := s.cp.Checkout(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(ticket)
+		return
+	}
+	fmt.Fprintf(s.out, "Slot number %d is free\n", ticket.Slot)
+}
+
+// exitCar frees the slot of a car and prints the receipt for its stay
+func (s *shell) exitCar(args []string) {
+	bill, err := s.cp.Exit(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(bill)
+		return
+	}
+	fmt.Fprintf(s.out, "Slot number %d is free\n", bill.Slot)
+	if s.accessible {
+		fmt.Fprintf(s.out, "Time parked: %s\n", bill.Duration.Round(time.Second))
+		fmt.Fprintf(s.out, "Hours charged: %d\n", bill.Hours)
+		fmt.Fprintf(s.out, "Amount due: %s\n", parking.FormatAmount(bill.Amount))
+		return
+	}
+	bill.WriteReceipt(s.out)
+}
+
+// payAndExit collects the amount due for a car's stay with the driver's payment method, then frees its slot
+// and prints the receipt
+func (s *shell) payAndExit(args []string) {
+	bill, err := s.cp.PayAndExit(context.Background(), args[0], args[1])
+	if err != nil {
+		s.fail(fmt.Sprintf("Payment failed: %v", err), err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(bill)
+		return
+	}
+	fmt.Fprintf(s.out, "Slot number %d is free\n", bill.Slot)
+	if s.accessible {
+		fmt.Fprintf(s.out, "Amount paid: %s\n", parking.FormatAmount(bill.Amount))
+		return
+	}
+	bill.WriteReceipt(s.out)
+}
+
+// refund returns an amount in cents of a payment to the driver
+func (s *shell) refund(args []string) {
+	amount, err := strconv.Atoi(args[1])
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid amount: %s", args[1]), fmt.Errorf("invalid amount: %s", args[1]))
+		return
+	}
+
+	if err := s.cp.Refund(context.Background(), args[0], amount); err != nil {
+		s.fail(fmt.Sprintf("Refund failed: %v", err), err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(struct {
+			PaymentID string `json:"payment_id"`
+			Refunded  int    `json:"refunded"`
+		}{args[0], amount})
+		return
+	}
+	fmt.Fprintf(s.out, "Refunded %s of payment %s\n", parking.FormatAmount(amount), args[0])
+}
+
+// paymentStatus prints how far a payment has got with the payment provider
+func (s *shell) paymentStatus(args []string) {
+	status, err := s.cp.PaymentStatus(context.Background(), args[0])
+	if err != nil {
+		s.fail(fmt.Sprintf("Payment status unavailable: %v", err), err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(struct {
+			PaymentID string                `json:"payment_id"`
+			Status    parking.PaymentStatus `json:"status"`
+		}{args[0], status})
+		return
+	}
+	fmt.Fprintf(s.out, "Payment %s: %s\n", args[0], status)
+}
+
+// ticket prints where the car with a ticket is parked and when it entered
+func (s *shell) ticket(args []string) {
+	ticket, err := s.cp.TicketLookup(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(ticket)
+		return
+	}
+	fmt.Fprintf(s.out, "Ticket %s: slot %d, registration %s, entered at %s\n",
+		ticket.ID, ticket.Slot, ticket.Registration, ticket.EntryTime.Format(time.Kitchen))
+}
+
+// status prints the parked cars as a table, only those on a floor if one is given
+func (s *shell) status(args []string) {
+	status := s.cp.Status()
+	if len(args) == 1 {
+		floor, err := strconv.Atoi(args[0])
+		if err == nil {
+			status, err = s.cp.FloorStatus(floor)
+		}
+		if err != nil {
+			s.fail(fmt.Sprintf("Floor not found: %s", args[0]), err)
+			return
+		}
+	}
+
+	if s.json {
+		parked := make([]slotJSON, 0, len(status))
+		for _, p := range status {
+			parked = append(parked, slotJSON{Slot: p.Slot, Registration: p.Registration, Color: p.Color, Vehicle: string(p.Vehicle), ParkedAt: p.ParkedAt})
+		}
+		s.writeJSON(parked)
+		return
+	}
+	if s.accessible {
+		if len(args) == 0 {
+			s.statsSentence(s.cp.Stats())
+		}
+		s.statusSentences(status)
+		return
+	}
+
+	if len(args) == 0 {
+		st := s.cp.Stats()
+		fmt.Fprintf(s.out, "%d occupied, %d free, %d closed of %d slots (%.0f%% full)\n",
+			st.Occupied, st.Free, st.Closed, st.Slots, st.Occupancy*100)
+	}
+	fmt.Fprintln(s.out, "Slot No. Registration No Colour")
+	for _, parked := range status {
+		fmt.Fprintf(s.out, "%d        %s   %s\n", parked.Slot, parked.Registration, parked.Color)
+	}
+}
+
+// logViolation records a vehicle parked outside the managed slots, at a location given as the remaining words
+func (s *shell) logViolation(args []string) {
+	v, err := s.cp.LogViolation(args[0], strings.Join(args[1:], " "))
+	if err != nil {
+		s.fail(err.Error(), err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(v)
+		return
+	}
+	fmt.Fprintf(s.out, "Violation %s: %s in %s\n", v.ID, v.Registration, v.Location)
+}
+
+// clearViolation records that the vehicle of a violation was moved or towed
+func (s *shell) clearViolation(args []string) {
+	v, err := s.cp.ClearViolation(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(v)
+		return
+	}
+	fmt.Fprintf(s.out, "Violation %s cleared: %s\n", v.ID, v.Registration)
+}
+
+// violations prints every logged violation, oldest first
+func (s *shell) violations(args []string) {
+	s.printViolations(s.cp.AllViolations())
+}
+
+// towList prints the vehicles still parked outside the managed slots, longest there first
+func (s *shell) towList(args []string) {
+	s.printViolations(s.cp.TowList())
+}
+
+// printViolations prints violations with where the vehicle is and since when
+func (s *shell) printViolations(violations []parking.Violation) {
+	if s.json {
+		s.writeJSON(violations)
+		return
+	}
+	for _, v := range violations {
+		cleared := ""
+		if !v.Cleared.IsZero() {
+			cleared = fmt.Sprintf(", cleared %s", v.Cleared.Format("2006-01-02 15:04"))
+		}
+		if s.accessible {
+			fmt.Fprintf(s.out, "Registration %s, in %s, since %s%s.\n", v.Registration, v.Location, v.FirstSeen.Format("2006-01-02 15:04"), cleared)
+			continue
+		}
+		fmt.Fprintf(s.out, "%s   %s   %s   since %s%s\n", v.ID, v.Registration, v.Location, v.FirstSeen.Format("2006-01-02 15:04"), cleared)
+	}
+}
+
+// slotNote attaches a note to a slot
+func (s *shell) slotNote(args []string) {
+	s.addSlotNote(args, false)
+}
+
+// slotIssue attaches a note to a slot that flags it as needing maintenance
+func (s *shell) slotIssue(args []string) {
+	s.addSlotNote(args, true)
+}
+
+// addSlotNote attaches the text after the slot number to the slot and confirms it with the note's ID
+func (s *shell) addSlotNote(args []string, attention bool) {
+	slotNo, err := strconv.Atoi(args[0])
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid slot number: %s", args[0]), fmt.Errorf("invalid slot number: %s", args[0]))
+		return
+	}
+
+	note, err := s.cp.AddSlotNote(slotNo, strings.Join(args[1:], " "), attention)
+	if errors.Is(err, parking.ErrNoSlot) {
+		s.fail(fmt.Sprintf("No such slot: %d", slotNo), err)
+		return
+	}
+	if err != nil {
+		s.fail(err.Error(), err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(note)
+		return
+	}
+	fmt.Fprintf(s.out, "Note %s added to slot %d\n", note.ID, note.Slot)
+}
+
+// resolveSlotIssue records that the maintenance a slot note asked for was done
+func (s *shell) resolveSlotIssue(args []string) {
+	note, err := s.cp.ResolveSlotNote(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(note)
+		return
+	}
+	fmt.Fprintf(s.out, "Slot %d: %s resolved\n", note.Slot, note.Text)
+}
+
+// slotAsset records an asset of a slot under a key, or removes it when no value is given
+func (s *shell) slotAsset(args []string) {
+	slotNo, err := strconv.Atoi(args[0])
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid slot number: %s", args[0]), fmt.Errorf("invalid slot number: %s", args[0]))
+		return
+	}
+
+	value := strings.Join(args[2:], " ")
+	err = s.cp.SetSlotAsset(slotNo, args[1], value)
+	if errors.Is(err, parking.ErrNoSlot) {
+		s.fail(fmt.Sprintf("No such slot: %d", slotNo), err)
+		return
+	}
+	if err != nil {
+		s.fail(err.Error(), err)
+		return
+	}
+
+	details, _ := s.cp.SlotInfo(slotNo)
+	if s.json {
+		s.writeJSON(details)
+		return
+	}
+	if value == "" {
+		fmt.Fprintf(s.out, "Slot %d: %s removed\n", slotNo, args[1])
+		return
+	}
+	fmt.Fprintf(s.out, "Slot %d: %s is %s\n", slotNo, args[1], value)
+}
+
+// slotInfo prints the notes and assets of a slot
+func (s *shell) slotInfo(args []string) {
+	slotNo, err := strconv.Atoi(args[0])
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid slot number: %s", args[0]), fmt.Errorf("invalid slot number: %s", args[0]))
+		return
+	}
+
+	details, err := s.cp.SlotInfo(slotNo)
+	if err != nil {
+		s.fail(fmt.Sprintf("No such slot: %d", slotNo), err)
+		return
+	}
+	s.printSlotDetails([]parking.SlotDetails{details})
+}
+
+// maintenance prints the slots needing maintenance with the notes asking for it
+func (s *shell) maintenance(args []string) {
+	s.printSlotDetails(s.cp.NeedingAttention())
+}
+
+// cleaning prints the slots held for cleaning with when each returns to allocation, lowest first
+func (s *shell) cleaning(args []string) {
+	holds := s.cp.CleaningHolds()
+	if s.json {
+		s.writeJSON(holds)
+		return
+	}
+	for _, h := range holds {
+		fmt.Fprintf(s.out, "Slot %d: held for cleaning until %s\n", h.Slot, h.Until.Format(time.Kitchen))
+	}
+}
+
+// endCleaning returns a slot held for cleaning to allocation before its window closes
+func (s *shell) endCleaning(args []string) {
+	slotNo, err := strconv.Atoi(args[0])
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid slot number: %s", args[0]), fmt.Errorf("invalid slot number: %s", args[0]))
+		return
+	}
+
+	hold, err := s.cp.EndCleaning(slotNo)
+	if err != nil {
+		s.fail(fmt.Sprintf("Slot %d is not held for cleaning", slotNo), err)
+		return
+	}
+	if s.json {
+		s.writeJSON(hold)
+		return
+	}
+	fmt.Fprintf(s.out, "Slot number %d is back in use\n", slotNo)
+}
+
+// printSlotDetails prints each slot's assets in key order followed by its notes
+func (s *shell) printSlotDetails(slots []parking.SlotDetails) {
+	if s.json {
+		s.writeJSON(slots)
+		return
+	}
+	for _, details := range slots {
+		keys := make([]string, 0, len(details.Assets))
+		for key := range details.Assets {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		assets := make([]string, 0, len(keys))
+		for _, key := range keys {
+			assets = append(assets, fmt.Sprintf("%s: %s", key, details.Assets[key]))
+		}
+		if s.accessible {
+			fmt.Fprintf(s.out, "Slot %d.", details.Slot)
+			if len(assets) > 0 {
+				fmt.Fprintf(s.out, " %s.", strings.Join(assets, ", "))
+			}
+			fmt.Fprintln(s.out)
+		} else {
+			fmt.Fprintf(s.out, "Slot %d   %s\n", details.Slot, strings.Join(assets, "   "))
+		}
+
+		for _, note := range details.Notes {
+			status := ""
+			switch {
+			case !note.Resolved.IsZero():
+				status = fmt.Sprintf(", resolved %s", note.Resolved.Format("2006-01-02 15:04"))
+			case note.Attention:
+				status = ", needs attention"
+			}
+			if s.accessible {
+				fmt.Fprintf(s.out, "Note %s, %s, added %s%s.\n", note.ID, note.Text, note.Time.Format("2006-01-02 15:04"), status)
+				continue
+			}
+			fmt.Fprintf(s.out, "  %s   %s   %s%s\n", note.ID, note.Text, note.Time.Format("2006-01-02 15:04"), status)
+		}
+	}
+}
+
+// evacuate puts the lot in evacuation mode and opens the barriers
+func (s *shell) evacuate(args []string) {
+	err := s.cp.StartEvacuation(context.Background())
+	if errors.Is(err, parking.ErrEvacuating) {
+		s.fail("The parking lot is already being evacuated", err)
+		return
+	}
+	if err != nil {
+		s.fail(fmt.Sprintf("Evacuation started, but %v", err), err)
+		return
+	}
+
+	report, _ := s.cp.LastEvacuation()
+	if s.json {
+		s.writeJSON(evacuationToJSON(report))
+		return
+	}
+	fmt.Fprintf(s.out, "Evacuation started with %d vehicles in the lot\n", report.Parked)
+}
+
+// endEvacuation takes the lot out of evacuation mode and prints the vehicles that remained
+func (s *shell) endEvacuation(args []string) {
+	report, err := s.cp.EndEvacuation(context.Background())
+	if errors.Is(err, parking.ErrNotEvacuating) {
+		s.fail("The parking lot is not being evacuated", err)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(s.out, "Evacuation ended, but %v\n", err)
+	}
+	s.printEvacuation(report)
+}
+
+// evacuationReport prints the evacuation under way or the last one, with the vehicles that remained
+func (s *shell) evacuationReport(args []string) {
+	report, err := s.cp.LastEvacuation()
+	if err != nil {
+		s.fail("The parking lot has not been evacuated", err)
+		return
+	}
+	s.printEvacuation(report)
+}
+
+// evacuationJSON is the JSON form of an evacuation report
+type evacuationJSON struct {
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"` // Omitted while the evacuation is under way
+	Parked    int        `json:"parked"`
+	Left      int        `json:"left"`
+	Remaining []slotJSON `json:"remaining"`
+}
+
+// evacuationToJSON converts an evacuation report to its JSON form
+func evacuationToJSON(report parking.Evacuation) evacuationJSON {
+	j := evacuationJSON{Start: report.Start, Parked: report.Parked, Left: report.Left, Remaining: make([]slotJSON, 0, len(report.Remaining))}
+	if !report.End.IsZero() {
+		j.End = &report.End
+	}
+	for _, p := range report.Remaining {
+		j.Remaining = append(j.Remaining, slotJSON{Slot: p.Slot, Registration: p.Registration, Color: p.Color, Vehicle: string(p.Vehicle), ParkedAt: p.ParkedAt})
+	}
+	return j
+}
+
+// printEvacuation prints when an evacuation ran, how many vehicles left and the vehicles that remained
+func (s *shell) printEvacuation(report parking.Evacuation) {
+	if s.json {
+		s.writeJSON(evacuationToJSON(report))
+		return
+	}
+
+	if report.End.IsZero() {
+		fmt.Fprintf(s.out, "Evacuation under way since %s\n", report.Start.Format("2006-01-02 15:04"))
+	} else {
+		fmt.Fprintf(s.out, "Evacuation from %s to %s\n", report.Start.Format("2006-01-02 15:04"), report.End.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(s.out, "%d of %d vehicles left, %d remain\n", report.Left, report.Parked, len(report.Remaining))
+	if s.accessible {
+		for _, parked := range report.Remaining {
+			fmt.Fprintf(s.out, "Slot %d: registration %s, colour %s.\n", parked.Slot, parked.Registration, parked.Color)
+		}
+		return
+	}
+	if len(report.Remaining) > 0 {
+		fmt.Fprintln(s.out, "Slot No. Registration No Colour")
+	}
+	for _, parked := range report.Remaining {
+		fmt.Fprintf(s.out, "%d        %s   %s\n", parked.Slot, parked.Registration, parked.Color)
+	}
+}
+
+// statusSentences prints the parked cars one labelled sentence per car, for screen readers
+func (s *shell) statusSentences(status []parking.ParkedCar) {
+	switch len(status) {
+	case 0:
+		fmt.Fprintln(s.out, "No cars are parked.")
+		return
+	case 1:
+		fmt.Fprintln(s.out, "1 car is parked.")
+	default:
+		fmt.Fprintf(s.out, "%d cars are parked.\n", len(status))
+	}
+	for _, parked := range status {
+		fmt.Fprintf(s.out, "Slot %d: registration %s, colour %s.\n", parked.Slot, parked.Registration, parked.Color)
+	}
+}
+
+// stats prints how many slots are occupied, free and closed
+func (s *shell) stats(args []string) {
+	st := s.cp.Stats()
+	if s.json {
+		s.writeJSON(st)
+		return
+	}
+	if s.accessible {
+		s.statsSentence(st)
+		return
+	}
+	fmt.Fprintf(s.out, "Slots:     %d\n", st.Slots)
+	fmt.Fprintf(s.out, "Occupied:  %d\n", st.Occupied)
+	fmt.Fprintf(s.out, "Free:      %d\n", st.Free)
+	fmt.Fprintf(s.out, "Closed:    %d\n", st.Closed)
+	fmt.Fprintf(s.out, "Occupancy: %.0f%%\n", st.Occupancy*100)
+}
+
+// statsSentence prints the slot counts as one sentence, for screen readers
+func (s *shell) statsSentence(st parking.LotStats) {
+	fmt.Fprintf(s.out, "%d of %d slots are occupied, %.0f percent. %d are free and %d are closed.\n",
+		st.Occupied, st.Slots, st.Occupancy*100, st.Free, st.Closed)
+}
+
+// freeSlots prints how many slots on each floor are free
+func (s *shell) freeSlots(args []string) {
+	counts := s.cp.FreeByFloor()
+	if s.json {
+		s.writeJSON(counts)
+		return
+	}
+	for _, c := range counts {
+		if s.accessible {
+			fmt.Fprintf(s.out, "Floor %d: %d of %d slots free.\n", c.Number, c.Free, c.Slots)
+			continue
+		}
+		fmt.Fprintf(s.out, "Floor %d: %d/%d free\n", c.Number, c.Free, c.Slots)
+	}
+}
+
+// vacancies prints the empty slots longest vacant first, only those vacant for at least a duration such as 72h
+// if one is given
+func (s *shell) vacancies(args []string) {
+	var min time.Duration
+	if len(args) == 1 {
+		var err error
+		if min, err = time.ParseDuration(args[0]); err != nil {
+			s.fail(fmt.Sprintf("Invalid duration: %s", args[0]), err)
+			return
+		}
+	}
+
+	vacancies := s.cp.Vacancies(min)
+	if s.json {
+		s.writeJSON(vacancies)
+		return
+	}
+	for _, v := range vacancies {
+		if s.accessible {
+			fmt.Fprintf(s.out, "Slot %d: empty for %d hours, since %s.\n", v.Slot, v.Hours, v.Since.Format(time.RFC1123))
+			continue
+		}
+		fmt.Fprintf(s.out, "Slot %d: vacant %s since %s\n", v.Slot, v.Duration.Round(time.Minute), v.Since.Format(time.RFC3339))
+	}
+}
+
+// slotUsage prints how many times each slot has been allocated, by slot number
+func (s *shell) slotUsage(args []string) {
+	usage := s.cp.SlotUsage()
+	slots := make([]slotUsageJSON, 0, len(usage))
+	for slotNo := 1; slotNo <= len(usage); slotNo++ {
+		slots = append(slots, slotUsageJSON{Slot: slotNo, Allocations: usage[slotNo]})
+	}
+	if s.json {
+		s.writeJSON(slots)
+		return
+	}
+	for _, u := range slots {
+		fmt.Fprintf(s.out, "Slot %d: %d allocation(s)\n", u.Slot, u.Allocations)
+	}
+}
+
+// registrationNumbersForColor prints a comma separated list of registration numbers or "Not found"
+func (s *shell) registrationNumbersForColor(args []string) {
+	regNumbers, err := s.cp.RegistrationNumbersForColor(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(regNumbers)
+		return
+	}
+	if s.accessible {
+		fmt.Fprintf(s.out, "Registration numbers: %s.\n", strings.Join(regNumbers, ", "))
+		return
+	}
+	fmt.Fprintln(s.out, strings.Join(regNumbers, ", "))
+}
+
+// slotNumbersForColor prints a comma separated list of slot numbers or "Not found"
+func (s *shell) slotNumbersForColor(args []string) {
+	slotNos, err := s.cp.SlotNumbersForColor(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(slotNos)
+		return
+	}
+	slotNosStr := make([]string, 0, len(slotNos))
+	for _, slotNo := range slotNos {
+		slotNosStr = append(slotNosStr, strconv.Itoa(slotNo))
+	}
+	if s.accessible {
+		fmt.Fprintf(s.out, "Slot numbers: %s.\n", strings.Join(slotNosStr, ", "))
+		return
+	}
+	fmt.Fprintln(s.out, strings.Join(slotNosStr, ", "))
+}
+
+// slotNumberForRegistrationNumber prints a single slot number or "Not found"
+func (s *shell) slotNumberForRegistrationNumber(args []string) {
+	parked, err := s.cp.FindCar(args[0])
+	if err != nil {
+		s.fail("Not found", err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(slotJSON{Slot: parked.Slot, Registration: parked.Registration, Color: parked.Color, ParkedAt: parked.ParkedAt})
+		return
+	}
+	if s.accessible {
+		fmt.Fprintf(s.out, "Slot number: %d.\n", parked.Slot)
+		return
+	}
+	fmt.Fprintln(s.out, parked.Slot)
+}
+
+// reconcileNoShows marks bookings for past days whose car never arrived as no-shows and lists them
+func (s *shell) reconcileNoShows(args []string) {
+	noShows := s.cp.ReconcileNoShows()
+	if s.json {
+		s.writeJSON(append([]parking.Booking{}, noShows...))
+		return
+	}
+	fmt.Fprintf(s.out, "%d booking(s) marked as no-shows\n", len(noShows))
+	for _, b := range noShows {
+		fmt.Fprintf(s.out, "  %s: %s on %s via %s\n", b.ID, b.Registration, b.Date, b.Partner)
+	}
+}
+
+// parsePeriod parses the first and last day of a report, given as YYYY-MM-DD
+func (s *shell) parsePeriod(args []string) (time.Time, time.Time, bool) {
+	from, err := time.Parse(time.DateOnly, args[0])
+	if err == nil {
+		var to time.Time
+		if to, err = time.Parse(time.DateOnly, args[1]); err == nil {
+			return from, to, true
+		}
+	}
+	s.fail("Invalid date, expected YYYY-MM-DD", err)
+	return time.Time{}, time.Time{}, false
+}
+
+// reservationTime is the layout of the times reserve takes, in local time
+const reservationTime = "2006-01-02T15:04"
+
+// reserve holds a slot for a car from one time to another and confirms which
+func (s *shell) reserve(args []string) {
+	from, to, ok := s.parseWindow(args[1:])
+	if !ok {
+		return
+	}
+
+	reservation, err := s.cp.Reserve(args[0], from, to)
+	if errors.Is(err, parking.ErrInvalidRegistration) {
+		s.fail(fmt.Sprintf("Invalid registration number: %s", args[0]), err)
+		return
+	}
+	if errors.Is(err, parking.ErrFullyReserved) {
+		s.fail("Sorry, every slot is reserved for some of that time", err)
+		return
+	}
+	if errors.Is(err, parking.ErrAlreadyReserved) {
+		s.fail(fmt.Sprintf("Sorry, %s already has a reservation for some of that time", args[0]), err)
+		return
+	}
+	if err != nil {
+		s.fail(err.Error(), err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(reservation)
+		return
+	}
+	fmt.Fprintf(s.out, "Reserved slot number: %d (%s)\n", reservation.Slot, reservation.ID)
+}
+
+// parseWindow parses the start and end of a reservation, given as YYYY-MM-DDTHH:MM in local time
+func (s *shell) parseWindow(args []string) (time.Time, time.Time, bool) {
+	from, err := time.ParseInLocation(reservationTime, args[0], time.Local)
+	if err == nil {
+		var to time.Time
+		if to, err = time.ParseInLocation(reservationTime, args[1], time.Local); err == nil {
+			return from, to, true
+		}
+	}
+	s.fail("Invalid time, expected YYYY-MM-DDTHH:MM", err)
+	return time.Time{}, time.Time{}, false
+}
+
+// reservations prints the pending reservations whose window has not ended, soonest first
+func (s *shell) reservations(args []string) {
+	reservations := s.cp.UpcomingReservations()
+	if s.json {
+		s.writeJSON(reservations)
+		return
+	}
+	s.printReservations(reservations)
+}
+
+// expireReservations marks reservations whose window ended without the car arriving as expired and lists them
+func (s *shell) expireReservations(args []string) {
+	expired := s.cp.ExpireReservations()
+	if s.json {
+		s.writeJSON(append([]parking.Reservation{}, expired...))
+		return
+	}
+	fmt.Fprintf(s.out, "%d reservation(s) expired\n", len(expired))
+	s.printReservations(expired)
+}
+
+// printReservations prints reservations with their slot and window
+func (s *shell) printReservations(reservations []parking.Reservation) {
+	for _, r := range reservations {
+		from, to := r.From.Format(reservationTime), r.To.Format(reservationTime)
+		if s.accessible {
+			fmt.Fprintf(s.out, "Slot %d, registration %s, from %s to %s, %s.\n", r.Slot, r.Registration, from, to, r.Status)
+			continue
+		}
+		fmt.Fprintf(s.out, "%s   %d   %s   %s   %s   %s\n", r.ID, r.Slot, r.Registration, from, to, r.Status)
+	}
+}
+
+// revenueReport prints the amount billed between two days and the commission owed to each partner
+func (s *shell) revenueReport(args []string) {
+	from, to, ok := s.parsePeriod(args)
+	if !ok {
+		return
+	}
+
+	report := s.cp.RevenueReport(from, to)
+	if s.json {
+		s.writeJSON(report)
+		return
+	}
+	fmt.Fprintf(s.out, "Revenue %s to %s: %s from %d stay(s)\n", report.From, report.To, parking.FormatAmount(report.Revenue), report.Stays)
+	for _, c := range report.Commissions {
+		fmt.Fprintf(s.out, "  %s: %d booking(s), %d no-show(s), %d stay(s) billed %s, commission %s\n",
+			c.Partner, c.Bookings, c.NoShows, c.Stays, parking.FormatAmount(c.Billed), parking.FormatAmount(c.Owed))
+	}
+}
+
+// exportCommissions writes the commission owed to each partner between two days as CSV for invoicing
+func (s *shell) exportCommissions(args []string) {
+	from, to, ok := s.parsePeriod(args)
+	if !ok {
+		return
+	}
+
+	if err := s.cp.RevenueReport(from, to).WriteCommissionsCSV(s.out); err != nil {
+		s.fail(err.Error(), err)
+	}
+}
+
+// originMix prints how many arrivals between two days came from each plate jurisdiction, most common first
+func (s *shell) originMix(args []string) {
+	from, to, ok := s.parsePeriod(args)
+	if !ok {
+		return
+	}
+
+	mix, err := s.cp.OriginMix(from, to)
+	if err != nil {
+		s.fail("No arrivals", err)
+		return
+	}
+	if s.json {
+		s.writeJSON(mix)
+		return
+	}
+	for _, o := range mix {
+		fmt.Fprintf(s.out, "%s: %d car(s), %.1f%%\n", o.Jurisdiction, o.Cars, o.Share*100)
+	}
+}
+
+// dumpState prints the internal allocation structures
+func (s *shell) dumpState(args []string) {
+	if s.json {
+		s.writeJSON(s.cp.StateDump())
+		return
+	}
+	s.cp.DumpState(s.out)
+}
+
+// integrity prints summary counts and any index disagreements
+func (s *shell) integrity(args []string) {
+	report := s.cp.IntegrityStats()
+	if s.json {
+		s.writeJSON(report)
+		return
+	}
+	fmt.Fprintf(s.out, "Slots: %d, occupied: %d, free: %d, cooling: %d, cleaning: %d, registrations: %d, colors: %d\n",
+		report.Slots, report.Occupied, report.Free, report.Cooling, report.Cleaning, report.Registrations, report.Colors)
+	if report.OK() {
+		fmt.Fprintln(s.out, "Integrity: ok")
+		return
+	}
+	fmt.Fprintf(s.out, "Integrity: %d problem(s)\n", len(report.Problems))
+	for _, p := range report.Problems {
+		fmt.Fprintln(s.out, "  "+p)
+	}
+}
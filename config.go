@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// overrides are the settings one level of the configuration file sets. A setting left out keeps its value
+// from the level below.
+type overrides struct {
+	Tariff        *parking.RateCard `json:"tariff,omitempty"`         // Replaces the whole rate card
+	PlatePattern  *string           `json:"plate_pattern,omitempty"`  // Registration numbers must match it in full, any is accepted if empty
+	GracePeriod   *duration         `json:"grace_period,omitempty"`   // Cool-down before a freed slot is allocated again, none if zero
+	ReentryWindow *duration         `json:"reentry_window,omitempty"` // Time after leaving in which a returning car is linked to its visit
+	Allotment     *int              `json:"allotment,omitempty"`      // Bookings all partners together may hold for one day
+	Quotas        map[string]int    `json:"quotas,omitempty"`         // Daily booking quotas by partner name, overriding partners one by one
+}
+
+// duration is a time.Duration written in the configuration file as a string such as "5m"
+type duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// lotConfig is the section of the configuration file for one lot
+type lotConfig struct {
+	Tenant string `json:"tenant,omitempty"` // Tenant whose section applies to the lot before its own
+	overrides
+}
+
+// config is the file given with --config. Settings apply in order of precedence, each overriding the last:
+// the command-line flags, the global section, the section of the lot's tenant and the section of the lot.
+type config struct {
+	Global  overrides            `json:"global"`
+	Tenants map[string]overrides `json:"tenants"`
+	Lots    map[string]lotConfig `json:"lots"`
+}
+
+// effectiveConfig is the result of merging the sections of the configuration file that apply to a lot
+type effectiveConfig struct {
+	Lot           string            `json:"lot,omitempty"`
+	Tenant        string            `json:"tenant,omitempty"`
+	Tariff        *parking.RateCard `json:"tariff,omitempty"`
+	PlatePattern  *string           `json:"plate_pattern,omitempty"` // Empty when a section cleared the pattern, nil when none set it
+	GracePeriod   *duration         `json:"grace_period,omitempty"`
+	ReentryWindow *duration         `json:"reentry_window,omitempty"`
+	Allotment     *int              `json:"allotment,omitempty"`
+	Quotas        map[string]int    `json:"quotas,omitempty"`
+	Sources       map[string]string `json:"sources"` // Map to store the section each setting came from by setting name
+}
+
+// loadConfig reads the configuration file and checks every section in it, including that each quota is for
+// one of the partners given with --partners
+func loadConfig(path string, partners []parking.Partner) (config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config{}, err
+	}
+
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.Global.validate(partners); err != nil {
+		return config{}, fmt.Errorf("%s: global: %w", path, err)
+	}
+	for name, o := range c.Tenants {
+		if err := o.validate(partners); err != nil {
+			return config{}, fmt.Errorf("%s: tenant %s: %w", path, name, err)
+		}
+	}
+	for name, l := range c.Lots {
+		if _, ok := c.Tenants[l.Tenant]; l.Tenant != "" && !ok {
+			return config{}, fmt.Errorf("%s: lot %s: unknown tenant %s", path, name, l.Tenant)
+		}
+		if err := l.validate(partners); err != nil {
+			return config{}, fmt.Errorf("%s: lot %s: %w", path, name, err)
+		}
+	}
+	return c, nil
+}
+
+// validate checks the tariff, plate pattern, durations and quotas of a section, quotas against the partners of the lot
+func (o overrides) validate(partners []parking.Partner) error {
+	if o.Tariff != nil {
+		if err := o.Tariff.Validate(); err != nil {
+			return fmt.Errorf("tariff: %w", err)
+		}
+	}
+	if o.PlatePattern != nil {
+		if _, err := platePattern(*o.PlatePattern); err != nil {
+			return err
+		}
+	}
+	if o.GracePeriod != nil && *o.GracePeriod < 0 {
+		return errors.New("grace period must not be negative")
+	}
+	if o.ReentryWindow != nil && *o.ReentryWindow < 0 {
+		return errors.New("re-entry window must not be negative")
+	}
+	if o.Allotment != nil && *o.Allotment < 0 {
+		return errors.New("allotment must not be negative")
+	}
+	for partner, quota := range o.Quotas {
+		if quota < 0 {
+			return fmt.Errorf("quota of %s must not be negative", partner)
+		}
+		if !slices.ContainsFunc(partners, func(p parking.Partner) bool { return p.Name == partner }) {
+			return fmt.Errorf("%s has a quota but is not in --partners", partner)
+		}
+	}
+	return nil
+}
+
+// effective merges the global section, the section of the lot's tenant and the section of the lot, in that
+// order. Without a lot it returns the global settings.
+func (c config) effective(lot string) (effectiveConfig, error) {
+	l, ok := c.Lots[lot]
+	if lot != "" && !ok {
+		return effectiveConfig{}, fmt.Errorf("unknown lot %s", lot)
+	}
+	e := effectiveConfig{Lot: lot, Tenant: l.Tenant, Sources: make(map[string]string)}
+
+	type section struct {
+		source string
+		o      overrides
+	}
+	sections := []section{{"global", c.Global}}
+	if l.Tenant != "" {
+		sections = append(sections, section{"tenant " + l.Tenant, c.Tenants[l.Tenant]})
+	}
+	if lot != "" {
+		sections = append(sections, section{"lot " + lot, l.overrides})
+	}
+
+	for _, s := range sections {
+		if s.o.Tariff != nil {
+			e.Tariff, e.Sources["tariff"] = s.o.Tariff, s.source
+		}
+		if s.o.PlatePattern != nil {
+			e.PlatePattern, e.Sources["plate_pattern"] = s.o.PlatePattern, s.source
+		}
+		if s.o.GracePeriod != nil {
+			e.GracePeriod, e.Sources["grace_period"] = s.o.GracePeriod, s.source
+		}
+		if s.o.ReentryWindow != nil {
+			e.ReentryWindow, e.Sources["reentry_window"] = s.o.ReentryWindow, s.source
+		}
+		if s.o.Allotment != nil {
+			e.Allotment, e.Sources["allotment"] = s.o.Allotment, s.source
+		}
+		for partner, quota := range s.o.Quotas {
+			if e.Quotas == nil {
+				e.Quotas = make(map[string]int)
+			}
+			e.Quotas[partner], e.Sources["quotas."+partner] = quota, s.source
+		}
+	}
+	return e, nil
+}
+
+// configure applies the effective settings to a lot whose settings from the command-line flags are already set
+func (e effectiveConfig) configure(cp *parking.Carpark) error {
+	if e.Tariff != nil {
+		cp.Rates = *e.Tariff
+	}
+	if e.PlatePattern != nil {
+		cp.PlatePattern = nil
+		if *e.PlatePattern != "" {
+			cp.PlatePattern, _ = platePattern(*e.PlatePattern)
+		}
+	}
+	if e.GracePeriod != nil {
+		cp.GracePeriod = time.Duration(*e.GracePeriod)
+	}
+	if e.ReentryWindow != nil {
+		cp.ReentryWindow = time.Duration(*e.ReentryWindow)
+	}
+	if e.Allotment != nil {
+		cp.Aggregators.Allotment = *e.Allotment
+	}
+
+	partners := make([]string, 0, len(e.Quotas))
+	for partner := range e.Quotas {
+		partners = append(partners, partner)
+	}
+	sort.Strings(partners)
+	for _, partner := range partners {
+		i := 0
+		for i < len(cp.Aggregators.Partners) && cp.Aggregators.Partners[i].Name != partner {
+			i++
+		}
+		if i == len(cp.Aggregators.Partners) {
+			return fmt.Errorf("%s has a quota but is not in --partners", partner)
+		}
+		cp.Aggregators.Partners[i].Quota = e.Quotas[partner]
+	}
+	return nil
+}
+
+// platePattern compiles a plate pattern so that it matches whole registration numbers only
+func platePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("plate pattern: %w", err)
+	}
+	return re, nil
+}
+
+// configCommand runs config effective, which prints the merged settings of the lot given with --lot as JSON.
+// The quotas in the file are checked against the partners in partnersFile, if given.
+func configCommand(args []string, path, lot, partnersFile string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "effective" {
+		return errors.New("usage: config effective [--lot name]")
+	}
+	fs := flag.NewFlagSet("config effective", flag.ContinueOnError)
+	fs.StringVar(&lot, "lot", lot, "lot whose settings to show")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if path == "" {
+		return errors.New("config effective needs --config")
+	}
+
+	var aggregators parking.Aggregators
+	if partnersFile != "" {
+		var err error
+		if aggregators, err = parking.LoadAggregators(partnersFile); err != nil {
+			return err
+		}
+	}
+	c, err := loadConfig(path, aggregators.Partners)
+	if err != nil {
+		return err
+	}
+	e, err := c.effective(lot)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
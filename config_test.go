@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// writeConfig writes a configuration file to a temporary directory and returns its path
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lots.json")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPlatePatternPrecedence(t *testing.T) {
+	path := writeConfig(t, `{
+		"global": {"plate_pattern": "KA-[0-9]+"},
+		"tenants": {"acme": {"plate_pattern": "MH-[0-9]+"}},
+		"lots": {"downtown": {"tenant": "acme"}, "airport": {"tenant": "acme", "plate_pattern": ""}, "harbour": {}}
+	}`)
+	c, err := loadConfig(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		lot    string
+		accept string // The one of KA-01 and MH-01 the lot takes
+		any    bool   // Whether the lot takes any registration number
+	}{
+		{lot: "harbour", accept: "KA-01"},
+		{lot: "downtown", accept: "MH-01"},
+		{lot: "airport", any: true},
+	} {
+		e, err := c.effective(tt.lot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A pattern set before the file, such as by a flag, is replaced or cleared too
+		cp := &parking.Carpark{PlatePattern: regexp.MustCompile(`^XX$`)}
+		if err := e.configure(cp); err != nil {
+			t.Fatal(err)
+		}
+
+		if tt.any {
+			if cp.PlatePattern != nil {
+				t.Errorf("%s: plate pattern %v survived an empty pattern", tt.lot, cp.PlatePattern)
+			}
+			continue
+		}
+		for _, registration := range []string{"KA-01", "MH-01"} {
+			if got, want := cp.PlatePattern.MatchString(registration), registration == tt.accept; got != want {
+				t.Errorf("%s: pattern %v matches %s: %v, want %v", tt.lot, cp.PlatePattern, registration, got, want)
+			}
+		}
+	}
+}
+
+func TestQuotaForUnknownPartner(t *testing.T) {
+	path := writeConfig(t, `{"lots": {"downtown": {"quotas": {"parkhub": 2, "spotnow": 4}}}}`)
+
+	if _, err := loadConfig(path, []parking.Partner{{Name: "parkhub"}, {Name: "spotnow"}}); err != nil {
+		t.Errorf("quotas for known partners: %v", err)
+	}
+	_, err := loadConfig(path, []parking.Partner{{Name: "parkhub"}})
+	if err == nil || !strings.Contains(err.Error(), "spotnow") {
+		t.Errorf("quota for a partner not in --partners: got %v, want it refused", err)
+	}
+	if err := configCommand([]string{"effective", "--lot", "downtown"}, path, "", "", &strings.Builder{}); err == nil {
+		t.Error("config effective accepted quotas without --partners")
+	}
+}
+
+func TestGracePeriodPrecedence(t *testing.T) {
+	path := writeConfig(t, `{
+		"global": {"grace_period": "2m"},
+		"tenants": {"acme": {"grace_period": "5m"}},
+		"lots": {"downtown": {"tenant": "acme"}, "airport": {"tenant": "acme", "grace_period": "0s"}, "harbour": {}}
+	}`)
+	c, err := loadConfig(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for lot, want := range map[string]time.Duration{"harbour": 2 * time.Minute, "downtown": 5 * time.Minute, "airport": 0} {
+		e, err := c.effective(lot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The grace period from --grace-period is replaced
+		cp := &parking.Carpark{GracePeriod: time.Hour}
+		if err := e.configure(cp); err != nil {
+			t.Fatal(err)
+		}
+		if cp.GracePeriod != want {
+			t.Errorf("%s: grace period %v, want %v", lot, cp.GracePeriod, want)
+		}
+	}
+
+	for _, data := range []string{`{"global": {"grace_period": "-1m"}}`, `{"global": {"grace_period": 60}}`} {
+		if _, err := loadConfig(writeConfig(t, data), nil); err == nil {
+			t.Errorf("%s: accepted", data)
+		}
+	}
+}
+
+func TestReentryWindow(t *testing.T) {
+	path := writeConfig(t, `{
+		"global": {"reentry_window": "30m"},
+		"lots": {"downtown": {"reentry_window": "1h"}, "harbour": {}}
+	}`)
+	c, err := loadConfig(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for lot, want := range map[string]time.Duration{"harbour": 30 * time.Minute, "downtown": time.Hour} {
+		e, err := c.effective(lot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cp := &parking.Carpark{}
+		if err := e.configure(cp); err != nil {
+			t.Fatal(err)
+		}
+		if cp.ReentryWindow != want || cp.GracePeriod != 0 {
+			t.Errorf("%s: re-entry window %v and grace period %v, want %v and none", lot, cp.ReentryWindow, cp.GracePeriod, want)
+		}
+	}
+
+	if _, err := loadConfig(writeConfig(t, `{"lots": {"downtown": {"reentry_window": "-1h"}}}`), nil); err == nil {
+		t.Error("a negative re-entry window was accepted")
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+	"github.com/arjun759/car-parking/pgstore"
+	"github.com/arjun759/car-parking/server"
+	_ "github.com/lib/pq"
+)
+
+// lotStore is a parking.Store the shell can also create the lot in
+type lotStore interface {
+	parking.Store
+	// Capacity returns the number of slots, or zero before the lot is created
+	Capacity(ctx context.Context) (int, error)
+	// CreateParkingLot discards any existing state of the lot and creates n free slots
+	CreateParkingLot(ctx context.Context, n int) error
+}
+
+// openDatabase connects to the PostgreSQL database at DATABASE_URL and returns the named lot in it,
+// creating its table if needed
+func openDatabase(ctx context.Context, lot string) (*pgstore.Store, *sql.DB, error) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		return nil, nil, errors.New("--store postgres needs DATABASE_URL")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	st := pgstore.New(db, lot)
+	if err := st.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("migrating %s: %w", lot, err)
+	}
+	return st, db, nil
+}
+
+// runDatabase runs the shell or, given serve, the server against the named lot in the database at DATABASE_URL
+func runDatabase(lot string, addr string, slots int, format string) error {
+	if lot == "" {
+		lot = "main"
+	}
+	st, db, err := openDatabase(context.Background(), lot)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if flag.Arg(0) == "serve" {
+		return serveStore(addr, slots, st)
+	}
+
+	var in io.Reader = os.Stdin
+	interactive := true
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in, interactive = f, false
+	}
+	sh := &dbShell{shell: &shell{out: os.Stdout, json: format == "json", accessible: format == "accessible"}, st: st}
+	return sh.run(context.Background(), in, interactive)
+}
+
+// storedSlotJSON is the JSON form of a car parked in a lotStore, which does not record when it arrived
+type storedSlotJSON struct {
+	Slot         int    `json:"slot"`
+	Registration string `json:"registration"`
+	Color        string `json:"color"`
+}
+
+// dbShell runs the basic commands against a lot kept in a database, where the lot's other features
+// are not available
+type dbShell struct {
+	*shell
+	st lotStore
+}
+
+var dbCommands = map[string]command{
+	"create_parking_lot": {usage: "create_parking_lot <slots>", args: 1},
+	"park":               {usage: "park <registration> <colour>", args: 2, needsLot: true},
+	"leave":              {usage: "leave <slot>", args: 1, needsLot: true},
+	"registration_numbers_for_cars_with_colour": {usage: "registration_numbers_for_cars_with_colour <colour>", args: 1, needsLot: true},
+	"slot_numbers_for_cars_with_colour":         {usage: "slot_numbers_for_cars_with_colour <colour>", args: 1, needsLot: true},
+	"slot_number_for_registration_number":       {usage: "slot_number_for_registration_number <registration>", args: 1, needsLot: true},
+}
+
+// run executes commands line by line until the input ends or an exit command, prompting when interactive.
+// It stops at the first error from the database.
+func (s *dbShell) run(ctx context.Context, in io.Reader, interactive bool) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if interactive {
+			s.prompt()
+		}
+		if !scanner.Scan() {
+			break
+		}
+		ok, err := s.execute(ctx, scanner.Text())
+		if err != nil || !ok {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// execute runs one command line, returning false once the shell should stop
+func (s *dbShell) execute(ctx context.Context, line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true, nil
+	}
+
+	name, args := fields[0], fields[1:]
+	if name == "exit" {
+		return false, nil
+	}
+	c, ok := dbCommands[name]
+	if _, known := commands[name]; !ok && known {
+		s.fail(fmt.Sprintf("Not available with --store postgres: %s", name), fmt.Errorf("not available with --store postgres: %s", name))
+		return true, nil
+	}
+	if !ok {
+		s.fail(fmt.Sprintf("Unknown command: %s", name), fmt.Errorf("unknown command: %s", name))
+		return true, nil
+	}
+	if len(args) != c.args {
+		s.fail(fmt.Sprintf("Usage: %s", c.usage), fmt.Errorf("usage: %s", c.usage))
+		return true, nil
+	}
+	if c.needsLot {
+		n, err := s.st.Capacity(ctx)
+		if err != nil {
+			return false, err
+		}
+		if n == 0 {
+			s.fail("Sorry, parking lot is not created", errLotNotCreated)
+			return true, nil
+		}
+	}
+
+	switch name {
+	case "create_parking_lot":
+		return true, s.createParkingLot(ctx, args[0])
+	case "park":
+		return true, s.park(ctx, args[0], args[1])
+	case "leave":
+		return true, s.leave(ctx, args[0])
+	case "registration_numbers_for_cars_with_colour":
+		return true, s.registrationNumbersForColor(ctx, args[0])
+	case "slot_numbers_for_cars_with_colour":
+		return true, s.slotNumbersForColor(ctx, args[0])
+	default:
+		return true, s.slotNumberForRegistrationNumber(ctx, args[0])
+	}
+}
+
+// createParkingLot creates the lot in the database, discarding any cars parked in it, and confirms its size
+func (s *dbShell) createParkingLot(ctx context.Context, arg string) error {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		s.fail(fmt.Sprintf("Invalid number of slots: %s", arg), fmt.Errorf("invalid number of slots: %s", arg))
+		return nil
+	}
+	if err := s.st.CreateParkingLot(ctx, n); err != nil {
+		return err
+	}
+
+	if s.json {
+		s.writeJSON(struct {
+			Slots int `json:"slots"`
+		}{n})
+		return nil
+	}
+	fmt.Fprintf(s.out, "Created a parking lot with %d slots\n", n)
+	return nil
+}
+
+// park parks a car in the nearest free slot and prints the allocated slot number
+func (s *dbShell) park(ctx context.Context, registration string, color string) error {
+	slotNo, err := s.st.AllocateSlot(ctx, registration, color)
+	switch {
+	case errors.Is(err, parking.ErrAlreadyParked):
+		parked, _ := s.st.QueryByReg(ctx, registration)
+		s.fail(fmt.Sprintf("Sorry, %s is already parked in slot %d", registration, parked.Slot), err)
+		return nil
+	case errors.Is(err, parking.ErrLotFull):
+		s.fail("Sorry, parking lot is full", err)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if s.json {
+		s.writeJSON(storedSlotJSON{Slot: slotNo, Registration: registration, Color: color})
+		return nil
+	}
+	fmt.Fprintf(s.out, "Allocated slot number: %d\n", slotNo)
+	return nil
+}
+
+// leave frees up a slot and confirms it
+func (s *dbShell) leave(ctx context.Context, arg string) error {
+	slotNo, err := strconv.Atoi(arg)
+	if err != nil {
+		s.fail(fmt.Sprintf("Invalid slot number: %s", arg), fmt.Errorf("invalid slot number: %s", arg))
+		return nil
+	}
+
+	car, err := s.st.FreeSlot(ctx, slotNo)
+	if errors.Is(err, parking.ErrSlotNotFound) {
+		s.fail("Slot not found", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.json {
+		s.writeJSON(storedSlotJSON{Slot: slotNo, Registration: car.Registration, Color: car.Color})
+		return nil
+	}
+	fmt.Fprintf(s.out, "Slot number %d is free\n", slotNo)
+	return nil
+}
+
+// registrationNumbersForColor prints a comma separated list of registration numbers or "Not found"
+func (s *dbShell) registrationNumbersForColor(ctx context.Context, color string) error {
+	parked, err := s.st.QueryByColor(ctx, color)
+	if errors.Is(err, parking.ErrNotFound) {
+		s.fail("Not found", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	regNumbers := make([]string, 0, len(parked))
+	for _, p := range parked {
+		regNumbers = append(regNumbers, p.Registration)
+	}
+	switch {
+	case s.json:
+		s.writeJSON(regNumbers)
+	case s.accessible:
+		fmt.Fprintf(s.out, "Registration numbers: %s.\n", strings.Join(regNumbers, ", "))
+	default:
+		fmt.Fprintln(s.out, strings.Join(regNumbers, ", "))
+	}
+	return nil
+}
+
+// slotNumbersForColor prints a comma separated list of slot numbers or "Not found"
+func (s *dbShell) slotNumbersForColor(ctx context.Context, color string) error {
+	parked, err := s.st.QueryByColor(ctx, color)
+	if errors.Is(err, parking.ErrNotFound) {
+		s.fail("Not found", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	slotNos := make([]int, 0, len(parked))
+	slotNosStr := make([]string, 0, len(parked))
+	for _, p := range parked {
+		slotNos = append(slotNos, p.Slot)
+		slotNosStr = append(slotNosStr, strconv.Itoa(p.Slot))
+	}
+	switch {
+	case s.json:
+		s.writeJSON(slotNos)
+	case s.accessible:
+		fmt.Fprintf(s.out, "Slot numbers: %s.\n", strings.Join(slotNosStr, ", "))
+	default:
+		fmt.Fprintln(s.out, strings.Join(slotNosStr, ", "))
+	}
+	return nil
+}
+
+// slotNumberForRegistrationNumber prints a single slot number or "Not found"
+func (s *dbShell) slotNumberForRegistrationNumber(ctx context.Context, registration string) error {
+	parked, err := s.st.QueryByReg(ctx, registration)
+	if errors.Is(err, parking.ErrNotFound) {
+		s.fail("Not found", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case s.json:
+		s.writeJSON(storedSlotJSON{Slot: parked.Slot, Registration: parked.Registration, Color: parked.Color})
+	case s.accessible:
+		fmt.Fprintf(s.out, "Slot number: %d.\n", parked.Slot)
+	default:
+		fmt.Fprintln(s.out, parked.Slot)
+	}
+	return nil
+}
+
+// serveStore creates the lot in st with the given number of slots unless it already has some, and serves
+// the basic HTTP routes until the listener fails or the process is told to stop
+func serveStore(addr string, slots int, st lotStore) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	n, err := st.Capacity(ctx)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Another server sharing the database may have created the lot; only an empty one is created here
+		if slots < 1 {
+			return errors.New("serve needs --slots to create the parking lot")
+		}
+		if err := st.CreateParkingLot(ctx, slots); err != nil {
+			return err
+		}
+		n = slots
+	}
+	log.Printf("Serving a parking lot with %d slots kept in PostgreSQL on %s", n, addr)
+
+	srv := &http.Server{Addr: addr, Handler: server.NewStore(st)}
+	failed := make(chan error, 1)
+	go func() { failed <- srv.ListenAndServe() }()
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Print("Shutting down")
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/arjun759/car-parking/parking"
+	"github.com/arjun759/car-parking/server"
+)
+
+// memStore is a lotStore kept in memory, standing in for the database
+type memStore struct {
+	mu    sync.Mutex
+	slots []*parking.Car // Car in each slot from slot 1, nil if free
+}
+
+func (m *memStore) Capacity(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.slots), nil
+}
+
+func (m *memStore) CreateParkingLot(ctx context.Context, n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slots = make([]*parking.Car, n)
+	return nil
+}
+
+func (m *memStore) AllocateSlot(ctx context.Context, registration string, color string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	free := -1
+	for i, car := range m.slots {
+		if car != nil && car.Registration == registration {
+			return 0, parking.ErrAlreadyParked
+		}
+		if car == nil && free < 0 {
+			free = i
+		}
+	}
+	if free < 0 {
+		return 0, parking.ErrLotFull
+	}
+	m.slots[free] = &parking.Car{Registration: registration, Color: color}
+	return free + 1, nil
+}
+
+func (m *memStore) FreeSlot(ctx context.Context, slotNo int) (*parking.Car, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slotNo < 1 || slotNo > len(m.slots) || m.slots[slotNo-1] == nil {
+		return nil, parking.ErrSlotNotFound
+	}
+	car := m.slots[slotNo-1]
+	m.slots[slotNo-1] = nil
+	return car, nil
+}
+
+func (m *memStore) QueryByColor(ctx context.Context, color string) ([]parking.ParkedCar, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var parked []parking.ParkedCar
+	for i, car := range m.slots {
+		if car != nil && car.Color == color {
+			parked = append(parked, parking.ParkedCar{Slot: i + 1, Car: *car})
+		}
+	}
+	if len(parked) == 0 {
+		return nil, parking.ErrNotFound
+	}
+	sort.Slice(parked, func(i, j int) bool { return parked[i].Slot < parked[j].Slot })
+	return parked, nil
+}
+
+func (m *memStore) QueryByReg(ctx context.Context, registration string) (parking.ParkedCar, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, car := range m.slots {
+		if car != nil && car.Registration == registration {
+			return parking.ParkedCar{Slot: i + 1, Car: *car}, nil
+		}
+	}
+	return parking.ParkedCar{}, parking.ErrNotFound
+}
+
+func TestDatabaseShell(t *testing.T) {
+	input := `park KA-01 White
+create_parking_lot 2
+park KA-01 White
+park KA-01 Black
+park KA-02 Red
+park KA-03 White
+registration_numbers_for_cars_with_colour White
+slot_numbers_for_cars_with_colour Red
+slot_number_for_registration_number KA-02
+leave 1
+leave 1
+slot_number_for_registration_number KA-01
+status
+exit
+park KA-04 Blue
+`
+	want := `Sorry, parking lot is not created
+Created a parking lot with 2 slots
+Allocated slot number: 1
+Sorry, KA-01 is already parked in slot 1
+Allocated slot number: 2
+Sorry, parking lot is full
+KA-01
+2
+2
+Slot number 1 is free
+Slot not found
+Not found
+Not available with --store postgres: status
+`
+	var out strings.Builder
+	sh := &dbShell{shell: &shell{out: &out}, st: &memStore{}}
+	if err := sh.run(context.Background(), strings.NewReader(input), false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestStoreServer(t *testing.T) {
+	st := &memStore{}
+	st.CreateParkingLot(context.Background(), 2)
+	srv := httptest.NewServer(server.NewStore(st))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/slots/park", `{"registration": "KA-01", "color": "White"}`, http.StatusCreated},
+		{"POST", "/slots/park", `{"registration": "KA-01", "color": "White"}`, http.StatusConflict},
+		{"POST", "/slots/park", `{"registration": "KA-02", "color": "Red", "gate": "north"}`, http.StatusBadRequest},
+		{"GET", "/cars/KA-01", "", http.StatusOK},
+		{"GET", "/cars?color=White", "", http.StatusOK},
+		{"GET", "/cars", "", http.StatusBadRequest},
+		{"DELETE", "/slots/1", "", http.StatusOK},
+		{"DELETE", "/slots/1", "", http.StatusNotFound},
+		{"GET", "/cars/KA-01", "", http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s %s: got status %d, want %d", tt.method, tt.path, tt.body, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// eventLog appends every event the lot emits to a file, one JSON document per line
+type eventLog struct {
+	path string
+
+	mu  sync.Mutex
+	f   *os.File
+	err error // First error writing the log, reported after the change that caused it
+}
+
+// openEventLog opens or creates the event log at path and returns it with the events it already holds.
+// An event cut short by a crash is discarded.
+func openEventLog(path string) (*eventLog, []parking.Event, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events, end, err := readEvents(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return &eventLog{path: path, f: f}, events, nil
+}
+
+// readEvents decodes the complete events in r and returns them with the offset just past the last one
+func readEvents(r io.Reader) ([]parking.Event, int64, error) {
+	var events []parking.Event
+	var end int64
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return events, end, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		e, err := parking.UnmarshalEvent(line)
+		if err != nil {
+			return nil, 0, fmt.Errorf("malformed event at offset %d: %w", end, err)
+		}
+		events = append(events, e)
+		end += int64(len(line))
+	}
+}
+
+// record appends an event and syncs it to disk; it is subscribed to the lot
+func (l *eventLog) record(e parking.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return
+	}
+	data, err := parking.MarshalEvent(e)
+	if err == nil {
+		_, err = l.f.Write(append(data, '\n'))
+	}
+	if err == nil {
+		err = l.f.Sync()
+	}
+	l.err = err
+}
+
+// failed returns the first error writing the log, nil if every event was written
+func (l *eventLog) failed() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// close closes the log file
+func (l *eventLog) close() error {
+	return l.f.Close()
+}
+
+// verifyEventLog checks that replaying the event log is idempotent and reports how many events it holds
+func (s *shell) verifyEventLog(args []string) {
+	if s.events == nil {
+		s.fail("No event log", errors.New("no event log"))
+		return
+	}
+
+	f, err := os.Open(s.events.path)
+	if err != nil {
+		s.fail(err.Error(), err)
+		return
+	}
+	defer f.Close()
+
+	events, _, err := readEvents(f)
+	if err == nil {
+		err = s.cp.VerifyReplay(events)
+	}
+	if err != nil {
+		s.fail(fmt.Sprintf("Event log failed verification: %v", err), err)
+		return
+	}
+
+	if s.json {
+		s.writeJSON(struct {
+			Events int `json:"events"`
+		}{len(events)})
+		return
+	}
+	fmt.Fprintf(s.out, "Event log verified: %d events\n", len(events))
+}
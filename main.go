@@ -1,191 +1,508 @@
 package main
 
 import (
-	"container/heap"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
-)
-
-// Car represents a car with its registration number and color
-type Car struct {
-	Registration string
-	Color        string
-}
-
-// Carpark represents the parking lot
-type Carpark struct {
-	Slots      map[int]*Car     // Map to store cars by slot number
-	EmptySlots IntHeap          // Min-heap for available slots
-	MaxSlots   int              // Maximum number of slots
-	NextSlot   int              // Next slot number to use if heap is empty
-	ColorMap   map[string][]int // Map to store slots by color
-	RegMap     map[string]int   // Map to store slot number by registration number
-}
-
-// IntHeap implements heap.Interface for a min-heap of integers
-type IntHeap []int
+	"sync"
+	"syscall"
+	"time"
 
-func (h IntHeap) Len() int           { return len(h) }
-func (h IntHeap) Less(i, j int) bool { return h[i] < h[j] }
-func (h IntHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+	"github.com/arjun759/car-parking/parking"
+	"github.com/arjun759/car-parking/server"
+	"github.com/arjun759/car-parking/stripepay"
+)
 
-func (h *IntHeap) Push(x interface{}) {
-	*h = append(*h, x.(int))
-}
+func main() {
+	format := flag.String("format", "text", "output format: text, json, or accessible for screen readers")
+	addr := flag.String("addr", ":8080", "listen address in serve mode")
+	slots := flag.Int("slots", 0, "number of slots to create in serve mode")
+	var floors []int
+	flag.Func("floors", "comma-separated numbers of slots on each floor, lowest first, in place of --slots in serve mode", func(v string) (err error) {
+		floors, err = parseFloors(v)
+		return err
+	})
+	stateFile := flag.String("state-file", "", "file to load the lot from at startup and save it to after each change")
+	walFile := flag.String("wal", "", "write-ahead log of the events since the state file was saved, applied at startup; the state file is then saved only on exit")
+	eventLogFile := flag.String("event-log", "", "file to append the lot's events to, replayed at startup")
+	storeKind := flag.String("store", "memory", "where the lot is kept: memory, or postgres in the database at DATABASE_URL with only the basic commands")
+	var rates parking.RateCard
+	flag.IntVar(&rates.FlatFee, "flat-fee", 0, "charge in cents covering the first --flat-hours of a stay")
+	flag.IntVar(&rates.FlatHours, "flat-hours", 0, "hours of a stay covered by --flat-fee")
+	flag.IntVar(&rates.HourlyRate, "hourly-rate", 0, "charge in cents for each hour after --flat-hours")
+	flag.IntVar(&rates.EnergyRate, "energy-rate", 0, "charge in cents for each kWh delivered by a slot's charger")
+	flag.Func("services", "paid extras offered for a stay as comma-separated name=price pairs in cents, such as car_wash=1500", func(v string) (err error) {
+		rates.Services, err = parseServices(v)
+		return err
+	})
+	tariffFile := flag.String("tariff", "", "JSON rate card with hourly rates by time of day and weekday, in place of the rate flags")
+	var pricer parking.OccupancyPricer
+	flag.Func("occupancy-pricing", "hourly rate changes by occupancy as full:percent pairs, such as 0:-10,50:0,80:25", func(v string) (err error) {
+		pricer, err = parsePriceSteps(v)
+		return err
+	})
+	currency := flag.String("currency", "usd", "currency of the amounts charged through Stripe when STRIPE_SECRET_KEY is set")
+	var compactSlots, largeSlots []int
+	flag.Func("compact-slots", "slots that only take motorcycles and compact cars, as comma-separated numbers and ranges such as 1-4,9", func(v string) (err error) {
+		compactSlots, err = parseSlotList(v)
+		return err
+	})
+	flag.Func("large-slots", "slots that take trucks, as comma-separated numbers and ranges such as 1-4,9", func(v string) (err error) {
+		largeSlots, err = parseSlotList(v)
+		return err
+	})
+	var evSlots []int
+	flag.Func("ev-slots", "slots with an EV charger, as comma-separated numbers and ranges such as 1-4,9", func(v string) (err error) {
+		evSlots, err = parseSlotList(v)
+		return err
+	})
+	var accessibleSlots []int
+	flag.Func("accessible-slots", "slots kept for vehicles with an accessibility permit, as comma-separated numbers and ranges such as 1-4,9", func(v string) (err error) {
+		accessibleSlots, err = parseSlotList(v)
+		return err
+	})
+	var reservedSlots map[int]string
+	flag.Func("reserved-slots", "slots reserved for registration numbers, as comma-separated slot=registration pairs such as 1=KA-01-HH-1234", func(v string) (err error) {
+		reservedSlots, err = parseReservedSlots(v)
+		return err
+	})
+	var cleaning parking.CleaningBlock
+	flag.Func("cleaning", "daily window in which a rotating set of slots is held for cleaning, as start/duration/slots such as 02:00/1h/3", func(v string) (err error) {
+		cleaning, err = parseCleaningBlock(v)
+		return err
+	})
+	gatesFile := flag.String("gates", "", "JSON entry gates with their distance to each slot, for park_at")
+	strategy := flag.String("strategy", "nearest", "how park picks a free slot: nearest to the entry, or rotate to the slot free the longest so wear is spread evenly")
+	gracePeriod := flag.Duration("grace-period", 0, "time a freed slot cools down before it can be allocated again, none by default")
+	reentryWindow := flag.Duration("reentry-window", 0, "time after a car leaves in which it is linked to that visit when it parks again, none by default")
+	restoreWindow := flag.Duration("restore-window", 0, "time after a car leaves in which restore can put it back in its slot, none by default")
+	entryPace := flag.Duration("entry-pace", time.Minute, "time each car queued at a gate is expected to take to enter, until cars have entered through it recently")
+	partnersFile := flag.String("partners", "", "JSON allotment of slots sold through booking aggregators, with their API keys and quotas")
+	configFile := flag.String("config", "", "JSON settings overriding the flags globally, for each tenant and for each lot")
+	lot := flag.String("lot", "", "lot whose settings from --config apply, and its name in the database with --store postgres (main by default)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command-file]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] serve\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] config effective [--lot name]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-func (h *IntHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	x := old[n-1]
-	*h = old[0 : n-1]
-	return x
-}
+	if flag.Arg(0) == "config" {
+		if err := configCommand(flag.Args()[1:], *configFile, *lot, *partnersFile, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+	if *format != "text" && *format != "json" && *format != "accessible" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *format)
+		os.Exit(2)
+	}
+	if *storeKind == "postgres" {
+		if *stateFile != "" || *walFile != "" || *eventLogFile != "" {
+			fmt.Fprintln(os.Stderr, "--store postgres cannot be used with --state-file, --wal or --event-log")
+			os.Exit(2)
+		}
+		if err := runDatabase(*lot, *addr, *slots, *format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	} else if *storeKind != "memory" {
+		fmt.Fprintf(os.Stderr, "unknown store %q\n", *storeKind)
+		os.Exit(2)
+	}
+	if *strategy != "nearest" && *strategy != "rotate" {
+		fmt.Fprintf(os.Stderr, "unknown allocation strategy %q\n", *strategy)
+		os.Exit(2)
+	}
+	if *walFile != "" && *eventLogFile != "" {
+		fmt.Fprintln(os.Stderr, "--wal and --event-log cannot be used together")
+		os.Exit(2)
+	}
+	if *tariffFile != "" {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "flat-fee" || f.Name == "flat-hours" || f.Name == "hourly-rate" || f.Name == "energy-rate" || f.Name == "services" {
+				fmt.Fprintf(os.Stderr, "--tariff and --%s cannot be used together\n", f.Name)
+				os.Exit(2)
+			}
+		})
 
-// CreateParkingLot initializes the parking lot with the given number of slots
-func (cp *Carpark) CreateParkingLot(n int) {
-	cp.Slots = make(map[int]*Car)
-	cp.EmptySlots = make(IntHeap, 0, n)
-	cp.ColorMap = make(map[string][]int)
-	cp.RegMap = make(map[string]int)
-	cp.MaxSlots = n
-	cp.NextSlot = 1
+		var err error
+		if rates, err = parking.LoadRateCard(*tariffFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 
-	for i := 1; i <= n; i++ {
-		heap.Push(&cp.EmptySlots, i)
+	cp := &parking.Carpark{Rates: rates}
+	if *strategy == "rotate" {
+		cp.Strategy = parking.LeastRecentlyUsed
+	}
+	if pricer != nil {
+		cp.Pricer = pricer
+	}
+	if key := os.Getenv("STRIPE_SECRET_KEY"); key != "" {
+		cp.Gateway = stripepay.New(key, *currency)
+	}
+	if len(compactSlots) > 0 || len(largeSlots) > 0 {
+		cp.SlotSizes = make(map[int]parking.SlotSize)
+		for _, slotNo := range compactSlots {
+			cp.SlotSizes[slotNo] = parking.SlotCompact
+		}
+		for _, slotNo := range largeSlots {
+			if cp.SlotSizes[slotNo] == parking.SlotCompact {
+				fmt.Fprintf(os.Stderr, "slot %d is in both --compact-slots and --large-slots\n", slotNo)
+				os.Exit(2)
+			}
+			cp.SlotSizes[slotNo] = parking.SlotLarge
+		}
+	}
+	if len(evSlots) > 0 {
+		cp.Chargers = make(map[int]bool)
+		for _, slotNo := range evSlots {
+			cp.Chargers[slotNo] = true
+		}
+	}
+	if len(accessibleSlots) > 0 {
+		cp.Accessible = make(map[int]bool)
+		for _, slotNo := range accessibleSlots {
+			cp.Accessible[slotNo] = true
+		}
+	}
+	for slotNo := range reservedSlots {
+		if cp.Accessible[slotNo] {
+			fmt.Fprintf(os.Stderr, "slot %d is in both --accessible-slots and --reserved-slots\n", slotNo)
+			os.Exit(2)
+		}
+	}
+	if len(reservedSlots) > 0 {
+		cp.Reserved = reservedSlots
+	}
+	if *gatesFile != "" {
+		var err error
+		if cp.Gates, err = parking.LoadGates(*gatesFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	cp.EntryPace = *entryPace
+	cp.CleaningBlock = cleaning
+	cp.GracePeriod = *gracePeriod
+	cp.ReentryWindow = *reentryWindow
+	cp.RestoreWindow = *restoreWindow
+	if *partnersFile != "" {
+		var err error
+		if cp.Aggregators, err = parking.LoadAggregators(*partnersFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *configFile != "" {
+		c, err := loadConfig(*configFile, cp.Aggregators.Partners)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		e, err := c.effective(*lot)
+		if err == nil {
+			err = e.configure(cp)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else if *lot != "" {
+		fmt.Fprintln(os.Stderr, "--lot needs --config")
+		os.Exit(2)
 	}
-	fmt.Printf("Created a parking lot with %d slots\n", n)
-}
 
-// Park parks a car in the parking lot
-func (cp *Carpark) Park(registration string, color string) {
-	var slotNo int
-
-	if cp.EmptySlots.Len() > 0 {
-		slotNo = heap.Pop(&cp.EmptySlots).(int)
-	} else if cp.NextSlot <= cp.MaxSlots {
-		slotNo = cp.NextSlot
-		cp.NextSlot++
-	} else {
-		fmt.Println("Sorry, parking lot is full")
-		return
+	st, err := openStore(cp, *stateFile, *walFile, *eventLogFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	defer st.close()
 
-	if _, exists := cp.Slots[slotNo]; exists {
-		fmt.Println("Sorry, parking lot is full")
+	if flag.Arg(0) == "serve" {
+		operatorKeys := strings.FieldsFunc(os.Getenv("OPERATOR_API_KEYS"), func(r rune) bool { return r == ',' })
+		if err := serve(*addr, *slots, floors, cp, st, operatorKeys); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		return
 	}
 
-	cp.Slots[slotNo] = &Car{Registration: registration, Color: color}
-	cp.ColorMap[color] = append(cp.ColorMap[color], slotNo)
-	cp.RegMap[registration] = slotNo
+	var in io.Reader = os.Stdin
+	interactive := true
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in, interactive = f, false
+	}
 
-	fmt.Printf("Allocated slot number: %d\n", slotNo)
+	sh := &shell{cp: cp, out: os.Stdout, json: *format == "json", accessible: *format == "accessible", store: st}
+	if err := sh.run(in, interactive); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-// Leave frees up a slot
-func (cp *Carpark) Leave(slotNo int) {
-	if car, exists := cp.Slots[slotNo]; exists {
-		delete(cp.Slots, slotNo)
-		heap.Push(&cp.EmptySlots, slotNo)
+// serve creates the parking lot, with a floor for each of floors if given, unless one was restored from st, and
+// serves the HTTP API until the listener fails or the process is told to stop. Each change is committed to st,
+// which is saved on the way out. Refunds and evacuations need one of operatorKeys.
+func serve(addr string, slots int, floors []int, cp *parking.Carpark, st *store, operatorKeys []string) error {
+	switch {
+	case len(floors) > 0 && slots > 0:
+		return errors.New("--slots and --floors cannot be used together")
+	case cp.Capacity() > 0:
+		// A restarted server keeps the lot it had; --slots and --floors only size a new one
+		slots = cp.Capacity()
+	case len(floors) > 0:
+		cp.CreateFloors(floors...)
+		slots = cp.Capacity()
+	case slots < 1:
+		return errors.New("serve needs --slots or --floors to create the parking lot")
+	default:
+		cp.CreateParkingLot(slots)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		// Remove slot from ColorMap
-		cp.removeSlotFromColorMap(car.Color, slotNo)
+	// The background jobs change the lot too, so they commit their changes and are stopped before the final save
+	var jobs sync.WaitGroup
+	if len(cp.Aggregators.Partners) > 0 {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			reconcileNightly(ctx, cp, st)
+		}()
+	}
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		expireReservations(ctx, cp, st)
+	}()
 
-		// Remove registration from RegMap
-		delete(cp.RegMap, car.Registration)
+	if len(operatorKeys) == 0 {
+		log.Print("OPERATOR_API_KEYS is not set, so refunds and evacuations will be refused")
+	}
+	log.Printf("Serving a parking lot with %d slots on %s", slots, addr)
 
-		fmt.Printf("Slot number %d is free\n", slotNo)
-	} else {
-		fmt.Println("Slot not found")
+	srv := &http.Server{Addr: addr, Handler: committing(server.New(cp, operatorKeys...), st)}
+	failed := make(chan error, 1)
+	go func() { failed <- srv.ListenAndServe() }()
+	select {
+	case err := <-failed:
+		stop()
+		jobs.Wait()
+		return err
+	case <-ctx.Done():
 	}
+
+	log.Print("Shutting down")
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdown)
+	jobs.Wait()
+	// Nothing changes the lot any more, so no event is lost between the snapshot and emptying the log
+	return errors.Join(err, st.save())
 }
 
-// removeSlotFromColorMap helper function to remove a slot number from the color map
-func (cp *Carpark) removeSlotFromColorMap(color string, slotNo int) {
-	colorSlots := cp.ColorMap[color]
-	for i, s := range colorSlots {
-		if s == slotNo {
-			cp.ColorMap[color] = append(colorSlots[:i], colorSlots[i+1:]...)
-			if len(cp.ColorMap[color]) == 0 {
-				delete(cp.ColorMap, color)
-			}
+// committing commits the lot's changes to st after each request that may have made one, stopping the
+// server if they cannot be logged or saved
+func committing(h http.Handler, st *store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
 			return
 		}
-	}
+		if err := st.commit(); err != nil {
+			log.Fatal(err)
+		}
+	})
 }
 
-// Status prints the current status of the parking lot
-func (cp *Carpark) Status() {
-	fmt.Println("Slot No. Registration No Colour")
-	for i := 1; i <= cp.MaxSlots; i++ {
-		if car, ok := cp.Slots[i]; ok {
-			fmt.Printf("%d        %s   %s\n", i, car.Registration, car.Color)
+// parseFloors parses comma-separated numbers of slots, one for each floor
+func parseFloors(v string) ([]int, error) {
+	var floors []int
+	for _, s := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q is not a number of slots", s)
 		}
+		floors = append(floors, n)
 	}
+	return floors, nil
 }
 
-// RegistrationNumbersForColor returns registration numbers of all cars with a particular color
-func (cp *Carpark) RegistrationNumbersForColor(color string) {
-	slotNos, exists := cp.ColorMap[color]
-	if !exists || len(slotNos) == 0 {
-		fmt.Println("Not found")
-		return
+// parseSlotList parses comma-separated slot numbers and ranges of them, such as 1-4,9
+func parseSlotList(v string) ([]int, error) {
+	var slots []int
+	for _, item := range strings.Split(v, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		from, err := strconv.Atoi(first)
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(last)
+		}
+		if err != nil || from < 1 || to < from {
+			return nil, fmt.Errorf("%q is not a slot number or range", item)
+		}
+		for slotNo := from; slotNo <= to; slotNo++ {
+			slots = append(slots, slotNo)
+		}
 	}
+	return slots, nil
+}
 
-	regNumbers := make([]string, 0, len(slotNos))
-	for _, slotNo := range slotNos {
-		if car, exists := cp.Slots[slotNo]; exists {
-			regNumbers = append(regNumbers, car.Registration)
+// parseReservedSlots parses comma-separated slot=registration pairs, such as 1=KA-01-HH-1234, allowing each
+// slot and each registration number only once
+func parseReservedSlots(v string) (map[int]string, error) {
+	reserved := make(map[int]string)
+	owners := make(map[string]bool)
+	for _, pair := range strings.Split(v, ",") {
+		slot, registration, ok := strings.Cut(pair, "=")
+		if !ok || registration == "" {
+			return nil, fmt.Errorf("%q is not a slot=registration pair", pair)
+		}
+		slotNo, err := strconv.Atoi(slot)
+		if err != nil || slotNo < 1 {
+			return nil, fmt.Errorf("%q is not a slot number", slot)
+		}
+		if _, dup := reserved[slotNo]; dup {
+			return nil, fmt.Errorf("slot %d is reserved more than once", slotNo)
 		}
+		if owners[registration] {
+			return nil, fmt.Errorf("%s has more than one reserved slot", registration)
+		}
+		reserved[slotNo] = registration
+		owners[registration] = true
 	}
-
-	fmt.Println(strings.Join(regNumbers, ", "))
+	return reserved, nil
 }
 
-// SlotNumbersForColor returns slot numbers of all slots where a car of a particular color is parked
-func (cp *Carpark) SlotNumbersForColor(color string) {
-	slotNos, exists := cp.ColorMap[color]
-	if !exists || len(slotNos) == 0 {
-		fmt.Println("Not found")
-		return
+// parseServices parses comma-separated name=price pairs, such as car_wash=1500, allowing each name only once
+func parseServices(v string) ([]parking.Service, error) {
+	var services []parking.Service
+	names := make(map[string]bool)
+	for _, pair := range strings.Split(v, ",") {
+		name, price, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not a name=price pair", pair)
+		}
+		cents, err := strconv.Atoi(price)
+		if err != nil || cents < 0 {
+			return nil, fmt.Errorf("%q is not a price in cents", price)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("service %s is listed more than once", name)
+		}
+		names[name] = true
+		services = append(services, parking.Service{Name: name, Price: cents})
 	}
+	return services, nil
+}
 
-	slotNosStr := make([]string, 0, len(slotNos))
-	for _, slotNo := range slotNos {
-		slotNosStr = append(slotNosStr, fmt.Sprintf("%d", slotNo))
+// parsePriceSteps parses comma-separated full:percent pairs, such as 80:25 for 25% more from 80% full
+func parsePriceSteps(v string) (parking.OccupancyPricer, error) {
+	var steps parking.OccupancyPricer
+	for _, pair := range strings.Split(v, ",") {
+		full, percent, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q is not a full:percent pair", pair)
+		}
+		var step parking.PriceStep
+		var err error
+		if step.Full, err = strconv.Atoi(full); err != nil || step.Full < 0 || step.Full > 100 {
+			return nil, fmt.Errorf("%q is not a percentage of slots", full)
+		}
+		if step.Percent, err = strconv.Atoi(percent); err != nil || step.Percent < -100 {
+			return nil, fmt.Errorf("%q is not a percentage change", percent)
+		}
+		steps = append(steps, step)
 	}
-
-	fmt.Println(strings.Join(slotNosStr, ", "))
+	return steps, nil
 }
 
-// SlotNumberForRegistrationNumber returns the slot number for a car with a given registration number
-func (cp *Carpark) SlotNumberForRegistrationNumber(registration string) {
-	slotNo, exists := cp.RegMap[registration]
-	if !exists {
-		fmt.Println("Not found")
-		return
+// parseCleaningBlock parses a daily cleaning window as start/duration/slots, such as 02:00/1h/3 for three
+// slots held from 02:00 to 03:00
+func parseCleaningBlock(v string) (parking.CleaningBlock, error) {
+	parts := strings.Split(v, "/")
+	if len(parts) != 3 {
+		return parking.CleaningBlock{}, fmt.Errorf("%q is not a start/duration/slots window", v)
 	}
+	start, err := time.Parse("15:04", parts[0])
+	if err != nil {
+		return parking.CleaningBlock{}, fmt.Errorf("%q is not a time of day", parts[0])
+	}
+	duration, err := time.ParseDuration(parts[1])
+	if err != nil || duration <= 0 || duration >= 24*time.Hour {
+		return parking.CleaningBlock{}, fmt.Errorf("%q is not a duration of less than a day", parts[1])
+	}
+	slots, err := strconv.Atoi(parts[2])
+	if err != nil || slots < 1 {
+		return parking.CleaningBlock{}, fmt.Errorf("%q is not a number of slots", parts[2])
+	}
+	return parking.CleaningBlock{
+		Start:    time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		Duration: duration,
+		Slots:    slots,
+	}, nil
+}
 
-	fmt.Println(slotNo)
+// reconcileNightly marks bookings for days that have ended without the car arriving as no-shows, just after each
+// midnight, and commits them to st until ctx is done
+func reconcileNightly(ctx context.Context, cp *parking.Carpark, st *store) {
+	for {
+		now := time.Now()
+		y, m, d := now.Date()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(time.Date(y, m, d+1, 0, 0, 1, 0, now.Location()))):
+		}
+
+		if noShows := cp.ReconcileNoShows(); len(noShows) > 0 {
+			log.Printf("Marked %d booking(s) as no-shows", len(noShows))
+			if err := st.commit(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
 }
 
-func main() {
-	cp := &Carpark{}
-	cp.CreateParkingLot(10)
-
-	cp.Park("KA-01-HH-1234", "White")
-	cp.Park("KA-01-HH-9999", "White")
-	cp.Park("KA-01-BB-0001", "Black")
-	cp.Park("KA-01-HH-7777", "Red")
-	cp.Park("KA-01-HH-2701", "Blue")
-	cp.Park("KA-01-HH-3141", "Black")
-	cp.Leave(4)
-	cp.Status()
-	cp.Park("KA-01-P-333", "White")
-	cp.Park("DL-12-AA-9999", "White")
-
-	cp.RegistrationNumbersForColor("White")
-	cp.SlotNumbersForColor("White")
-	cp.SlotNumberForRegistrationNumber("KA-01-HH-3141")
-	cp.SlotNumberForRegistrationNumber("MH-04-AY-1111")
+// expireReservations marks reservations whose window has ended without the car arriving as expired, every minute,
+// and commits them to st until ctx is done
+func expireReservations(ctx context.Context, cp *parking.Carpark, st *store) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if expired := cp.ExpireReservations(); len(expired) > 0 {
+			log.Printf("Expired %d reservation(s)", len(expired))
+			if err := st.commit(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
 }
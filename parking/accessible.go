@@ -0,0 +1,47 @@
+package parking
+
+import "time"
+
+// regular reports whether a slot may be allocated to a vehicle without an accessibility permit or a reservation
+func (cp *Carpark) regular(slotNo int) bool {
+	_, reserved := cp.Reserved[slotNo]
+	_, held := cp.holds[slotNo]
+	return !cp.Accessible[slotNo] && !reserved && !held
+}
+
+// hasFreeSlot reports whether a slot other than a reserved one is free for a vehicle with or without a permit,
+// whether or not it fits
+func (cp *Carpark) hasFreeSlot(permit bool) bool {
+	if len(cp.Accessible) == 0 && len(cp.Reserved) == 0 && len(cp.holds) == 0 {
+		return cp.freeCount() > 0
+	}
+	for _, slotNo := range cp.freeSlots() {
+		if cp.regular(slotNo) || permit && cp.Accessible[slotNo] {
+			return true
+		}
+	}
+	return false
+}
+
+// allocatePermit picks the slot a vehicle with an accessibility permit is given next: the accessible slot
+// firstFree would pick among the accessible slots, or the slot allocate picks once none of them is free
+func (cp *Carpark) allocatePermit(now time.Time, vehicle VehicleType) (int, bool) {
+	cp.releaseHeldSlots(now)
+	if slotNo, ok := cp.firstFreeWhere(vehicle, func(slotNo int) bool { return cp.Accessible[slotNo] }); ok {
+		return slotNo, true
+	}
+	return cp.allocate(now, vehicle)
+}
+
+// ParkWithPermit parks a vehicle of the given type whose driver holds an accessibility permit and returns its
+// ticket. It takes a free accessible slot the vehicle fits, falling back to the other slots when none is free.
+func (cp *Carpark) ParkWithPermit(registration string, color string, vehicle VehicleType) (Ticket, error) {
+	if _, err := ParseVehicleType(string(vehicle)); err != nil {
+		return Ticket{}, err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	return cp.parkedTicket(cp.parkWith(registration, color, vehicle, true, cp.allocatePermit))
+}
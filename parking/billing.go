@@ -0,0 +1,162 @@
+package parking
+
+import (
+	"fmt"
+	"time"
+)
+
+// RateCard prices a stay: a flat fee covers the first hours and every further hour is charged at the hourly rate,
+// or at the rate of the first band matching it. Amounts are in the currency's minor unit, such as cents.
+type RateCard struct {
+	FlatFee    int    `json:"flat_fee"`
+	FlatHours  int    `json:"flat_hours"`            // Hours covered by the flat fee
+	HourlyRate int    `json:"hourly_rate"`           // Charge for each hour after the flat hours
+	Bands      []Band `json:"bands,omitempty"`       // Hourly rates by time of day and day of the week
+	EnergyRate int    `json:"energy_rate,omitempty"` // Charge for each kWh delivered by a slot's charger
+
+	Services []Service `json:"services,omitempty"` // Paid extras that can be added to a stay
+}
+
+// Bill is the charge for a car leaving the lot, itemized for a receipt
+type Bill struct {
+	Ticket       string        `json:"ticket"`
+	Slot         int           `json:"slot"`
+	Registration string        `json:"registration"`
+	ParkedAt     time.Time     `json:"parked_at"`
+	LeftAt       time.Time     `json:"left_at"`
+	Duration     time.Duration `json:"-"`
+	Minutes      int           `json:"minutes"` // Length of the stay in whole minutes
+	Hours        int           `json:"hours"`   // Hours charged, counting a started hour as a whole one
+	Lines        []BillLine    `json:"lines"`
+	Amount       int           `json:"amount"`               // In the currency's minor unit
+	PaymentID    string        `json:"payment_id,omitempty"` // Payment gateway's ID for the amount collected by PayAndExit
+	Suspended    bool          `json:"suspended,omitempty"`  // Whether the stay went uncharged because the lot was being evacuated
+}
+
+// BillLine is one charge on a bill: the flat fee, a run of hours charged at the same rate, the energy
+// drawn from a charger or a service added to the stay
+type BillLine struct {
+	Description string     `json:"description"`
+	From        *time.Time `json:"from,omitempty"` // Start of the first hour, nil for the flat fee, energy and services
+	Hours       int        `json:"hours"`
+	KWh         float64    `json:"kwh,omitempty"`     // Energy charged for, zero unless the line is for energy
+	Service     string     `json:"service,omitempty"` // Name of the service charged for, empty unless the line is for one
+	Rate        int        `json:"rate,omitempty"`    // Charge for each hour or kWh, zero for the flat fee and services
+	Amount      int        `json:"amount"`
+}
+
+// Charge returns the amount due for a stay starting at start and charged for the given number of hours
+func (rc RateCard) Charge(start time.Time, hours int) int {
+	return total(rc.itemize(start, hours, func(rate int) int { return rate }))
+}
+
+// itemize returns the charges for a stay, passing each hourly rate through adjust and grouping
+// consecutive hours charged at the same rate
+func (rc RateCard) itemize(start time.Time, hours int, adjust func(rate int) int) []BillLine {
+	var lines []BillLine
+	if rc.FlatFee != 0 || rc.FlatHours != 0 {
+		lines = append(lines, BillLine{Description: "Flat fee", Hours: min(hours, rc.FlatHours), Amount: rc.FlatFee})
+	}
+	for h := rc.FlatHours; h < hours; h++ {
+		from := start.Add(time.Duration(h) * time.Hour)
+		rate := adjust(rc.rateAt(from))
+		if n := len(lines); n > 0 && lines[n-1].Rate == rate && lines[n-1].From != nil {
+			lines[n-1].Hours++
+			lines[n-1].Amount += rate
+			continue
+		}
+		lines = append(lines, BillLine{Description: "Hourly rate", From: &from, Hours: 1, Rate: rate, Amount: rate})
+	}
+	return lines
+}
+
+// total returns the sum of the charges
+func total(lines []BillLine) int {
+	amount := 0
+	for _, l := range lines {
+		amount += l.Amount
+	}
+	return amount
+}
+
+// billableHours returns the number of hours charged for a stay, counting a started hour as a whole one
+func billableHours(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Hour - 1) / time.Hour)
+}
+
+// FormatAmount formats an amount in minor units with two decimal places, such as 12.50
+func FormatAmount(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// Exit frees the slot of the car with a given registration number and bills it for the time since it parked,
+// at hourly rates adjusted by the Pricer for how full the lot was as the car left
+func (cp *Carpark) Exit(registration string) (Bill, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return Bill{}, ErrNotFound
+	}
+
+	bill := cp.bill(slotNo, cp.now())
+	cp.leaveBilled(bill, "")
+	return bill, nil
+}
+
+// bill prices the stay of the car in a slot as if it left at now, adding the energy its charging sessions drew
+// and the services ordered for it. Nothing is charged during an evacuation.
+func (cp *Carpark) bill(slotNo int, now time.Time) Bill {
+	car := cp.Slots[slotNo]
+	stay := now.Sub(car.ParkedAt)
+	bill := Bill{
+		Ticket:       car.Ticket,
+		Slot:         slotNo,
+		Registration: car.Registration,
+		ParkedAt:     car.ParkedAt,
+		LeftAt:       now,
+		Duration:     stay,
+		Minutes:      int(stay / time.Minute),
+	}
+	if cp.evacuating() {
+		bill.Suspended = true
+		return bill
+	}
+
+	bill.Hours = billableHours(stay)
+	adjust := func(rate int) int { return rate }
+	if cp.Pricer != nil {
+		occupancy := cp.occupancy()
+		adjust = func(rate int) int { return cp.Pricer.Rate(rate, occupancy) }
+	}
+	bill.Lines = cp.Rates.itemize(car.ParkedAt, bill.Hours, adjust)
+	if energy, ok := cp.energyLine(car.Ticket); ok {
+		bill.Lines = append(bill.Lines, energy)
+	}
+	bill.Lines = append(bill.Lines, cp.serviceLines(car)...)
+	bill.Amount = total(bill.Lines)
+	return bill
+}
+
+// leaveBilled frees the slot of a billed car, recording the payment collected for it if any
+func (cp *Carpark) leaveBilled(bill Bill, paymentID string) {
+	car := cp.Slots[bill.Slot]
+	cp.emit(CarLeft{
+		Slot:         bill.Slot,
+		Registration: bill.Registration,
+		Color:        car.Color,
+		Billed:       !bill.Suspended,
+		Amount:       bill.Amount,
+		Commission:   cp.commission(car.Booking, bill.Amount),
+		PaymentID:    paymentID,
+		Time:         bill.LeftAt,
+	})
+}
@@ -0,0 +1,230 @@
+package parking
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Aggregators is the allotment of slots sold through third-party booking aggregators and the partners selling it
+type Aggregators struct {
+	Allotment int       `json:"allotment"` // Bookings all partners together may hold for one day
+	Partners  []Partner `json:"partners"`
+}
+
+// Partner is a booking aggregator allowed to sell slots in the lot
+type Partner struct {
+	Name       string `json:"name"`
+	Key        string `json:"key"`        // API key the partner authenticates with
+	Quota      int    `json:"quota"`      // Bookings the partner may hold for one day
+	Commission int    `json:"commission"` // Percentage of the amount billed for the stays it booked owed to the partner
+}
+
+// BookingStatus tells whether a booked car turned up
+type BookingStatus string
+
+const (
+	// BookingPending is a booking whose car has not arrived yet
+	BookingPending BookingStatus = "pending"
+	// BookingArrived is a booking whose car parked on the booked day
+	BookingArrived BookingStatus = "arrived"
+	// BookingNoShow is a booking whose day passed without the car arriving
+	BookingNoShow BookingStatus = "no_show"
+)
+
+// Booking is a slot sold by a partner for a car arriving on a given day
+type Booking struct {
+	ID           string        `json:"id"` // ULID, so bookings sort by when they were made
+	Partner      string        `json:"partner"`
+	Registration string        `json:"registration"`
+	Date         string        `json:"date"` // Day the car is due, as 2006-01-02
+	Status       BookingStatus `json:"status"`
+	Time         time.Time     `json:"time"` // When the booking was made
+}
+
+// PartnerCapacity is how many bookings a partner may still make for a day
+type PartnerCapacity struct {
+	Date      string `json:"date"`
+	Allotment int    `json:"allotment"`
+	Booked    int    `json:"booked"` // Bookings all partners hold for the day
+	Quota     int    `json:"quota"`
+	Used      int    `json:"used"`      // Bookings the partner holds for the day
+	Available int    `json:"available"` // Bookings the partner may still make for the day
+}
+
+// LoadAggregators reads the partner allotment, API keys and quotas from a JSON file
+func LoadAggregators(path string) (Aggregators, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Aggregators{}, err
+	}
+
+	var a Aggregators
+	if err := json.Unmarshal(data, &a); err != nil {
+		return Aggregators{}, fmt.Errorf("%s: %w", path, err)
+	}
+	names, keys := make(map[string]bool), make(map[string]bool)
+	for i, p := range a.Partners {
+		if p.Name == "" || p.Key == "" {
+			return Aggregators{}, fmt.Errorf("%s: partner %d needs a name and a key", path, i+1)
+		}
+		if names[p.Name] || keys[p.Key] {
+			return Aggregators{}, fmt.Errorf("%s: partner %s has the same name or key as another", path, p.Name)
+		}
+		names[p.Name], keys[p.Key] = true, true
+	}
+	return a, nil
+}
+
+// PartnerForKey returns the partner with the given API key, reporting false if there is none
+func (cp *Carpark) PartnerForKey(key string) (Partner, bool) {
+	for _, p := range cp.Aggregators.Partners {
+		if key != "" && p.Key == key {
+			return p, true
+		}
+	}
+	return Partner{}, false
+}
+
+// partner returns the partner with the given name, reporting false if there is none
+func (cp *Carpark) partner(name string) (Partner, bool) {
+	for _, p := range cp.Aggregators.Partners {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Partner{}, false
+}
+
+// PartnerCapacity returns how many bookings a partner may still make for the day of date
+func (cp *Carpark) PartnerCapacity(partner string, date time.Time) (PartnerCapacity, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	p, ok := cp.partner(partner)
+	if !ok {
+		return PartnerCapacity{}, ErrNotFound
+	}
+	return cp.partnerCapacity(p, date.Format(time.DateOnly)), nil
+}
+
+// partnerCapacity counts the bookings held for a day against the allotment and the partner's quota
+func (cp *Carpark) partnerCapacity(p Partner, day string) PartnerCapacity {
+	c := PartnerCapacity{Date: day, Allotment: cp.Aggregators.Allotment, Quota: p.Quota}
+	for _, b := range cp.Bookings {
+		if b.Date != day || b.Status == BookingNoShow {
+			continue
+		}
+		c.Booked++
+		if b.Partner == p.Name {
+			c.Used++
+		}
+	}
+	c.Available = max(0, min(c.Allotment-c.Booked, c.Quota-c.Used))
+	return c
+}
+
+// Book accepts a partner's booking for a car arriving on the day of date and returns it.
+// Until the car arrives, one free slot that day is kept back from cars without a booking.
+func (cp *Carpark) Book(partner string, registration string, date time.Time) (Booking, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return Booking{}, ErrEvacuating
+	}
+
+	p, ok := cp.partner(partner)
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+
+	now := cp.now()
+	day := date.Format(time.DateOnly)
+	if day < now.Format(time.DateOnly) {
+		return Booking{}, ErrBookingDate
+	}
+
+	c := cp.partnerCapacity(p, day)
+	if c.Booked >= c.Allotment {
+		return Booking{}, ErrAllotmentFull
+	}
+	if c.Used >= c.Quota {
+		return Booking{}, ErrQuotaExceeded
+	}
+
+	id := newULID(now)
+	cp.emit(BookingMade{Booking: id, Partner: p.Name, Registration: registration, Date: day, Time: now})
+	return *cp.Bookings[id], nil
+}
+
+// PartnerBooking returns one of a partner's bookings by ID
+func (cp *Carpark) PartnerBooking(partner string, id string) (Booking, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	b, ok := cp.Bookings[id]
+	if !ok || b.Partner != partner {
+		return Booking{}, ErrNotFound
+	}
+	return *b, nil
+}
+
+// ReconcileNoShows marks pending bookings for days before today as no-shows, releasing their share of the
+// allotment, and returns them. It is meant to run nightly, and does nothing during an evacuation.
+func (cp *Carpark) ReconcileNoShows() []Booking {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return nil
+	}
+
+	now := cp.now()
+	today := now.Format(time.DateOnly)
+	var ids []string
+	for id, b := range cp.Bookings {
+		if b.Status == BookingPending && b.Date < today {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+
+	cp.emit(NoShowsReconciled{Bookings: ids, Time: now})
+
+	noShows := make([]Booking, 0, len(ids))
+	for _, id := range ids {
+		noShows = append(noShows, *cp.Bookings[id])
+	}
+	return noShows
+}
+
+// pendingArrival returns the ID of the pending booking for a car due on the day of now, if any
+func (cp *Carpark) pendingArrival(registration string, now time.Time) (string, bool) {
+	day := now.Format(time.DateOnly)
+	for id, b := range cp.Bookings {
+		if b.Status == BookingPending && b.Registration == registration && b.Date == day {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// keptForBookings reports whether the free slots must be kept for booked cars due on the day of now,
+// so a car without a booking cannot take one
+func (cp *Carpark) keptForBookings(registration string, now time.Time) bool {
+	day := now.Format(time.DateOnly)
+	pending := 0
+	for _, b := range cp.Bookings {
+		if b.Status == BookingPending && b.Date == day {
+			if b.Registration == registration {
+				return false
+			}
+			pending++
+		}
+	}
+	return pending > 0 && cp.freeCount() <= pending
+}
@@ -0,0 +1,532 @@
+// Package parking implements a parking lot that allocates the slot nearest
+// the entry to each arriving car and indexes parked cars by color and
+// registration number.
+package parking
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Car represents a car with its registration number and color
+type Car struct {
+	Registration string      `json:"registration"`
+	Color        string      `json:"color"`
+	PreviousExit time.Time   `json:"previous_exit"` // When the linked earlier visit ended, zero unless this is a re-entry
+	Notes        []Note      `json:"notes"`         // Attendant notes attached while the car is parked
+	Evidence     []string    `json:"evidence"`      // Photo references such as URLs or object-store keys
+	Ticket       string      `json:"ticket"`        // ID of the ticket issued on entry
+	ParkedAt     time.Time   `json:"parked_at"`     // When the car entered the lot
+	Booking      string      `json:"booking"`       // ID of the partner booking the car arrived on, if any
+	Vehicle      VehicleType `json:"vehicle"`       // Kind of vehicle, a car if empty
+	Permit       bool        `json:"permit"`        // Whether the vehicle was parked with an accessibility permit
+
+	Services []OrderedService `json:"services"` // Paid extras ordered for the stay, billed when it ends
+}
+
+// Note is a free-text remark an attendant attached to a parked car
+type Note struct {
+	Text     string    `json:"text"`
+	Incident bool      `json:"incident"` // Whether the note flags an incident such as observed damage or an alarm
+	Time     time.Time `json:"time"`
+}
+
+// Carpark represents the parking lot. Its methods are safe for concurrent use; the
+// configuration fields must be set before the lot is shared between goroutines and
+// the state fields must not be touched directly while it is.
+type Carpark struct {
+	mu sync.RWMutex
+
+	Slots      map[int]*Car                // Map to store cars by slot number
+	EmptySlots IntHeap                     // Min-heap for available slots under NearestFirst
+	MaxSlots   int                         // Maximum number of slots
+	SlotSizes  map[int]SlotSize            // Map to store the size of each slot that is not standard, fixed when the lot is created
+	Chargers   map[int]bool                // Map to store the slots with an EV charger, fixed when the lot is created
+	Accessible map[int]bool                // Map to store the slots kept for vehicles with an accessibility permit, fixed when the lot is created
+	Reserved   map[int]string              // Map to store the registration number each reserved slot is kept for, fixed when the lot is created
+	Floors     []Floor                     // Levels of the lot and their slots, empty for a single-floor lot
+	ColorMap   map[string]map[int]struct{} // Map to store the set of slots by color
+	RegMap     map[string]int              // Map to store slot number by registration number
+	Tickets    map[string]int              // Map to store slot number by ticket ID
+
+	GracePeriod time.Duration     // Cool-down before a freed slot can be allocated again
+	Cooling     map[int]time.Time // Map to store freed slots by the time they become available
+
+	ReentryWindow time.Duration        // Window in which a returning car is linked to its previous visit
+	RestoreWindow time.Duration        // Window in which a mistaken Leave can be undone with Restore
+	Departures    map[string]Departure // Map to store recent departures by registration number
+
+	Reconciliations []Reconciliation  // Slots force-freed by an operator, kept apart from normal departures
+	Payments        []Payment         // Stays billed by Exit, for revenue and commission reports
+	Mismatches      []Mismatch        // Vehicles reported as too big for the slot they were parked in
+	Charging        []ChargingSession // Sessions drawing energy from slot chargers, billed with the stay
+	Evacuation      *Evacuation       // Evacuation under way or the last one to end, nil if there has been none
+	Violations      []Violation       // Vehicles logged as parked outside the managed slots, oldest first
+	Queues          []QueueSample     // Queue lengths at the entry gates each time they changed, oldest first
+	SlotNotes       []SlotNote        // Notes about the slots themselves, oldest first
+
+	Assets map[int]map[string]string // Map to store the assets of each slot, such as a charger's serial number, by key
+
+	CleaningBlock  CleaningBlock     // Daily window in which a rotating set of slots is held for cleaning
+	Cleaning       map[int]time.Time // Map to store slots held for cleaning by the time they become available
+	CleaningDue    []int             // Slots skipped by earlier windows because they were occupied, tried first next time
+	CleaningCursor int               // Last slot the cleaning rotation reached
+	CleaningWindow time.Time         // When the last window whose slots were held opened
+
+	Aggregators Aggregators         // Slots sold through booking aggregators and the partners selling them
+	Bookings    map[string]*Booking // Map to store partner bookings by ID
+
+	Reservations map[string]*Reservation // Map to store advance reservations by ID
+
+	Clock    Clock             // Source of the current time, the system clock if nil
+	Rates    RateCard          // Prices charged by Exit
+	Pricer   Pricer            // Adjusts the hourly rates for demand, the rate card's rates apply as they are if nil
+	Gateway  PaymentGateway    // Collects the fees billed by PayAndExit
+	Barriers BarrierController // Opens the barriers for an evacuation, nil if they are not controlled by the lot
+
+	Strategy      AllocationStrategy // How Park picks a free slot, set before CreateParkingLot
+	PlatePattern  *regexp.Regexp     // Pattern the registration number of a parking or reserving car must match, any is accepted if nil
+	Gates         []Gate             // Entries ParkFromGate allocates the nearest slot to, set before CreateParkingLot
+	EntryPace     time.Duration      // Time a queued car is expected to take to enter when none has entered recently, a minute if zero
+	RotationQueue []int              // Queue of available slots, longest free first, under LeastRecentlyUsed
+	UsageCount    map[int]int        // Map to store how many times each slot has been allocated
+	VacantSince   map[int]time.Time  // Map to store when each empty slot was last vacated, or the lot created
+
+	Arrivals map[string]map[string]int // Map to store arrival counts by day and plate jurisdiction
+
+	LastEvent uint64 // ID of the last event applied to the state
+
+	gateHeaps     map[string]*gatePool // Map to store the free pool ordered by distance from each gate
+	reservedSlots map[string]int       // Map to store the reserved slot by registration number
+	holds         map[int]string       // Map to store the ID of the reservation holding each slot, while its window is open
+	colors        map[string]string    // Map to store the shared copy of each parked color
+	colorPeaks    map[string]int       // Map to store the largest size of each color's bucket since it was last rebuilt
+	refunding     map[string]int       // Map to store the amount of each payment being refunded through the Gateway, by payment ID
+	exiting       map[string]bool      // Map to store the tickets of the stays being paid for through the Gateway
+
+	subscribers []func(Event) // Callbacks registered with Subscribe
+}
+
+// AllocationStrategy selects which free slot Park hands out
+type AllocationStrategy int
+
+const (
+	// NearestFirst allocates the free slot nearest to the entry
+	NearestFirst AllocationStrategy = iota
+	// LeastRecentlyUsed rotates allocation to the slot that has been free the longest
+	LeastRecentlyUsed
+)
+
+// Departure records a car that recently left, for linking a re-entry or restoring a mistaken Leave
+type Departure struct {
+	Slot int       `json:"slot"`
+	Car  *Car      `json:"car"`
+	Time time.Time `json:"time"`
+}
+
+// Reconciliation records an operator force-freeing a slot whose car was no longer there
+type Reconciliation struct {
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Color        string    `json:"color"`
+	Reason       string    `json:"reason"`
+	Time         time.Time `json:"time"`
+}
+
+// SlotPolicy decides what ParkInSlot does when the requested slot is not free
+type SlotPolicy int
+
+const (
+	// RequireSlot refuses to park the car anywhere but the requested slot
+	RequireSlot SlotPolicy = iota
+	// FallbackToNearest parks the car in the nearest free slot instead
+	FallbackToNearest
+)
+
+// CreateParkingLot initializes the parking lot with the given number of slots, of the sizes in SlotSizes,
+// with the chargers in Chargers, keeping the slots in Accessible for permit holders and those in Reserved for
+// their registration numbers. Creating it again discards everything recorded about the earlier lot; end an
+// evacuation with EndEvacuation first, as the barriers are left as they are.
+func (cp *Carpark) CreateParkingLot(n int) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.emit(LotCreated{Slots: n, SlotSizes: cp.SlotSizes, Chargers: cp.Chargers, Accessible: cp.Accessible, Reserved: cp.Reserved, Time: cp.now()})
+}
+
+// Capacity returns the number of slots, or zero before CreateParkingLot
+func (cp *Carpark) Capacity() int {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.MaxSlots
+}
+
+// Park parks a car in the parking lot and returns the allocated slot number. It returns ErrAlreadyParked with
+// the car's slot if a car with the same registration number is already parked.
+func (cp *Carpark) Park(registration string, color string) (int, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.park(registration, color)
+}
+
+// park parks a car in the slot the allocation strategy picks
+func (cp *Carpark) park(registration string, color string) (int, error) {
+	return cp.parkWith(registration, color, VehicleCar, false, cp.allocate)
+}
+
+// alreadyParked returns ErrAlreadyParked with the slot of the car with a given registration number if it is
+// parked, and nil otherwise
+func (cp *Carpark) alreadyParked(registration string) (int, error) {
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return 0, nil
+	}
+	return slotNo, fmt.Errorf("%w in slot %d", ErrAlreadyParked, slotNo)
+}
+
+// validPlate reports whether a registration number matches the lot's PlatePattern, if it has one
+func (cp *Carpark) validPlate(registration string) bool {
+	return cp.PlatePattern == nil || cp.PlatePattern.MatchString(registration)
+}
+
+// parkWith parks a vehicle, with or without an accessibility permit, in the slot reserved for it if that is
+// free and otherwise in the slot picked by allocate
+func (cp *Carpark) parkWith(registration string, color string, vehicle VehicleType, permit bool,
+	allocate func(now time.Time, vehicle VehicleType) (int, bool)) (int, error) {
+	if cp.evacuating() {
+		return 0, ErrEvacuating
+	}
+	if !cp.validPlate(registration) {
+		return 0, ErrInvalidRegistration
+	}
+	if parked, err := cp.alreadyParked(registration); err != nil {
+		return parked, err
+	}
+	now := cp.now()
+	cp.startCleaning(now)
+	slotNo, ok := cp.ownSlot(registration, vehicle, now)
+	if !ok {
+		slotNo, ok = allocate(now, vehicle)
+	}
+	if !ok && cp.hasFreeSlot(permit) {
+		return 0, ErrNoFittingSlot
+	}
+	if !ok || cp.keptForBookings(registration, now) {
+		return 0, ErrLotFull
+	}
+
+	event := CarParked{Slot: slotNo, Registration: registration, Color: color, Permit: permit, Ticket: newULID(now), Time: now}
+	if vehicle != VehicleCar {
+		event.Vehicle = vehicle
+	}
+	cp.emit(event)
+	return slotNo, nil
+}
+
+// allocate picks the slot the allocation strategy hands out for a vehicle without a permit next, reporting false
+// when no free slot fits it. The free pool holds every slot that can be allocated, so the slot is the head of
+// the pool unless the lot has slots of other sizes than standard, accessible or reserved slots, the vehicle does not fit
+// a standard slot or the lot has floors under LeastRecentlyUsed; it is then the slot firstFree picks.
+// It is only taken when the CarParked event is applied.
+func (cp *Carpark) allocate(now time.Time, vehicle VehicleType) (int, bool) {
+	cp.releaseHeldSlots(now)
+	if len(cp.SlotSizes) > 0 || len(cp.Accessible) > 0 || len(cp.Reserved) > 0 || len(cp.holds) > 0 || !vehicle.fits(SlotStandard) ||
+		len(cp.Floors) > 1 && cp.Strategy == LeastRecentlyUsed {
+		return cp.firstFree(vehicle)
+	}
+	return cp.peekFree()
+}
+
+// ParkInSlot parks a car in the requested slot, applying the policy when that slot is not free, is compact or is
+// kept for permit holders or another car. It returns the slot the car was actually parked in, or ErrAlreadyParked
+// with the car's slot if it is already parked.
+func (cp *Carpark) ParkInSlot(registration string, color string, slotNo int, policy SlotPolicy) (int, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return 0, ErrEvacuating
+	}
+	if !cp.validPlate(registration) {
+		return 0, ErrInvalidRegistration
+	}
+	if parked, err := cp.alreadyParked(registration); err != nil {
+		return parked, err
+	}
+
+	now := cp.now()
+	cp.startCleaning(now)
+	cp.releaseHeldSlots(now)
+
+	if !cp.isFree(slotNo) || !VehicleCar.fits(cp.sizeOf(slotNo)) || !cp.regular(slotNo) && !cp.owns(registration, slotNo) {
+		if policy == FallbackToNearest {
+			return cp.park(registration, color)
+		}
+		return 0, ErrSlotUnavailable
+	}
+	if cp.keptForBookings(registration, now) {
+		return 0, ErrLotFull
+	}
+
+	cp.emit(CarParked{Slot: slotNo, Registration: registration, Color: color, Ticket: newULID(now), Time: now})
+	return slotNo, nil
+}
+
+// claim takes a slot about to be occupied out of the cooling set or the free pool
+func (cp *Carpark) claim(slotNo int) {
+	if _, cooling := cp.Cooling[slotNo]; cooling {
+		delete(cp.Cooling, slotNo)
+		return
+	}
+	cp.takeSlot(slotNo)
+}
+
+// parkCar records a newly arrived car in an allocated slot, linking it to a recent visit of the same car
+func (cp *Carpark) parkCar(slotNo int, registration string, color string, vehicle VehicleType, permit bool,
+	ticket string, now time.Time) {
+	car := &Car{Registration: registration, Color: color, Vehicle: vehicle, Permit: permit, Ticket: ticket, ParkedAt: now}
+	if departure, ok := cp.Departures[registration]; ok {
+		delete(cp.Departures, registration)
+		if now.Sub(departure.Time) <= cp.ReentryWindow {
+			car.PreviousExit = departure.Time
+		}
+	}
+
+	if id, ok := cp.pendingArrival(registration, now); ok {
+		cp.Bookings[id].Status = BookingArrived
+		car.Booking = id
+	}
+	if id, ok := cp.activeReservation(registration, now); ok {
+		cp.Reservations[id].Status = ReservationArrived
+		cp.Reservations[id].Ticket = ticket
+	}
+
+	cp.occupy(slotNo, car)
+	cp.recordArrival(registration, now)
+}
+
+// occupy records a car in an allocated slot and indexes it by color, registration and ticket
+func (cp *Carpark) occupy(slotNo int, car *Car) {
+	cp.index(slotNo, car)
+	cp.UsageCount[slotNo]++
+}
+
+// index adds a parked car to the color, registration and ticket indexes
+func (cp *Carpark) index(slotNo int, car *Car) {
+	car.Color = cp.internColor(car.Color)
+	car.Registration = strings.Clone(car.Registration)
+	cp.Slots[slotNo] = car
+	cp.indexColor(car.Color, slotNo)
+	cp.RegMap[car.Registration] = slotNo
+	if car.Ticket != "" {
+		cp.Tickets[car.Ticket] = slotNo
+	}
+}
+
+// recordArrival counts an arrival against the day's bucket for the plate's jurisdiction
+func (cp *Carpark) recordArrival(registration string, now time.Time) {
+	day := now.Format(time.DateOnly)
+	if cp.Arrivals[day] == nil {
+		cp.Arrivals[day] = make(map[string]int)
+	}
+	cp.Arrivals[day][Jurisdiction(registration)]++
+}
+
+// Leave frees up a slot and returns the car that was parked in it
+func (cp *Carpark) Leave(slotNo int) (*Car, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	car, err := cp.leave(slotNo, cp.now())
+	if err != nil {
+		return nil, err
+	}
+	left := *car
+	return &left, nil
+}
+
+// leave frees up a slot, holding it for the grace period and remembering the departure if configured
+func (cp *Carpark) leave(slotNo int, now time.Time) (*Car, error) {
+	car, exists := cp.Slots[slotNo]
+	if !exists {
+		return nil, ErrSlotNotFound
+	}
+
+	cp.emit(CarLeft{Slot: slotNo, Registration: car.Registration, Color: car.Color, Time: now})
+	return car, nil
+}
+
+// LeaveByRegistration frees the slot held by the car with the given registration number and returns the car and slot
+func (cp *Carpark) LeaveByRegistration(registration string) (ParkedCar, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return ParkedCar{}, ErrNotFound
+	}
+
+	car, err := cp.leave(slotNo, cp.now())
+	if err != nil {
+		return ParkedCar{}, err
+	}
+	return ParkedCar{Slot: slotNo, Car: *car}, nil
+}
+
+// ForceFree marks a slot free when it is recorded as occupied but the bay is physically empty.
+// Unlike Leave it skips the grace period and re-entry tracking and records a reconciliation instead.
+func (cp *Carpark) ForceFree(slotNo int, reason string) (Reconciliation, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	car, exists := cp.Slots[slotNo]
+	if !exists {
+		return Reconciliation{}, ErrSlotNotFound
+	}
+
+	cp.emit(CarLeft{
+		Slot:         slotNo,
+		Registration: car.Registration,
+		Color:        car.Color,
+		Forced:       true,
+		Reason:       reason,
+		Time:         cp.now(),
+	})
+
+	return cp.Reconciliations[len(cp.Reconciliations)-1], nil
+}
+
+// vacate removes a car from its slot and from the color and registration indexes
+func (cp *Carpark) vacate(slotNo int, car *Car) {
+	delete(cp.Slots, slotNo)
+
+	// Remove slot from ColorMap
+	cp.removeSlotFromColorMap(car.Color, slotNo)
+
+	// Remove registration from RegMap
+	delete(cp.RegMap, car.Registration)
+	delete(cp.Tickets, car.Ticket)
+}
+
+// recordDeparture remembers a car that left so it can be linked on re-entry or restored, dropping expired entries
+func (cp *Carpark) recordDeparture(slotNo int, car *Car, now time.Time) {
+	retention := cp.ReentryWindow
+	if cp.RestoreWindow > retention {
+		retention = cp.RestoreWindow
+	}
+	for reg, departure := range cp.Departures {
+		if now.Sub(departure.Time) > retention {
+			delete(cp.Departures, reg)
+		}
+	}
+	cp.Departures[car.Registration] = Departure{Slot: slotNo, Car: car, Time: now}
+}
+
+// Restore undoes a mistaken Leave within the restore window, putting the car back in its slot if that is still free.
+// It returns the slot the car was restored to.
+func (cp *Carpark) Restore(registration string) (int, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return 0, ErrEvacuating
+	}
+
+	now := cp.now()
+	departure, ok := cp.Departures[registration]
+	if !ok || now.Sub(departure.Time) > cp.RestoreWindow {
+		return 0, ErrNotFound
+	}
+
+	cp.startCleaning(now)
+	cp.releaseHeldSlots(now)
+
+	slotNo := departure.Slot
+	if _, cooling := cp.Cooling[slotNo]; !cooling && !cp.isFree(slotNo) {
+		allocate := cp.allocate
+		if departure.Car.Permit {
+			allocate = cp.allocatePermit
+		}
+		if slotNo, ok = allocate(now, departure.Car.Vehicle); !ok {
+			return 0, ErrLotFull
+		}
+	}
+
+	cp.emit(CarParked{Slot: slotNo, Registration: registration, Color: departure.Car.Color, Restored: true, Time: now})
+	return slotNo, nil
+}
+
+// releaseCooledSlots returns slots whose grace period has elapsed by now to the free pool, earliest freed first
+func (cp *Carpark) releaseCooledSlots(now time.Time) {
+	var released []int
+	for slotNo, until := range cp.Cooling {
+		if !now.Before(until) {
+			released = append(released, slotNo)
+		}
+	}
+	sort.Slice(released, func(i, j int) bool {
+		a, b := cp.Cooling[released[i]], cp.Cooling[released[j]]
+		if a.Equal(b) {
+			return released[i] < released[j]
+		}
+		return a.Before(b)
+	})
+
+	for _, slotNo := range released {
+		delete(cp.Cooling, slotNo)
+		cp.pushFree(slotNo)
+	}
+}
+
+// removeSlotFromColorMap helper function to remove a slot number from the color map
+func (cp *Carpark) removeSlotFromColorMap(color string, slotNo int) {
+	colorSlots, exists := cp.ColorMap[color]
+	if !exists {
+		return
+	}
+	delete(colorSlots, slotNo)
+	if len(colorSlots) == 0 {
+		delete(cp.ColorMap, color)
+		delete(cp.colorPeaks, color)
+		delete(cp.colors, color)
+		return
+	}
+	cp.shrinkColor(color)
+}
+
+// AddNote attaches a note, optionally flagged as an incident, to the car with the given registration number.
+// It returns the slot the car is parked in.
+func (cp *Carpark) AddNote(registration string, text string, incident bool) (int, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return 0, ErrEvacuating
+	}
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return 0, ErrNotFound
+	}
+
+	cp.emit(NoteAdded{Registration: registration, Text: text, Incident: incident, Time: cp.now()})
+	return slotNo, nil
+}
+
+// AttachEvidence records an external photo reference, such as an entry camera snapshot, against a parked car.
+// It returns the slot the car is parked in.
+func (cp *Carpark) AttachEvidence(registration string, ref string) (int, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return 0, ErrEvacuating
+	}
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return 0, ErrNotFound
+	}
+
+	cp.emit(EvidenceAttached{Registration: registration, Ref: ref, Time: cp.now()})
+	return slotNo, nil
+}
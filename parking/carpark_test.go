@@ -0,0 +1,203 @@
+package parking
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkInvariants fails the test unless every parked car is indexed once by registration number, every
+// slot is either occupied or free, and the lot's own integrity check finds nothing wrong
+func checkInvariants(t *testing.T, cp *Carpark) {
+	t.Helper()
+	for _, p := range cp.IntegrityStats().Problems {
+		t.Error(p)
+	}
+
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	seen := make(map[string]int)
+	for slotNo, car := range cp.Slots {
+		seen[car.Registration]++
+		if got, ok := cp.RegMap[car.Registration]; !ok || got != slotNo {
+			t.Errorf("RegMap[%s] = %d, %v; car is in slot %d", car.Registration, got, ok, slotNo)
+		}
+	}
+	for registration, n := range seen {
+		if n != 1 {
+			t.Errorf("%s is parked in %d slots", registration, n)
+		}
+	}
+	for registration, slotNo := range cp.RegMap {
+		if car, ok := cp.Slots[slotNo]; !ok || car.Registration != registration {
+			t.Errorf("RegMap[%s] = %d, which does not hold it", registration, slotNo)
+		}
+	}
+	if free, occupied := cp.freeCount(), len(cp.Slots); free+occupied != cp.MaxSlots {
+		t.Errorf("%d free + %d occupied slots, want %d", free, occupied, cp.MaxSlots)
+	}
+}
+
+// Run with go test -race
+func TestConcurrentParkLeave(t *testing.T) {
+	const workers, rounds, slots = 8, 200, 10
+
+	cp := &Carpark{}
+	cp.CreateParkingLot(slots)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				// Workers share registration numbers so that some of them race to park the same car
+				registration := fmt.Sprintf("KA-%02d", (w*rounds+i)%(slots*2))
+				slotNo, err := cp.Park(registration, []string{"White", "Black", "Red"}[i%3])
+				switch {
+				case errors.Is(err, ErrAlreadyParked), errors.Is(err, ErrLotFull):
+					continue
+				case err != nil:
+					t.Errorf("Park(%s): %v", registration, err)
+					return
+				}
+
+				cp.Status()
+				cp.StateDump()
+				if _, err := cp.StatusDetail(slotNo); err != nil && !errors.Is(err, ErrSlotNotFound) {
+					t.Errorf("StatusDetail(%d): %v", slotNo, err)
+				}
+				if i%3 != 0 {
+					// Another worker may already have freed the slot and parked in it
+					if _, err := cp.Leave(slotNo); err != nil && !errors.Is(err, ErrSlotNotFound) {
+						t.Errorf("Leave(%d): %v", slotNo, err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	checkInvariants(t, cp)
+}
+
+func TestConcurrentParkSameRegistration(t *testing.T) {
+	cp := &Carpark{}
+	cp.CreateParkingLot(10)
+
+	var wg sync.WaitGroup
+	parked := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slotNo, err := cp.Park("KA-01-HH-1234", "White")
+			if err == nil {
+				parked <- slotNo
+			} else if !errors.Is(err, ErrAlreadyParked) {
+				t.Errorf("Park: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(parked)
+
+	if n := len(parked); n != 1 {
+		t.Errorf("car was parked %d times, want once", n)
+	}
+	checkInvariants(t, cp)
+}
+
+func TestParkDuplicateRegistration(t *testing.T) {
+	tests := []struct {
+		name string
+		park func(cp *Carpark) (int, error)
+	}{
+		{"Park", func(cp *Carpark) (int, error) { return cp.Park("KA-02", "Black") }},
+		{"ParkInSlot", func(cp *Carpark) (int, error) { return cp.ParkInSlot("KA-02", "Black", 3, RequireSlot) }},
+		{"ParkInSlot falling back", func(cp *Carpark) (int, error) {
+			return cp.ParkInSlot("KA-02", "Black", 1, FallbackToNearest)
+		}},
+		{"ParkVehicle", func(cp *Carpark) (int, error) {
+			ticket, err := cp.ParkVehicle("KA-02", "Black", VehicleCompact)
+			return ticket.Slot, err
+		}},
+		{"ParkWithPermit", func(cp *Carpark) (int, error) {
+			ticket, err := cp.ParkWithPermit("KA-02", "Black", VehicleCar)
+			return ticket.Slot, err
+		}},
+		{"ParkWithTicket", func(cp *Carpark) (int, error) {
+			ticket, err := cp.ParkWithTicket("KA-02", "Black")
+			return ticket.Slot, err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := &Carpark{}
+			cp.CreateParkingLot(4)
+			for _, registration := range []string{"KA-01", "KA-02"} {
+				if _, err := cp.Park(registration, "White"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			regMap := maps.Clone(cp.RegMap)
+			colorMap := make(map[string]map[int]struct{})
+			for color, slots := range cp.ColorMap {
+				colorMap[color] = maps.Clone(slots)
+			}
+			ticket := cp.Slots[2].Ticket
+
+			slotNo, err := tt.park(cp)
+			if !errors.Is(err, ErrAlreadyParked) {
+				t.Fatalf("got %v, want ErrAlreadyParked", err)
+			}
+			if slotNo != 2 {
+				t.Errorf("got slot %d, want 2", slotNo)
+			}
+			if !reflect.DeepEqual(cp.RegMap, regMap) {
+				t.Errorf("RegMap changed to %v from %v", cp.RegMap, regMap)
+			}
+			if !reflect.DeepEqual(cp.ColorMap, colorMap) {
+				t.Errorf("ColorMap changed to %v from %v", cp.ColorMap, colorMap)
+			}
+			if car := cp.Slots[2]; car.Ticket != ticket || car.Color != "White" {
+				t.Errorf("slot 2 holds %+v, want the car parked first", car)
+			}
+			checkInvariants(t, cp)
+		})
+	}
+}
+
+func TestRestoreKeepsUsage(t *testing.T) {
+	cp := &Carpark{RestoreWindow: time.Hour}
+	cp.CreateParkingLot(3)
+	if _, err := cp.Park("KA-01", "White"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if slotNo, err := cp.Restore("KA-01"); err != nil || slotNo != 1 {
+		t.Fatalf("restored to slot %d, %v; want 1", slotNo, err)
+	}
+	if usage := cp.SlotUsage(); usage[1] != 1 {
+		t.Errorf("slot 1 allocated %d times, want 1 for the stay that was restored", usage[1])
+	}
+
+	// The next car to take the slot is a new stay and counts
+	if _, err := cp.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.Park("KA-02", "Red"); err != nil {
+		t.Fatal(err)
+	}
+	if usage := cp.SlotUsage(); usage[1] != 2 {
+		t.Errorf("slot 1 allocated %d times, want 2", usage[1])
+	}
+	checkInvariants(t, cp)
+}
@@ -0,0 +1,123 @@
+package parking
+
+import (
+	"math"
+	"time"
+)
+
+// ChargingSession is a vehicle drawing energy from the charger of its slot during a stay
+type ChargingSession struct {
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Ticket       string    `json:"ticket"` // ID of the ticket of the stay the session is billed to
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"` // Zero while the vehicle is charging
+	KWh          float64   `json:"kwh"` // Energy delivered, as metered by the charger when the session ended
+}
+
+// hasCharger reports whether a slot has an EV charger
+func (cp *Carpark) hasCharger(slotNo int) bool {
+	return cp.Chargers[slotNo]
+}
+
+// ParkCharging parks a vehicle of the given type in the smallest free slot with a charger it fits and returns
+// its ticket. It returns ErrNoFreeCharger when slots are free but none with a charger fits the vehicle.
+func (cp *Carpark) ParkCharging(registration string, color string, vehicle VehicleType) (Ticket, error) {
+	if _, err := ParseVehicleType(string(vehicle)); err != nil {
+		return Ticket{}, err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	slotNo, err := cp.parkWith(registration, color, vehicle, false, func(now time.Time, vehicle VehicleType) (int, bool) {
+		cp.releaseHeldSlots(now)
+		return cp.firstFreeWhere(vehicle, func(slotNo int) bool { return cp.hasCharger(slotNo) && cp.regular(slotNo) })
+	})
+	if err == ErrNoFittingSlot {
+		return Ticket{}, ErrNoFreeCharger
+	}
+	return cp.parkedTicket(slotNo, err)
+}
+
+// StartCharging starts a charging session for the parked vehicle with a given registration number.
+// It returns ErrNoCharger if its slot has no charger and ErrCharging if a session is already open.
+func (cp *Carpark) StartCharging(registration string) (ChargingSession, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return ChargingSession{}, ErrEvacuating
+	}
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return ChargingSession{}, ErrNotFound
+	}
+	if cp.exiting[cp.Slots[slotNo].Ticket] {
+		return ChargingSession{}, ErrExitInProgress
+	}
+	if !cp.hasCharger(slotNo) {
+		return ChargingSession{}, ErrNoCharger
+	}
+	if cp.openSession(cp.Slots[slotNo].Ticket) >= 0 {
+		return ChargingSession{}, ErrCharging
+	}
+
+	cp.emit(ChargingStarted{Slot: slotNo, Registration: registration, Time: cp.now()})
+	return cp.Charging[len(cp.Charging)-1], nil
+}
+
+// EndCharging ends the open charging session of the parked vehicle with a given registration number,
+// recording the energy the charger delivered. It returns ErrNotCharging if no session is open.
+func (cp *Carpark) EndCharging(registration string, kWh float64) (ChargingSession, error) {
+	if kWh < 0 || math.IsNaN(kWh) || math.IsInf(kWh, 0) {
+		return ChargingSession{}, ErrEnergy
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return ChargingSession{}, ErrEvacuating
+	}
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return ChargingSession{}, ErrNotFound
+	}
+	if cp.exiting[cp.Slots[slotNo].Ticket] {
+		return ChargingSession{}, ErrExitInProgress
+	}
+	i := cp.openSession(cp.Slots[slotNo].Ticket)
+	if i < 0 {
+		return ChargingSession{}, ErrNotCharging
+	}
+
+	cp.emit(ChargingEnded{Slot: slotNo, Registration: registration, KWh: kWh, Time: cp.now()})
+	return cp.Charging[i], nil
+}
+
+// openSession returns the index of the open charging session of a stay, or -1 if there is none
+func (cp *Carpark) openSession(ticket string) int {
+	for i := len(cp.Charging) - 1; i >= 0; i-- {
+		if s := cp.Charging[i]; s.Ticket == ticket && s.End.IsZero() {
+			return i
+		}
+	}
+	return -1
+}
+
+// energyLine returns the bill line charging the energy delivered during a stay, reporting false if the
+// stay drew none
+func (cp *Carpark) energyLine(ticket string) (BillLine, bool) {
+	kWh := 0.0
+	for _, s := range cp.Charging {
+		if s.Ticket == ticket {
+			kWh += s.KWh
+		}
+	}
+	if kWh == 0 {
+		return BillLine{}, false
+	}
+	rate := cp.Rates.EnergyRate
+	return BillLine{Description: "Energy", KWh: kWh, Rate: rate, Amount: int(math.Round(kWh * float64(rate)))}, true
+}
@@ -0,0 +1,136 @@
+package parking
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// CleaningBlock holds a rotating set of slots out of allocation in a daily window so a crew can clean them.
+// Each window takes the next slots in slot order after those cleaned last; a slot that is occupied when its
+// turn comes is skipped and tried first in the next window.
+type CleaningBlock struct {
+	Start    time.Duration // Time of day the window opens, such as 2 * time.Hour for 02:00
+	Duration time.Duration // How long the window lasts, less than a day; zero disables cleaning
+	Slots    int           // Number of slots held in each window
+}
+
+// CleaningHold is a slot held out of allocation for cleaning
+type CleaningHold struct {
+	Slot  int       `json:"slot"`
+	Until time.Time `json:"until"` // When the window closes and the slot returns to allocation
+}
+
+// window returns when the latest window opening at or before now opens and closes
+func (b CleaningBlock) window(now time.Time) (time.Time, time.Time) {
+	y, m, d := now.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).Add(b.Start)
+	if now.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start, start.Add(b.Duration)
+}
+
+// startCleaning holds the slots due for cleaning if now falls in a window whose slots have not been held yet
+func (cp *Carpark) startCleaning(now time.Time) {
+	b := cp.CleaningBlock
+	if b.Duration <= 0 || b.Slots <= 0 || cp.MaxSlots == 0 {
+		return
+	}
+	start, end := b.window(now)
+	if !now.Before(end) || !start.After(cp.CleaningWindow) {
+		return
+	}
+
+	cp.releaseHeldSlots(now)
+
+	var held, due []int
+	consider := func(slotNo int) {
+		if cp.isFree(slotNo) {
+			held = append(held, slotNo)
+		} else {
+			due = append(due, slotNo)
+		}
+	}
+
+	pending := cp.CleaningDue
+	for len(held) < b.Slots && len(pending) > 0 {
+		consider(pending[0])
+		pending = pending[1:]
+	}
+
+	cursor := cp.CleaningCursor
+	for range cp.MaxSlots {
+		if len(held) == b.Slots {
+			break
+		}
+		cursor = cursor%cp.MaxSlots + 1
+		if !slices.Contains(cp.CleaningDue, cursor) {
+			consider(cursor)
+		}
+	}
+
+	cp.emit(CleaningStarted{
+		Slots:  held,
+		Due:    append(pending, due...),
+		Cursor: cursor,
+		Window: start,
+		Until:  end,
+		Time:   now,
+	})
+}
+
+// releaseCleanedSlots returns slots whose cleaning window has closed by now to the free pool, lowest first
+func (cp *Carpark) releaseCleanedSlots(now time.Time) {
+	var released []int
+	for slotNo, until := range cp.Cleaning {
+		if !now.Before(until) {
+			released = append(released, slotNo)
+		}
+	}
+	sort.Ints(released)
+
+	for _, slotNo := range released {
+		delete(cp.Cleaning, slotNo)
+		cp.pushFree(slotNo)
+	}
+}
+
+// releaseHeldSlots returns slots whose grace period or cleaning window is over by now to the free pool,
+// and holds the slots of reservations whose window is open at now
+func (cp *Carpark) releaseHeldSlots(now time.Time) {
+	cp.releaseCooledSlots(now)
+	cp.releaseCleanedSlots(now)
+	cp.holdReservedSlots(now)
+}
+
+// CleaningHolds returns the slots held for cleaning whose window has not closed, lowest first
+func (cp *Carpark) CleaningHolds() []CleaningHold {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	now := cp.now()
+	holds := []CleaningHold{}
+	for slotNo, until := range cp.Cleaning {
+		if now.Before(until) {
+			holds = append(holds, CleaningHold{Slot: slotNo, Until: until})
+		}
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].Slot < holds[j].Slot })
+	return holds
+}
+
+// EndCleaning returns a slot held for cleaning to allocation before its window closes, such as when the crew
+// has finished with it, and returns the hold it ended
+func (cp *Carpark) EndCleaning(slotNo int) (CleaningHold, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	now := cp.now()
+	until, held := cp.Cleaning[slotNo]
+	if !held || !now.Before(until) {
+		return CleaningHold{}, ErrNotCleaning
+	}
+	cp.emit(CleaningEnded{Slot: slotNo, Time: now})
+	return CleaningHold{Slot: slotNo, Until: until}, nil
+}
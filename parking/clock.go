@@ -0,0 +1,21 @@
+package parking
+
+import "time"
+
+// Clock tells the lot the current time, so tests can control it
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock used when none is configured
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// now returns the current time from the configured clock
+func (cp *Carpark) now() time.Time {
+	if cp.Clock == nil {
+		return systemClock{}.Now()
+	}
+	return cp.Clock.Now()
+}
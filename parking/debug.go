@@ -0,0 +1,212 @@
+package parking
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+// IntegrityReport summarizes the lot and lists any disagreement between the slots and their indexes
+type IntegrityReport struct {
+	Slots         int      `json:"slots"`
+	Occupied      int      `json:"occupied"`
+	Free          int      `json:"free"`
+	Cooling       int      `json:"cooling"`
+	Cleaning      int      `json:"cleaning"`
+	Registrations int      `json:"registrations"`
+	Colors        int      `json:"colors"`
+	Problems      []string `json:"problems"`
+}
+
+// OK reports whether the integrity check found no problems
+func (r IntegrityReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// StateDump is a copy of the internal allocation structures, for debugging
+type StateDump struct {
+	FreeHeap      []int             `json:"free_heap"`
+	RotationQueue []int             `json:"rotation_queue"`
+	Cooling       map[int]time.Time `json:"cooling"`
+	Cleaning      map[int]time.Time `json:"cleaning"`
+	CleaningDue   []int             `json:"cleaning_due"`
+	ColorMap      map[string][]int  `json:"color_map"` // Slots of the cars of each color, in order
+	RegMap        map[string]int    `json:"reg_map"`
+}
+
+// StateDump returns a copy of the internal allocation structures for debugging
+func (cp *Carpark) StateDump() StateDump {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	colorMap := make(map[string][]int, len(cp.ColorMap))
+	for color := range cp.ColorMap {
+		colorMap[color] = cp.slotsForColor(color)
+	}
+	return StateDump{
+		FreeHeap:      slices.Clone(cp.EmptySlots),
+		RotationQueue: slices.Clone(cp.RotationQueue),
+		Cooling:       maps.Clone(cp.Cooling),
+		Cleaning:      maps.Clone(cp.Cleaning),
+		CleaningDue:   slices.Clone(cp.CleaningDue),
+		ColorMap:      colorMap,
+		RegMap:        maps.Clone(cp.RegMap),
+	}
+}
+
+// DumpState writes the internal allocation structures for debugging
+func (cp *Carpark) DumpState(w io.Writer) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	fmt.Fprintf(w, "Free heap: %v\n", []int(cp.EmptySlots))
+	fmt.Fprintf(w, "Rotation queue: %v\n", cp.RotationQueue)
+
+	cooling := make([]int, 0, len(cp.Cooling))
+	for slotNo := range cp.Cooling {
+		cooling = append(cooling, slotNo)
+	}
+	sort.Ints(cooling)
+	fmt.Fprintln(w, "Cooling:")
+	for _, slotNo := range cooling {
+		fmt.Fprintf(w, "  %d: until %s\n", slotNo, cp.Cooling[slotNo].Format(time.RFC3339))
+	}
+
+	cleaning := make([]int, 0, len(cp.Cleaning))
+	for slotNo := range cp.Cleaning {
+		cleaning = append(cleaning, slotNo)
+	}
+	sort.Ints(cleaning)
+	fmt.Fprintln(w, "Cleaning:")
+	for _, slotNo := range cleaning {
+		fmt.Fprintf(w, "  %d: until %s\n", slotNo, cp.Cleaning[slotNo].Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "Cleaning due: %v\n", cp.CleaningDue)
+
+	colors := make([]string, 0, len(cp.ColorMap))
+	for color := range cp.ColorMap {
+		colors = append(colors, color)
+	}
+	sort.Strings(colors)
+	fmt.Fprintln(w, "ColorMap:")
+	for _, color := range colors {
+		fmt.Fprintf(w, "  %s: %v\n", color, cp.slotsForColor(color))
+	}
+
+	registrations := make([]string, 0, len(cp.RegMap))
+	for registration := range cp.RegMap {
+		registrations = append(registrations, registration)
+	}
+	sort.Strings(registrations)
+	fmt.Fprintln(w, "RegMap:")
+	for _, registration := range registrations {
+		fmt.Fprintf(w, "  %s: %d\n", registration, cp.RegMap[registration])
+	}
+}
+
+// IntegrityStats checks the slots against the free pool and the color and registration indexes
+func (cp *Carpark) IntegrityStats() IntegrityReport {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	problems := make([]string, 0)
+
+	if cp.Strategy == LeastRecentlyUsed && cp.EmptySlots.Len() > 0 {
+		problems = append(problems, "free heap is not empty under LeastRecentlyUsed")
+	}
+	if cp.Strategy == NearestFirst && len(cp.RotationQueue) > 0 {
+		problems = append(problems, "rotation queue is not empty under NearestFirst")
+	}
+
+	free := cp.freeSlots()
+	inHeap := make(map[int]int)
+	for _, slotNo := range free {
+		inHeap[slotNo]++
+		if slotNo < 1 || slotNo > cp.MaxSlots {
+			problems = append(problems, fmt.Sprintf("free pool holds out-of-range slot %d", slotNo))
+		}
+	}
+
+	for i := 1; i <= cp.MaxSlots; i++ {
+		_, occupied := cp.Slots[i]
+		_, cooling := cp.Cooling[i]
+		_, cleaning := cp.Cleaning[i]
+		switch {
+		case inHeap[i] > 1:
+			problems = append(problems, fmt.Sprintf("slot %d is in the free pool %d times", i, inHeap[i]))
+		case occupied && inHeap[i] > 0:
+			problems = append(problems, fmt.Sprintf("slot %d is occupied but also in the free pool", i))
+		case cooling && (occupied || inHeap[i] > 0):
+			problems = append(problems, fmt.Sprintf("slot %d is cooling but also occupied or free", i))
+		case cleaning && (occupied || cooling || inHeap[i] > 0):
+			problems = append(problems, fmt.Sprintf("slot %d is held for cleaning but also occupied, cooling or free", i))
+		case !occupied && !cooling && !cleaning && inHeap[i] == 0:
+			problems = append(problems, fmt.Sprintf("slot %d is neither occupied nor free", i))
+		}
+		if _, vacant := cp.VacantSince[i]; vacant == occupied {
+			problems = append(problems, fmt.Sprintf("slot %d vacancy record disagrees with whether it is occupied", i))
+		}
+	}
+
+	gateFree := 0
+	for _, slotNo := range free {
+		if cp.gateSlot(slotNo) {
+			gateFree++
+		}
+	}
+	for name, pool := range cp.gateHeaps {
+		indexed := 0
+		for size, h := range pool.bySize {
+			indexed += h.Len()
+			for _, slotNo := range h.slots {
+				if inHeap[slotNo] == 0 || !cp.gateSlot(slotNo) || cp.sizeOf(slotNo) != size {
+					problems = append(problems, fmt.Sprintf("gate %s indexes slot %d which is not a free %s slot it may pick", name, slotNo, size))
+				}
+			}
+		}
+		if indexed != gateFree {
+			problems = append(problems, fmt.Sprintf("gate %s indexes %d free slots, the free pool holds %d it may pick", name, indexed, gateFree))
+		}
+	}
+
+	for slotNo, car := range cp.Slots {
+		if regSlot, ok := cp.RegMap[car.Registration]; !ok || regSlot != slotNo {
+			problems = append(problems, fmt.Sprintf("slot %d car %s is missing from RegMap", slotNo, car.Registration))
+		}
+	}
+	for registration, slotNo := range cp.RegMap {
+		if car, ok := cp.Slots[slotNo]; !ok || car.Registration != registration {
+			problems = append(problems, fmt.Sprintf("RegMap entry %s points at slot %d which does not hold it", registration, slotNo))
+		}
+	}
+	for id, slotNo := range cp.Tickets {
+		if car, ok := cp.Slots[slotNo]; !ok || car.Ticket != id {
+			problems = append(problems, fmt.Sprintf("ticket %s points at slot %d which does not hold it", id, slotNo))
+		}
+	}
+	for color, slotNos := range cp.ColorMap {
+		if len(slotNos) == 0 {
+			problems = append(problems, fmt.Sprintf("ColorMap holds an empty bucket for %s", color))
+		}
+		for slotNo := range slotNos {
+			if car, ok := cp.Slots[slotNo]; !ok || car.Color != color {
+				problems = append(problems, fmt.Sprintf("ColorMap entry %s points at slot %d which does not hold it", color, slotNo))
+			}
+		}
+	}
+	sort.Strings(problems)
+
+	return IntegrityReport{
+		Slots:         cp.MaxSlots,
+		Occupied:      len(cp.Slots),
+		Free:          len(free),
+		Cooling:       len(cp.Cooling),
+		Cleaning:      len(cp.Cleaning),
+		Registrations: len(cp.RegMap),
+		Colors:        len(cp.ColorMap),
+		Problems:      problems,
+	}
+}
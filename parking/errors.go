@@ -0,0 +1,76 @@
+package parking
+
+import "errors"
+
+var (
+	// ErrLotFull is returned when no slot is free for a new car
+	ErrLotFull = errors.New("parking lot is full")
+	// ErrInvalidRegistration is returned for a registration number that does not match the lot's PlatePattern
+	ErrInvalidRegistration = errors.New("registration number does not match the plate pattern")
+	// ErrAlreadyParked is returned when a car with the same registration number is already parked, wrapped with
+	// the slot it is parked in
+	ErrAlreadyParked = errors.New("car is already parked")
+	// ErrSlotNotFound is returned when the given slot holds no car
+	ErrSlotNotFound = errors.New("slot not found")
+	// ErrSlotUnavailable is returned when a requested slot is not free
+	ErrSlotUnavailable = errors.New("slot is not available")
+	// ErrNotFound is returned by lookups that match no parked or recently departed car
+	ErrNotFound = errors.New("not found")
+	// ErrEventGap is returned when replayed events skip over events the lot has not applied
+	ErrEventGap = errors.New("events are missing from the replay")
+	// ErrAllotmentFull is returned when partners already hold every booking in the day's allotment
+	ErrAllotmentFull = errors.New("partner allotment is fully booked")
+	// ErrQuotaExceeded is returned when a partner already holds as many bookings for the day as its quota allows
+	ErrQuotaExceeded = errors.New("partner quota exceeded")
+	// ErrReservationWindow is returned for a reservation that does not end after it starts or has already ended
+	ErrReservationWindow = errors.New("reservation must end after it starts and in the future")
+	// ErrFullyReserved is returned when every slot is reserved for part of the window of a new reservation
+	ErrFullyReserved = errors.New("no slot is free to reserve for that time")
+	// ErrAlreadyReserved is returned for a reservation overlapping a pending reservation for the same car
+	ErrAlreadyReserved = errors.New("car already has a reservation for part of that time")
+	// ErrBookingDate is returned for a booking for a day that has already passed
+	ErrBookingDate = errors.New("booking date has passed")
+	// ErrNoGateway is returned by payment operations when the lot has no PaymentGateway
+	ErrNoGateway = errors.New("no payment gateway is configured")
+	// ErrPaymentDeclined is returned by a PaymentGateway when the provider declines a charge
+	ErrPaymentDeclined = errors.New("payment declined")
+	// ErrRefundAmount is returned for a refund that is not positive or exceeds what is left of the payment
+	ErrRefundAmount = errors.New("refund amount is more than the payment or not positive")
+	// ErrRefundInProgress is returned for a refund of a payment while another refund of it is with the gateway
+	ErrRefundInProgress = errors.New("another refund of the payment is in progress")
+	// ErrExitInProgress is returned for paying for a stay, or adding to its bill, while its payment is with the gateway
+	ErrExitInProgress = errors.New("the stay is being paid for")
+	// ErrFloorNotFound is returned for a floor number the lot does not have
+	ErrFloorNotFound = errors.New("floor not found")
+	// ErrNoSlot is returned for a slot number the lot does not have
+	ErrNoSlot = errors.New("no such slot")
+	// ErrGateNotFound is returned for an entry gate the lot does not have
+	ErrGateNotFound = errors.New("gate not found")
+	// ErrQueueLength is returned for a negative number of cars queued at a gate
+	ErrQueueLength = errors.New("queue length must not be negative")
+	// ErrVehicleType is returned for a vehicle type other than motorcycle, compact, car or truck
+	ErrVehicleType = errors.New("unknown vehicle type")
+	// ErrNoMismatch is returned for a size mismatch report about a vehicle that fits its slot
+	ErrNoMismatch = errors.New("vehicle fits its slot")
+	// ErrNoFreeCharger is returned when slots are free but none with a charger fits the vehicle
+	ErrNoFreeCharger = errors.New("no free slot with a charger fits the vehicle")
+	// ErrNoCharger is returned for a charging session in a slot without a charger
+	ErrNoCharger = errors.New("slot has no charger")
+	// ErrCharging is returned for starting a charging session while one is already open
+	ErrCharging = errors.New("vehicle is already charging")
+	// ErrNotCharging is returned for ending a charging session when none is open
+	ErrNotCharging = errors.New("vehicle is not charging")
+	// ErrEnergy is returned for a charging session delivering a negative or non-finite amount of energy
+	ErrEnergy = errors.New("energy delivered must be a non-negative number")
+	// ErrUnknownService is returned for ordering a service the lot does not offer
+	ErrUnknownService = errors.New("unknown service")
+	// ErrEvacuating is returned for changes other than vehicles leaving while the lot is being evacuated,
+	// and for starting an evacuation that is already under way
+	ErrEvacuating = errors.New("parking lot is being evacuated")
+	// ErrNotEvacuating is returned for ending an evacuation when none is under way
+	ErrNotEvacuating = errors.New("parking lot is not being evacuated")
+	// ErrNotCleaning is returned for ending the cleaning of a slot that is not held for cleaning
+	ErrNotCleaning = errors.New("slot is not held for cleaning")
+	// ErrNoFittingSlot is returned when slots are free but none of them fits the vehicle
+	ErrNoFittingSlot = errors.New("no free slot fits the vehicle")
+)
@@ -0,0 +1,106 @@
+package parking
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BarrierController operates the entry and exit barriers of the lot. Implementations must be safe for
+// concurrent use.
+type BarrierController interface {
+	// OpenAll raises every barrier and keeps it raised
+	OpenAll(ctx context.Context) error
+	// Resume returns the barriers to normal operation
+	Resume(ctx context.Context) error
+}
+
+// Evacuation is an emergency evacuation of the lot and the vehicles left behind when it ended
+type Evacuation struct {
+	Start     time.Time   `json:"start"`
+	End       time.Time   `json:"end"`       // Zero while the evacuation is under way
+	Parked    int         `json:"parked"`    // Vehicles in the lot when the evacuation started
+	Left      int         `json:"left"`      // Vehicles that left during the evacuation
+	Remaining []ParkedCar `json:"remaining"` // Vehicles still in the lot when the evacuation ended, by slot
+}
+
+// evacuating reports whether an evacuation is under way
+func (cp *Carpark) evacuating() bool {
+	return cp.Evacuation != nil && cp.Evacuation.End.IsZero()
+}
+
+// Evacuating reports whether an evacuation is under way
+func (cp *Carpark) Evacuating() bool {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.evacuating()
+}
+
+// StartEvacuation puts the lot in evacuation mode and opens every barrier through the Barriers controller.
+// Until EndEvacuation, vehicles can only leave, without being charged, and other changes return ErrEvacuating.
+// The lot stays in evacuation mode if the barriers fail to open.
+func (cp *Carpark) StartEvacuation(ctx context.Context) error {
+	cp.mu.Lock()
+	if cp.evacuating() {
+		cp.mu.Unlock()
+		return ErrEvacuating
+	}
+	cp.emit(EvacuationStarted{Time: cp.now()})
+	cp.mu.Unlock()
+
+	if cp.Barriers == nil {
+		return nil
+	}
+	if err := cp.Barriers.OpenAll(ctx); err != nil {
+		return fmt.Errorf("opening barriers: %w", err)
+	}
+	return nil
+}
+
+// EndEvacuation takes the lot out of evacuation mode, returns the barriers to normal operation and returns
+// the report of the vehicles that remained. It returns ErrNotEvacuating if no evacuation is under way.
+func (cp *Carpark) EndEvacuation(ctx context.Context) (Evacuation, error) {
+	cp.mu.Lock()
+	if !cp.evacuating() {
+		cp.mu.Unlock()
+		return Evacuation{}, ErrNotEvacuating
+	}
+	cp.emit(EvacuationEnded{Time: cp.now()})
+	report := *cp.Evacuation
+	cp.mu.Unlock()
+
+	if cp.Barriers == nil {
+		return report, nil
+	}
+	if err := cp.Barriers.Resume(ctx); err != nil {
+		return report, fmt.Errorf("resuming barriers: %w", err)
+	}
+	return report, nil
+}
+
+// LastEvacuation returns the evacuation under way or the last one to end, with the vehicles remaining
+// in the lot so far if it is under way. It returns ErrNotFound if the lot has never been evacuated.
+func (cp *Carpark) LastEvacuation() (Evacuation, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	if cp.Evacuation == nil {
+		return Evacuation{}, ErrNotFound
+	}
+	report := *cp.Evacuation
+	if report.End.IsZero() {
+		report.Remaining = cp.parkedCars()
+	}
+	return report, nil
+}
+
+// parkedCars returns copies of the parked cars ordered by slot number
+func (cp *Carpark) parkedCars() []ParkedCar {
+	parked := make([]ParkedCar, 0, len(cp.Slots))
+	for i := 1; i <= cp.MaxSlots; i++ {
+		if car, ok := cp.Slots[i]; ok {
+			parked = append(parked, ParkedCar{Slot: i, Car: *car})
+		}
+	}
+	return parked
+}
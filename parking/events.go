@@ -0,0 +1,817 @@
+package parking
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is a change to the lot. Operations decide what happens, record it as an event and
+// apply the event to the state, so the same state can be rebuilt by applying the events again.
+// Events are numbered from 1 in the order they happen, so replaying one the lot has already
+// applied has no effect.
+type Event interface {
+	eventType() string
+	eventID() uint64
+	withID(id uint64) Event
+	apply(cp *Carpark)
+}
+
+// LotCreated is recorded when the lot is created or recreated, discarding all earlier state
+type LotCreated struct {
+	ID         uint64           `json:"id"`
+	Slots      int              `json:"slots"`
+	Floors     []Floor          `json:"floors,omitempty"`
+	SlotSizes  map[int]SlotSize `json:"slot_sizes,omitempty"` // Size of each slot that is not standard
+	Chargers   map[int]bool     `json:"chargers,omitempty"`   // Slots with an EV charger
+	Accessible map[int]bool     `json:"accessible,omitempty"` // Slots kept for vehicles with an accessibility permit
+	Reserved   map[int]string   `json:"reserved,omitempty"`   // Registration number each reserved slot is kept for
+	Time       time.Time        `json:"time"`
+}
+
+// CarParked is recorded when a car takes a slot, including a car put back by Restore
+type CarParked struct {
+	ID           uint64      `json:"id"`
+	Slot         int         `json:"slot"`
+	Registration string      `json:"registration"`
+	Color        string      `json:"color"`
+	Vehicle      VehicleType `json:"vehicle,omitempty"`  // Kind of vehicle, a car if empty
+	Permit       bool        `json:"permit,omitempty"`   // Whether the vehicle has an accessibility permit
+	Ticket       string      `json:"ticket,omitempty"`   // ID of the ticket issued, empty when the car is restored
+	Restored     bool        `json:"restored,omitempty"` // Whether the car was put back after a mistaken Leave
+	Time         time.Time   `json:"time"`
+}
+
+// CarLeft is recorded when a slot is freed, including by an operator with ForceFree
+type CarLeft struct {
+	ID           uint64    `json:"id"`
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Color        string    `json:"color"`
+	Forced       bool      `json:"forced,omitempty"` // Whether an operator freed the slot because the bay was empty
+	Reason       string    `json:"reason,omitempty"` // Why the slot was force-freed
+	Billed       bool      `json:"billed,omitempty"` // Whether Exit billed the stay
+	Amount       int       `json:"amount,omitempty"`
+	Commission   int       `json:"commission,omitempty"` // Amount owed to the partner that booked the stay
+	PaymentID    string    `json:"payment_id,omitempty"` // Payment gateway's ID for the amount collected
+	Time         time.Time `json:"time"`
+}
+
+// NoteAdded is recorded when an attendant attaches a note to a parked car
+type NoteAdded struct {
+	ID           uint64    `json:"id"`
+	Registration string    `json:"registration"`
+	Text         string    `json:"text"`
+	Incident     bool      `json:"incident,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// EvidenceAttached is recorded when a photo reference is attached to a parked car
+type EvidenceAttached struct {
+	ID           uint64    `json:"id"`
+	Registration string    `json:"registration"`
+	Ref          string    `json:"ref"`
+	Time         time.Time `json:"time"`
+}
+
+// ServiceAdded is recorded when a paid service is added to the stay of a parked car
+type ServiceAdded struct {
+	ID           uint64    `json:"id"`
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Service      string    `json:"service"`
+	Price        int       `json:"price"` // Price of the service when it was ordered
+	Time         time.Time `json:"time"`
+}
+
+// CleaningStarted is recorded when a cleaning window opens and its slots are held out of allocation
+type CleaningStarted struct {
+	ID     uint64    `json:"id"`
+	Slots  []int     `json:"slots"`  // Slots held until the window closes
+	Due    []int     `json:"due"`    // Slots still to be cleaned, tried first in the next window
+	Cursor int       `json:"cursor"` // Last slot the rotation reached
+	Window time.Time `json:"window"` // When the window opened
+	Until  time.Time `json:"until"`  // When the window closes
+	Time   time.Time `json:"time"`
+}
+
+// CleaningEnded is recorded when a slot held for cleaning is returned to allocation before its window closes
+type CleaningEnded struct {
+	ID   uint64    `json:"id"`
+	Slot int       `json:"slot"`
+	Time time.Time `json:"time"`
+}
+
+// BookingMade is recorded when a partner books a slot for a car arriving on a given day
+type BookingMade struct {
+	ID           uint64    `json:"id"`
+	Booking      string    `json:"booking"` // ID of the booking
+	Partner      string    `json:"partner"`
+	Registration string    `json:"registration"`
+	Date         string    `json:"date"`
+	Time         time.Time `json:"time"`
+}
+
+// ReservationMade is recorded when a slot is reserved in advance for a car over a window of time
+type ReservationMade struct {
+	ID           uint64    `json:"id"`
+	Reservation  string    `json:"reservation"` // ID of the reservation
+	Registration string    `json:"registration"`
+	Slot         int       `json:"slot"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Time         time.Time `json:"time"`
+}
+
+// ReservationsExpired is recorded when reservations whose window ended without the car arriving are expired
+type ReservationsExpired struct {
+	ID           uint64    `json:"id"`
+	Reservations []string  `json:"reservations"` // IDs of the reservations
+	Time         time.Time `json:"time"`
+}
+
+// NoShowsReconciled is recorded when bookings whose day passed without the car arriving are marked as no-shows
+type NoShowsReconciled struct {
+	ID       uint64    `json:"id"`
+	Bookings []string  `json:"bookings"` // IDs of the bookings
+	Time     time.Time `json:"time"`
+}
+
+// RefundIssued is recorded when part or all of a payment is refunded
+type RefundIssued struct {
+	ID        uint64    `json:"id"`
+	PaymentID string    `json:"payment_id"`
+	Amount    int       `json:"amount"`
+	Time      time.Time `json:"time"`
+}
+
+// SizeMismatchReported is recorded when a sensor or attendant finds a parked vehicle too big for its slot
+type SizeMismatchReported struct {
+	ID           uint64      `json:"id"`
+	Slot         int         `json:"slot"`
+	Registration string      `json:"registration"`
+	Vehicle      VehicleType `json:"vehicle"`          // Type the vehicle turned out to be
+	Source       string      `json:"source,omitempty"` // Sensor or attendant that reported it
+	Target       int         `json:"target,omitempty"` // Free slot suggested for moving the vehicle to, zero if none fits it
+	Time         time.Time   `json:"time"`
+}
+
+// ChargingStarted is recorded when a parked vehicle starts drawing energy from the charger of its slot
+type ChargingStarted struct {
+	ID           uint64    `json:"id"`
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Time         time.Time `json:"time"`
+}
+
+// ChargingEnded is recorded when a charging session ends, with the energy the charger delivered
+type ChargingEnded struct {
+	ID           uint64    `json:"id"`
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	KWh          float64   `json:"kwh"`
+	Time         time.Time `json:"time"`
+}
+
+// EvacuationStarted is recorded when the lot is put in evacuation mode
+type EvacuationStarted struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// EvacuationEnded is recorded when the lot is taken out of evacuation mode
+type EvacuationEnded struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// ViolationLogged is recorded when a vehicle is found parked outside the managed slots, or seen again there
+type ViolationLogged struct {
+	ID           uint64    `json:"id"`
+	Violation    string    `json:"violation"` // ID of the violation
+	Registration string    `json:"registration"`
+	Location     string    `json:"location"`
+	Time         time.Time `json:"time"`
+}
+
+// ViolationCleared is recorded when the vehicle of a violation has been moved or towed
+type ViolationCleared struct {
+	ID        uint64    `json:"id"`
+	Violation string    `json:"violation"` // ID of the violation
+	Time      time.Time `json:"time"`
+}
+
+// QueueChanged is recorded when the number of cars queued at an entry gate changes
+type QueueChanged struct {
+	ID      uint64    `json:"id"`
+	Gate    string    `json:"gate"`
+	Length  int       `json:"length"`
+	Entered bool      `json:"entered,omitempty"` // Whether a car entering through the gate shortened the queue
+	Time    time.Time `json:"time"`
+}
+
+// SlotNoteAdded is recorded when a note is attached to a slot itself
+type SlotNoteAdded struct {
+	ID        uint64    `json:"id"`
+	Note      string    `json:"note"` // ID of the note
+	Slot      int       `json:"slot"`
+	Text      string    `json:"text"`
+	Attention bool      `json:"attention,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// SlotNoteResolved is recorded when the maintenance a slot note asked for has been done
+type SlotNoteResolved struct {
+	ID   uint64    `json:"id"`
+	Note string    `json:"note"` // ID of the note
+	Time time.Time `json:"time"`
+}
+
+// SlotAssetSet is recorded when an asset of a slot is recorded, changed or removed
+type SlotAssetSet struct {
+	ID    uint64    `json:"id"`
+	Slot  int       `json:"slot"`
+	Key   string    `json:"key"`
+	Value string    `json:"value"` // Empty when the asset is removed
+	Time  time.Time `json:"time"`
+}
+
+func (LotCreated) eventType() string           { return "lot_created" }
+func (CarParked) eventType() string            { return "car_parked" }
+func (CarLeft) eventType() string              { return "car_left" }
+func (NoteAdded) eventType() string            { return "note_added" }
+func (EvidenceAttached) eventType() string     { return "evidence_attached" }
+func (ServiceAdded) eventType() string         { return "service_added" }
+func (CleaningStarted) eventType() string      { return "cleaning_started" }
+func (CleaningEnded) eventType() string        { return "cleaning_ended" }
+func (BookingMade) eventType() string          { return "booking_made" }
+func (NoShowsReconciled) eventType() string    { return "no_shows_reconciled" }
+func (ReservationMade) eventType() string      { return "reservation_made" }
+func (ReservationsExpired) eventType() string  { return "reservations_expired" }
+func (RefundIssued) eventType() string         { return "refund_issued" }
+func (SizeMismatchReported) eventType() string { return "size_mismatch_reported" }
+func (ChargingStarted) eventType() string      { return "charging_started" }
+func (ChargingEnded) eventType() string        { return "charging_ended" }
+func (EvacuationStarted) eventType() string    { return "evacuation_started" }
+func (EvacuationEnded) eventType() string      { return "evacuation_ended" }
+func (ViolationLogged) eventType() string      { return "violation_logged" }
+func (ViolationCleared) eventType() string     { return "violation_cleared" }
+func (QueueChanged) eventType() string         { return "queue_changed" }
+func (SlotNoteAdded) eventType() string        { return "slot_note_added" }
+func (SlotNoteResolved) eventType() string     { return "slot_note_resolved" }
+func (SlotAssetSet) eventType() string         { return "slot_asset_set" }
+
+func (e LotCreated) eventID() uint64           { return e.ID }
+func (e CarParked) eventID() uint64            { return e.ID }
+func (e CarLeft) eventID() uint64              { return e.ID }
+func (e NoteAdded) eventID() uint64            { return e.ID }
+func (e EvidenceAttached) eventID() uint64     { return e.ID }
+func (e ServiceAdded) eventID() uint64         { return e.ID }
+func (e CleaningStarted) eventID() uint64      { return e.ID }
+func (e CleaningEnded) eventID() uint64        { return e.ID }
+func (e BookingMade) eventID() uint64          { return e.ID }
+func (e NoShowsReconciled) eventID() uint64    { return e.ID }
+func (e ReservationMade) eventID() uint64      { return e.ID }
+func (e ReservationsExpired) eventID() uint64  { return e.ID }
+func (e RefundIssued) eventID() uint64         { return e.ID }
+func (e SizeMismatchReported) eventID() uint64 { return e.ID }
+func (e ChargingStarted) eventID() uint64      { return e.ID }
+func (e ChargingEnded) eventID() uint64        { return e.ID }
+func (e EvacuationStarted) eventID() uint64    { return e.ID }
+func (e EvacuationEnded) eventID() uint64      { return e.ID }
+func (e ViolationLogged) eventID() uint64      { return e.ID }
+func (e ViolationCleared) eventID() uint64     { return e.ID }
+func (e QueueChanged) eventID() uint64         { return e.ID }
+func (e SlotNoteAdded) eventID() uint64        { return e.ID }
+func (e SlotNoteResolved) eventID() uint64     { return e.ID }
+func (e SlotAssetSet) eventID() uint64         { return e.ID }
+
+func (e LotCreated) withID(id uint64) Event           { e.ID = id; return e }
+func (e CarParked) withID(id uint64) Event            { e.ID = id; return e }
+func (e CarLeft) withID(id uint64) Event              { e.ID = id; return e }
+func (e NoteAdded) withID(id uint64) Event            { e.ID = id; return e }
+func (e EvidenceAttached) withID(id uint64) Event     { e.ID = id; return e }
+func (e ServiceAdded) withID(id uint64) Event         { e.ID = id; return e }
+func (e CleaningStarted) withID(id uint64) Event      { e.ID = id; return e }
+func (e CleaningEnded) withID(id uint64) Event        { e.ID = id; return e }
+func (e BookingMade) withID(id uint64) Event          { e.ID = id; return e }
+func (e NoShowsReconciled) withID(id uint64) Event    { e.ID = id; return e }
+func (e ReservationMade) withID(id uint64) Event      { e.ID = id; return e }
+func (e ReservationsExpired) withID(id uint64) Event  { e.ID = id; return e }
+func (e RefundIssued) withID(id uint64) Event         { e.ID = id; return e }
+func (e SizeMismatchReported) withID(id uint64) Event { e.ID = id; return e }
+func (e ChargingStarted) withID(id uint64) Event      { e.ID = id; return e }
+func (e ChargingEnded) withID(id uint64) Event        { e.ID = id; return e }
+func (e EvacuationStarted) withID(id uint64) Event    { e.ID = id; return e }
+func (e EvacuationEnded) withID(id uint64) Event      { e.ID = id; return e }
+func (e ViolationLogged) withID(id uint64) Event      { e.ID = id; return e }
+func (e ViolationCleared) withID(id uint64) Event     { e.ID = id; return e }
+func (e QueueChanged) withID(id uint64) Event         { e.ID = id; return e }
+func (e SlotNoteAdded) withID(id uint64) Event        { e.ID = id; return e }
+func (e SlotNoteResolved) withID(id uint64) Event     { e.ID = id; return e }
+func (e SlotAssetSet) withID(id uint64) Event         { e.ID = id; return e }
+
+// apply resets the lot to the given number of free slots, discarding every car, booking, payment and other
+// record of the earlier lot, and any evacuation of it
+func (e LotCreated) apply(cp *Carpark) {
+	cp.Slots = make(map[int]*Car)
+	cp.EmptySlots = make(IntHeap, 0, e.Slots)
+	cp.RotationQueue = make([]int, 0, e.Slots)
+	cp.UsageCount = make(map[int]int)
+	cp.VacantSince = make(map[int]time.Time)
+	cp.Arrivals = make(map[string]map[string]int)
+	cp.ColorMap = make(map[string]map[int]struct{})
+	cp.colors = make(map[string]string)
+	cp.colorPeaks = make(map[string]int)
+	cp.RegMap = make(map[string]int)
+	cp.Tickets = make(map[string]int)
+	cp.Cooling = make(map[int]time.Time)
+	cp.Cleaning = make(map[int]time.Time)
+	cp.CleaningDue = nil
+	cp.CleaningCursor = 0
+	cp.CleaningWindow = time.Time{}
+	cp.Bookings = make(map[string]*Booking)
+	cp.Reservations = make(map[string]*Reservation)
+	cp.holds = nil
+	cp.Departures = make(map[string]Departure)
+	cp.Reconciliations = nil
+	cp.Payments = nil
+	cp.Mismatches = nil
+	cp.Charging = nil
+	cp.Evacuation = nil
+	cp.Violations = nil
+	cp.Queues = nil
+	cp.SlotNotes = nil
+	cp.Assets = nil
+	cp.MaxSlots = e.Slots
+	cp.Floors = e.Floors
+	cp.SlotSizes = e.SlotSizes
+	cp.Chargers = e.Chargers
+	cp.Accessible = e.Accessible
+	cp.Reserved = e.Reserved
+	cp.indexReservedSlots()
+	cp.buildGateHeaps()
+
+	for i := 1; i <= e.Slots; i++ {
+		cp.pushFree(i)
+		cp.VacantSince[i] = e.Time
+	}
+}
+
+// apply moves the car into its slot, bringing back the departed car when it is restored. A restored car
+// continues its stay, so its slot does not count as allocated again.
+func (e CarParked) apply(cp *Carpark) {
+	cp.releaseHeldSlots(e.Time)
+	cp.claim(e.Slot)
+	delete(cp.VacantSince, e.Slot)
+
+	if departure, ok := cp.Departures[e.Registration]; ok && e.Restored {
+		delete(cp.Departures, e.Registration)
+		cp.index(e.Slot, departure.Car)
+		return
+	}
+	cp.parkCar(e.Slot, e.Registration, e.Color, e.Vehicle, e.Permit, e.Ticket, e.Time)
+}
+
+// apply frees the slot, holding it for the grace period and remembering the departure unless it was force-freed,
+// records the payment for a billed stay and ends its open charging session without charging for it
+func (e CarLeft) apply(cp *Carpark) {
+	car, exists := cp.Slots[e.Slot]
+	if !exists {
+		return
+	}
+	if cp.evacuating() {
+		cp.Evacuation.Left++
+	}
+	if i := cp.openSession(car.Ticket); i >= 0 {
+		cp.Charging[i].End = e.Time
+	}
+	cp.vacate(e.Slot, car)
+	cp.VacantSince[e.Slot] = e.Time
+	if e.Billed {
+		cp.recordPayment(e, car)
+	}
+
+	if e.Forced {
+		cp.pushFree(e.Slot)
+		cp.Reconciliations = append(cp.Reconciliations, Reconciliation{
+			Slot:         e.Slot,
+			Registration: car.Registration,
+			Color:        car.Color,
+			Reason:       e.Reason,
+			Time:         e.Time,
+		})
+		return
+	}
+
+	if cp.GracePeriod > 0 {
+		cp.Cooling[e.Slot] = e.Time.Add(cp.GracePeriod)
+	} else {
+		cp.pushFree(e.Slot)
+	}
+	if cp.ReentryWindow > 0 || cp.RestoreWindow > 0 {
+		cp.recordDeparture(e.Slot, car, e.Time)
+	}
+}
+
+// apply takes the slots out of the free pool until the window closes and moves the rotation on
+func (e CleaningStarted) apply(cp *Carpark) {
+	cp.releaseHeldSlots(e.Time)
+	for _, slotNo := range e.Slots {
+		cp.takeSlot(slotNo)
+		cp.Cleaning[slotNo] = e.Until
+	}
+	cp.CleaningDue = e.Due
+	cp.CleaningCursor = e.Cursor
+	cp.CleaningWindow = e.Window
+}
+
+// apply returns the slot to the free pool if it is still held for cleaning
+func (e CleaningEnded) apply(cp *Carpark) {
+	if _, held := cp.Cleaning[e.Slot]; held {
+		delete(cp.Cleaning, e.Slot)
+		cp.pushFree(e.Slot)
+	}
+}
+
+// apply records the booking as pending until the car arrives
+func (e BookingMade) apply(cp *Carpark) {
+	cp.Bookings[e.Booking] = &Booking{
+		ID:           e.Booking,
+		Partner:      e.Partner,
+		Registration: e.Registration,
+		Date:         e.Date,
+		Status:       BookingPending,
+		Time:         e.Time,
+	}
+}
+
+// apply marks the bookings as no-shows
+func (e NoShowsReconciled) apply(cp *Carpark) {
+	for _, id := range e.Bookings {
+		if b, ok := cp.Bookings[id]; ok {
+			b.Status = BookingNoShow
+		}
+	}
+}
+
+// apply records the reservation as pending
+func (e ReservationMade) apply(cp *Carpark) {
+	cp.Reservations[e.Reservation] = &Reservation{
+		ID:           e.Reservation,
+		Registration: e.Registration,
+		Slot:         e.Slot,
+		From:         e.From,
+		To:           e.To,
+		Status:       ReservationPending,
+		Time:         e.Time,
+	}
+}
+
+// apply marks the reservations as expired
+func (e ReservationsExpired) apply(cp *Carpark) {
+	for _, id := range e.Reservations {
+		if r, ok := cp.Reservations[id]; ok {
+			r.Status = ReservationExpired
+		}
+	}
+}
+
+// apply adds the refund to the payment
+func (e RefundIssued) apply(cp *Carpark) {
+	for i := range cp.Payments {
+		if cp.Payments[i].PaymentID == e.PaymentID {
+			cp.Payments[i].Refunded += e.Amount
+			cp.Payments[i].Refunds++
+			return
+		}
+	}
+}
+
+// apply corrects the type recorded for the vehicle and keeps the report
+func (e SizeMismatchReported) apply(cp *Carpark) {
+	car, exists := cp.Slots[e.Slot]
+	if !exists {
+		return
+	}
+	car.Vehicle = e.Vehicle
+	cp.Mismatches = append(cp.Mismatches, Mismatch{
+		Slot:         e.Slot,
+		Registration: e.Registration,
+		Size:         cp.sizeOf(e.Slot),
+		Vehicle:      e.Vehicle,
+		Source:       e.Source,
+		Target:       e.Target,
+		Time:         e.Time,
+	})
+}
+
+// apply opens a session for the car's stay
+func (e ChargingStarted) apply(cp *Carpark) {
+	car, exists := cp.Slots[e.Slot]
+	if !exists {
+		return
+	}
+	cp.Charging = append(cp.Charging, ChargingSession{
+		Slot:         e.Slot,
+		Registration: e.Registration,
+		Ticket:       car.Ticket,
+		Start:        e.Time,
+	})
+}
+
+// apply closes the open session of the car's stay with the energy delivered
+func (e ChargingEnded) apply(cp *Carpark) {
+	car, exists := cp.Slots[e.Slot]
+	if !exists {
+		return
+	}
+	if i := cp.openSession(car.Ticket); i >= 0 {
+		cp.Charging[i].End = e.Time
+		cp.Charging[i].KWh = e.KWh
+	}
+}
+
+// apply starts an evacuation of the cars now parked
+func (e EvacuationStarted) apply(cp *Carpark) {
+	cp.Evacuation = &Evacuation{Start: e.Time, Parked: len(cp.Slots)}
+}
+
+// apply ends the evacuation, recording the cars that remained
+func (e EvacuationEnded) apply(cp *Carpark) {
+	if !cp.evacuating() {
+		return
+	}
+	cp.Evacuation.End = e.Time
+	cp.Evacuation.Remaining = cp.parkedCars()
+}
+
+// apply opens the violation, or moves it and marks the vehicle as seen again if it is open
+func (e ViolationLogged) apply(cp *Carpark) {
+	if i := cp.violation(e.Violation); i >= 0 {
+		cp.Violations[i].Location = e.Location
+		cp.Violations[i].LastSeen = e.Time
+		return
+	}
+	cp.Violations = append(cp.Violations, Violation{
+		ID:           e.Violation,
+		Registration: e.Registration,
+		Location:     e.Location,
+		FirstSeen:    e.Time,
+		LastSeen:     e.Time,
+	})
+}
+
+// apply closes the violation
+func (e ViolationCleared) apply(cp *Carpark) {
+	if i := cp.violation(e.Violation); i >= 0 {
+		cp.Violations[i].Cleared = e.Time
+	}
+}
+
+// apply appends the new length to the queue history
+func (e QueueChanged) apply(cp *Carpark) {
+	cp.Queues = append(cp.Queues, QueueSample{Gate: e.Gate, Length: e.Length, Entered: e.Entered, Time: e.Time})
+}
+
+// apply appends the note to the slot notes
+func (e SlotNoteAdded) apply(cp *Carpark) {
+	cp.SlotNotes = append(cp.SlotNotes, SlotNote{ID: e.Note, Slot: e.Slot, Text: e.Text, Attention: e.Attention, Time: e.Time})
+}
+
+// apply marks the note as resolved
+func (e SlotNoteResolved) apply(cp *Carpark) {
+	if i := cp.slotNote(e.Note); i >= 0 {
+		cp.SlotNotes[i].Resolved = e.Time
+	}
+}
+
+// apply records the asset, removing it if the value is empty
+func (e SlotAssetSet) apply(cp *Carpark) {
+	if e.Value == "" {
+		delete(cp.Assets[e.Slot], e.Key)
+		if len(cp.Assets[e.Slot]) == 0 {
+			delete(cp.Assets, e.Slot)
+		}
+		return
+	}
+	if cp.Assets == nil {
+		cp.Assets = make(map[int]map[string]string)
+	}
+	if cp.Assets[e.Slot] == nil {
+		cp.Assets[e.Slot] = make(map[string]string)
+	}
+	cp.Assets[e.Slot][e.Key] = e.Value
+}
+
+// apply appends the note to the car
+func (e NoteAdded) apply(cp *Carpark) {
+	if slotNo, exists := cp.RegMap[e.Registration]; exists {
+		car := cp.Slots[slotNo]
+		car.Notes = append(car.Notes, Note{Text: e.Text, Incident: e.Incident, Time: e.Time})
+	}
+}
+
+// apply appends the photo reference to the car
+func (e EvidenceAttached) apply(cp *Carpark) {
+	if slotNo, exists := cp.RegMap[e.Registration]; exists {
+		car := cp.Slots[slotNo]
+		car.Evidence = append(car.Evidence, e.Ref)
+	}
+}
+
+// apply adds the service to the stay of the car in the slot
+func (e ServiceAdded) apply(cp *Carpark) {
+	if car, ok := cp.Slots[e.Slot]; ok && car.Registration == e.Registration {
+		car.Services = append(car.Services, OrderedService{Name: e.Service, Price: e.Price, Time: e.Time})
+	}
+}
+
+// emit numbers an event, applies it to the state and passes it to the subscribers
+func (cp *Carpark) emit(e Event) {
+	e = e.withID(cp.LastEvent + 1)
+	e.apply(cp)
+	cp.LastEvent = e.eventID()
+	for _, fn := range cp.subscribers {
+		fn(e)
+	}
+}
+
+// Subscribe registers fn to receive every event after it is applied. fn runs while the lot is
+// locked, so events arrive in order, and it must not call back into the Carpark.
+func (cp *Carpark) Subscribe(fn func(Event)) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.subscribers = append(cp.subscribers, fn)
+}
+
+// Apply applies recorded events to the lot in order, such as when replaying a persisted log.
+// Events the lot has already applied are skipped, so a log can be replayed again or in overlapping
+// segments; an event that would skip over unapplied ones, or any event but LotCreated on a lot that
+// was never created, stops the replay with ErrEventGap. Subscribers are not notified. The
+// configuration must match the lot that recorded the events.
+func (cp *Carpark) Apply(events ...Event) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	for _, e := range events {
+		id := e.eventID()
+		if id <= cp.LastEvent {
+			continue
+		}
+		if id != cp.LastEvent+1 {
+			return fmt.Errorf("%w: event %d follows %d", ErrEventGap, id, cp.LastEvent)
+		}
+		if _, created := e.(LotCreated); !created && cp.Slots == nil {
+			return fmt.Errorf("%w: event %d is for a lot that was not created", ErrEventGap, id)
+		}
+		e.apply(cp)
+		cp.LastEvent = id
+	}
+	return nil
+}
+
+// VerifyReplay checks that replaying events is idempotent for a lot configured like cp: applying
+// them twice, or in overlapping segments, must leave the same state as applying them once
+func (cp *Carpark) VerifyReplay(events []Event) error {
+	once, err := cp.replayed(events)
+	if err != nil {
+		return err
+	}
+
+	half := len(events) / 2
+	for _, replay := range []struct {
+		name     string
+		segments [][]Event
+	}{
+		{"twice", [][]Event{events, events}},
+		{"in overlapping segments", [][]Event{events[:min(half+1, len(events))], events[half/2:]}},
+	} {
+		got, err := cp.replayed(replay.segments...)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, once) {
+			return fmt.Errorf("replaying %s leaves a different state than replaying once", replay.name)
+		}
+	}
+	return nil
+}
+
+// replayed applies event segments to a new lot configured like cp and returns its state snapshot
+func (cp *Carpark) replayed(segments ...[]Event) ([]byte, error) {
+	lot := cp.replica()
+	for _, events := range segments {
+		if err := lot.Apply(events...); err != nil {
+			return nil, err
+		}
+	}
+
+	return lot.marshalSnapshot()
+}
+
+// replica returns a lot that is not yet created, configured like cp. The Gateway and Barriers are left
+// out, as replaying events into it must not reach the outside world.
+func (cp *Carpark) replica() *Carpark {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return &Carpark{
+		GracePeriod:   cp.GracePeriod,
+		ReentryWindow: cp.ReentryWindow,
+		RestoreWindow: cp.RestoreWindow,
+		CleaningBlock: cp.CleaningBlock,
+		Aggregators:   cp.Aggregators,
+		Clock:         cp.Clock,
+		Rates:         cp.Rates,
+		Pricer:        cp.Pricer,
+		Strategy:      cp.Strategy,
+		PlatePattern:  cp.PlatePattern,
+		Gates:         cp.Gates,
+		EntryPace:     cp.EntryPace,
+	}
+}
+
+// eventJSON is the persisted form of an event, tagged with its type
+type eventJSON struct {
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+// MarshalEvent encodes an event as JSON tagged with its type
+func MarshalEvent(e Event) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(eventJSON{Type: e.eventType(), Event: data})
+}
+
+// UnmarshalEvent decodes an event written by MarshalEvent
+func UnmarshalEvent(data []byte) (Event, error) {
+	var tagged eventJSON
+	if err := json.Unmarshal(data, &tagged); err != nil {
+		return nil, err
+	}
+
+	switch tagged.Type {
+	case "lot_created":
+		return decodeEvent[LotCreated](tagged.Event)
+	case "car_parked":
+		return decodeEvent[CarParked](tagged.Event)
+	case "car_left":
+		return decodeEvent[CarLeft](tagged.Event)
+	case "note_added":
+		return decodeEvent[NoteAdded](tagged.Event)
+	case "evidence_attached":
+		return decodeEvent[EvidenceAttached](tagged.Event)
+	case "service_added":
+		return decodeEvent[ServiceAdded](tagged.Event)
+	case "cleaning_started":
+		return decodeEvent[CleaningStarted](tagged.Event)
+	case "cleaning_ended":
+		return decodeEvent[CleaningEnded](tagged.Event)
+	case "booking_made":
+		return decodeEvent[BookingMade](tagged.Event)
+	case "no_shows_reconciled":
+		return decodeEvent[NoShowsReconciled](tagged.Event)
+	case "reservation_made":
+		return decodeEvent[ReservationMade](tagged.Event)
+	case "reservations_expired":
+		return decodeEvent[ReservationsExpired](tagged.Event)
+	case "refund_issued":
+		return decodeEvent[RefundIssued](tagged.Event)
+	case "size_mismatch_reported":
+		return decodeEvent[SizeMismatchReported](tagged.Event)
+	case "charging_started":
+		return decodeEvent[ChargingStarted](tagged.Event)
+	case "charging_ended":
+		return decodeEvent[ChargingEnded](tagged.Event)
+	case "evacuation_started":
+		return decodeEvent[EvacuationStarted](tagged.Event)
+	case "evacuation_ended":
+		return decodeEvent[EvacuationEnded](tagged.Event)
+	case "violation_logged":
+		return decodeEvent[ViolationLogged](tagged.Event)
+	case "violation_cleared":
+		return decodeEvent[ViolationCleared](tagged.Event)
+	case "queue_changed":
+		return decodeEvent[QueueChanged](tagged.Event)
+	case "slot_note_added":
+		return decodeEvent[SlotNoteAdded](tagged.Event)
+	case "slot_note_resolved":
+		return decodeEvent[SlotNoteResolved](tagged.Event)
+	case "slot_asset_set":
+		return decodeEvent[SlotAssetSet](tagged.Event)
+	default:
+		return nil, fmt.Errorf("unknown event type %q", tagged.Type)
+	}
+}
+
+// decodeEvent decodes the body of an event of type E
+func decodeEvent[E Event](data json.RawMessage) (Event, error) {
+	var e E
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,191 @@
+package parking
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestApplyBeforeLotCreated(t *testing.T) {
+	now := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	for _, e := range []Event{
+		CarParked{ID: 1, Slot: 1, Registration: "KA-01", Color: "White", Time: now},
+		CarLeft{ID: 1, Slot: 1, Time: now},
+	} {
+		cp := &Carpark{}
+		if err := cp.Apply(e); !errors.Is(err, ErrEventGap) {
+			t.Errorf("%s on a lot that was not created: got %v, want ErrEventGap", e.eventType(), err)
+		}
+		if cp.LastEvent != 0 {
+			t.Errorf("%s on a lot that was not created was applied", e.eventType())
+		}
+	}
+
+	cp := &Carpark{}
+	err := cp.Apply(LotCreated{ID: 1, Slots: 2, Time: now}, CarParked{ID: 2, Slot: 1, Registration: "KA-01", Color: "White", Time: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slotNo, err := cp.SlotNumberForRegistrationNumber("KA-01"); err != nil || slotNo != 1 {
+		t.Errorf("KA-01 is in slot %d, %v; want 1", slotNo, err)
+	}
+}
+
+// fixedClock is a Clock stopped at one time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestReplayKeepsConfiguration(t *testing.T) {
+	now := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	cp := &Carpark{
+		Clock:         fixedClock(now),
+		GracePeriod:   time.Minute,
+		ReentryWindow: time.Hour,
+		RestoreWindow: time.Hour,
+		CleaningBlock: CleaningBlock{Start: 2 * time.Hour, Duration: time.Hour, Slots: 1},
+		Aggregators:   Aggregators{Allotment: 2, Partners: []Partner{{Name: "parkhub", Key: "k", Quota: 1}}},
+		Rates:         RateCard{FlatFee: 200, FlatHours: 1},
+		Strategy:      LeastRecentlyUsed,
+		PlatePattern:  regexp.MustCompile(`KA-[0-9]+`),
+		Gates:         []Gate{{Name: "north", Distances: []int{3, 2, 1}}},
+		EntryPace:     30 * time.Second,
+		Gateway:       newBlockingGateway(),
+	}
+	var events []Event
+	cp.Subscribe(func(e Event) { events = append(events, e) })
+	cp.CreateParkingLot(3)
+
+	if _, err := cp.ParkFromGate("north", "KA-01", "White", VehicleCar); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.Park("KA-02", "Red"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.Book("parkhub", "KA-03", now.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.LeaveByRegistration("KA-01"); err != nil {
+		t.Fatal(err)
+	}
+
+	lot := cp.replica()
+	if lot.Gateway != nil || lot.Barriers != nil {
+		t.Error("replica can reach the payment gateway or the barriers")
+	}
+	if !reflect.DeepEqual(lot.Gates, cp.Gates) || lot.CleaningBlock != cp.CleaningBlock ||
+		!reflect.DeepEqual(lot.Aggregators, cp.Aggregators) || lot.PlatePattern != cp.PlatePattern ||
+		lot.Strategy != cp.Strategy || lot.Clock != cp.Clock || lot.EntryPace != cp.EntryPace || !reflect.DeepEqual(lot.Rates, cp.Rates) {
+		t.Errorf("replica is configured as %+v, want %+v", lot, cp)
+	}
+
+	want, err := cp.marshalSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cp.replayed(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("replayed state\n%s\ndiffers from the lot's\n%s", got, want)
+	}
+	if err := cp.VerifyReplay(events); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLotCreatedDiscardsEarlierState(t *testing.T) {
+	cp := &Carpark{Rates: RateCard{FlatFee: 200, FlatHours: 1}, Gates: []Gate{{Name: "north", Distances: []int{1, 2, 3}}}}
+	cp.CreateParkingLot(3)
+	for _, registration := range []string{"KA-01", "KA-02", "KA-03"} {
+		if _, err := cp.Park(registration, "White"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cp.Exit("KA-01"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.ForceFree(2, "towed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.LogViolation("KA-09", "fire lane"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.ReportQueue("north", 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.AddSlotNote(1, "cracked bollard", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.SetSlotAsset(1, "charger_serial", "CH-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.StartEvacuation(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cp.CreateFloors(2, 2)
+	if cp.Evacuating() {
+		t.Error("the evacuation of the earlier lot is still under way")
+	}
+	if cp.Evacuation != nil || cp.Payments != nil || cp.Reconciliations != nil || cp.Violations != nil ||
+		cp.Queues != nil || cp.SlotNotes != nil || cp.Assets != nil || cp.Mismatches != nil || cp.Charging != nil {
+		t.Errorf("records of the earlier lot survived: %+v", cp)
+	}
+	if slotNo, err := cp.Park("KA-04", "Red"); err != nil || slotNo != 1 {
+		t.Errorf("got slot %d, %v; want 1", slotNo, err)
+	}
+	checkInvariants(t, cp)
+}
+
+func TestEndCleaning(t *testing.T) {
+	now := time.Date(2024, 3, 4, 2, 30, 0, 0, time.UTC)
+	block := CleaningBlock{Start: 2 * time.Hour, Duration: time.Hour, Slots: 2}
+	cp := &Carpark{Clock: fixedClock(now), CleaningBlock: block}
+	var events []Event
+	cp.Subscribe(func(e Event) { events = append(events, e) })
+	cp.CreateParkingLot(3)
+
+	if slotNo, err := cp.Park("KA-01", "White"); err != nil || slotNo != 3 {
+		t.Fatalf("parked in slot %d, %v; want 3 with slots 1 and 2 held for cleaning", slotNo, err)
+	}
+	until := time.Date(2024, 3, 4, 3, 0, 0, 0, time.UTC)
+	if holds := cp.CleaningHolds(); !reflect.DeepEqual(holds, []CleaningHold{{1, until}, {2, until}}) {
+		t.Fatalf("holds %+v, want slots 1 and 2 until 03:00", holds)
+	}
+
+	if _, err := cp.EndCleaning(3); !errors.Is(err, ErrNotCleaning) {
+		t.Errorf("end cleaning of an occupied slot: got %v, want ErrNotCleaning", err)
+	}
+	if hold, err := cp.EndCleaning(2); err != nil || hold.Slot != 2 {
+		t.Fatalf("ended hold %+v, %v; want slot 2", hold, err)
+	}
+	if _, err := cp.EndCleaning(2); !errors.Is(err, ErrNotCleaning) {
+		t.Errorf("end cleaning twice: got %v, want ErrNotCleaning", err)
+	}
+	if slotNo, err := cp.Park("KA-02", "Red"); err != nil || slotNo != 2 {
+		t.Errorf("parked in slot %d, %v; want 2 once its cleaning ended", slotNo, err)
+	}
+	for _, p := range cp.IntegrityStats().Problems {
+		t.Error(p)
+	}
+
+	// Replaying the events holds and releases the same slots
+	replayed := &Carpark{Clock: fixedClock(now), CleaningBlock: block}
+	if err := replayed.Apply(events...); err != nil {
+		t.Fatal(err)
+	}
+	if holds := replayed.CleaningHolds(); !reflect.DeepEqual(holds, []CleaningHold{{1, until}}) {
+		t.Errorf("replayed holds %+v, want slot 1 until 03:00", holds)
+	}
+	for _, p := range replayed.IntegrityStats().Problems {
+		t.Error(p)
+	}
+}
@@ -0,0 +1,89 @@
+package parking
+
+import "sort"
+
+// Floor is one level of a multi-storey lot, holding the consecutive slots First to Last
+type Floor struct {
+	Number int `json:"number"` // Floors are numbered from 1 at the lowest
+	First  int `json:"first"`
+	Last   int `json:"last"`
+}
+
+// FloorCount is how many slots a floor has and how many of them can be allocated now
+type FloorCount struct {
+	Floor
+	Slots int `json:"slots"`
+	Free  int `json:"free"`
+}
+
+// CreateFloors initializes the parking lot with a floor for each of the given numbers of slots, lowest first.
+// Slots are numbered on from the floor below, so the lowest floor holds slots 1 to sizes[0]. Like
+// CreateParkingLot, it discards everything recorded about an earlier lot.
+func (cp *Carpark) CreateFloors(sizes ...int) {
+	floors := make([]Floor, 0, len(sizes))
+	last := 0
+	for i, n := range sizes {
+		floors = append(floors, Floor{Number: i + 1, First: last + 1, Last: last + n})
+		last += n
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.emit(LotCreated{Slots: last, Floors: floors, SlotSizes: cp.SlotSizes, Chargers: cp.Chargers, Accessible: cp.Accessible, Reserved: cp.Reserved, Time: cp.now()})
+}
+
+// floors returns the floors of the lot, a single floor holding every slot unless it was created with CreateFloors
+func (cp *Carpark) floors() []Floor {
+	if len(cp.Floors) > 0 {
+		return cp.Floors
+	}
+	return []Floor{{Number: 1, First: 1, Last: cp.MaxSlots}}
+}
+
+// floorOf returns the number of the floor holding a slot
+func (cp *Carpark) floorOf(slotNo int) int {
+	floors := cp.floors()
+	i := sort.Search(len(floors), func(i int) bool { return floors[i].Last >= slotNo })
+	if i == len(floors) {
+		return 0
+	}
+	return floors[i].Number
+}
+
+// FloorStatus returns the cars parked on a floor ordered by slot number
+func (cp *Carpark) FloorStatus(number int) ([]ParkedCar, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	for _, floor := range cp.floors() {
+		if floor.Number != number {
+			continue
+		}
+		parked := make([]ParkedCar, 0)
+		for i := floor.First; i <= floor.Last; i++ {
+			if car, ok := cp.Slots[i]; ok {
+				parked = append(parked, ParkedCar{Slot: i, Car: *car})
+			}
+		}
+		return parked, nil
+	}
+	return nil, ErrFloorNotFound
+}
+
+// FreeByFloor returns the number of slots on each floor and how many of them are in the free pool
+func (cp *Carpark) FreeByFloor() []FloorCount {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	floors := cp.floors()
+	counts := make([]FloorCount, len(floors))
+	for i, floor := range floors {
+		counts[i] = FloorCount{Floor: floor, Slots: floor.Last - floor.First + 1}
+	}
+	for _, slotNo := range cp.freeSlots() {
+		if n := cp.floorOf(slotNo); n > 0 {
+			counts[n-1].Free++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,229 @@
+package parking
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// Gate is an entry to the lot with the distance from it to each slot
+type Gate struct {
+	Name      string `json:"name"`
+	Distances []int  `json:"distances"` // Distance to each slot, slot 1 first; slots past the end are the farthest
+}
+
+// gatePool is the free pool ordered by distance from one gate, with a heap for each size of slot so the
+// nearest slot a vehicle fits is at the head of one of the heaps of the sizes it fits. Accessible and reserved
+// slots are never picked through a gate, so they are left out.
+type gatePool struct {
+	bySize map[SlotSize]*gateHeap // Map to store the heap of the free slots of each size
+}
+
+// gateHeap is a min-heap of free slots ordered by their distance from one gate, then by slot number.
+// It records where each slot sits so a slot taken through another gate is removed in O(log n).
+type gateHeap struct {
+	distances []int
+	slots     []int
+	pos       map[int]int // Map to store the index in slots of each free slot
+}
+
+func (h *gateHeap) distance(slotNo int) int {
+	if slotNo < 1 || slotNo > len(h.distances) {
+		return math.MaxInt
+	}
+	return h.distances[slotNo-1]
+}
+
+func (h *gateHeap) Len() int { return len(h.slots) }
+func (h *gateHeap) Less(i, j int) bool {
+	return h.closer(h.slots[i], h.slots[j])
+}
+func (h *gateHeap) Swap(i, j int) {
+	h.slots[i], h.slots[j] = h.slots[j], h.slots[i]
+	h.pos[h.slots[i]], h.pos[h.slots[j]] = i, j
+}
+
+func (h *gateHeap) Push(x interface{}) {
+	slotNo := x.(int)
+	h.pos[slotNo] = len(h.slots)
+	h.slots = append(h.slots, slotNo)
+}
+
+func (h *gateHeap) Pop() interface{} {
+	n := len(h.slots)
+	slotNo := h.slots[n-1]
+	h.slots = h.slots[:n-1]
+	delete(h.pos, slotNo)
+	return slotNo
+}
+
+// LoadGates reads the lot's entry gates and their distances to each slot from a JSON file
+func LoadGates(path string) ([]Gate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var gates []Gate
+	if err := json.Unmarshal(data, &gates); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	names := make(map[string]bool)
+	for i, g := range gates {
+		if g.Name == "" {
+			return nil, fmt.Errorf("%s: gate %d needs a name", path, i+1)
+		}
+		if names[g.Name] {
+			return nil, fmt.Errorf("%s: gate %s has the same name as another", path, g.Name)
+		}
+		names[g.Name] = true
+	}
+	return gates, nil
+}
+
+// buildGateHeaps indexes the free pool by distance from each gate. Gates only pick slots under NearestFirst,
+// so no index is kept under LeastRecentlyUsed.
+func (cp *Carpark) buildGateHeaps() {
+	cp.gateHeaps = nil
+	if cp.Strategy != NearestFirst || len(cp.Gates) == 0 {
+		return
+	}
+	bySize := make(map[SlotSize][]int)
+	for _, slotNo := range cp.freeSlots() {
+		if cp.gateSlot(slotNo) {
+			bySize[cp.sizeOf(slotNo)] = append(bySize[cp.sizeOf(slotNo)], slotNo)
+		}
+	}
+	cp.gateHeaps = make(map[string]*gatePool, len(cp.Gates))
+	for _, g := range cp.Gates {
+		pool := &gatePool{bySize: make(map[SlotSize]*gateHeap, len(slotSizes))}
+		for _, size := range slotSizes {
+			free := bySize[size]
+			h := &gateHeap{distances: g.Distances, slots: append([]int(nil), free...), pos: make(map[int]int, len(free))}
+			for i, slotNo := range h.slots {
+				h.pos[slotNo] = i
+			}
+			heap.Init(h)
+			pool.bySize[size] = h
+		}
+		cp.gateHeaps[g.Name] = pool
+	}
+}
+
+// gateSlot reports whether a slot can be picked through a gate, which accessible and reserved slots never are
+func (cp *Carpark) gateSlot(slotNo int) bool {
+	_, reserved := cp.Reserved[slotNo]
+	return !cp.Accessible[slotNo] && !reserved
+}
+
+// pushGates adds a slot returned to the free pool to the index of each gate
+func (cp *Carpark) pushGates(slotNo int) {
+	if len(cp.gateHeaps) == 0 || !cp.gateSlot(slotNo) {
+		return
+	}
+	size := cp.sizeOf(slotNo)
+	for _, pool := range cp.gateHeaps {
+		heap.Push(pool.bySize[size], slotNo)
+	}
+}
+
+// removeGates removes a slot taken from the free pool from the index of each gate
+func (cp *Carpark) removeGates(slotNo int) {
+	if len(cp.gateHeaps) == 0 {
+		return
+	}
+	size := cp.sizeOf(slotNo)
+	for _, pool := range cp.gateHeaps {
+		h := pool.bySize[size]
+		if i, ok := h.pos[slotNo]; ok {
+			heap.Remove(h, i)
+		}
+	}
+}
+
+// nearest returns the free slot nearest the gate among those a vehicle without a permit fits, reporting false
+// if there is none. It compares the heads of the heaps of the sizes the vehicle fits, so it costs O(log n) but
+// for slots held for a reservation at the heads.
+func (p *gatePool) nearest(cp *Carpark, vehicle VehicleType) (int, bool) {
+	var best *gateHeap
+	bestSlot := 0
+	for _, size := range slotSizes {
+		h := p.bySize[size]
+		if !vehicle.fits(size) {
+			continue
+		}
+		slotNo, ok := h.head(cp)
+		if ok && (best == nil || h.closer(slotNo, bestSlot)) {
+			best, bestSlot = h, slotNo
+		}
+	}
+	return bestSlot, best != nil
+}
+
+// head returns the free slot in the heap nearest the gate that is not held for a reservation, reporting false
+// if there is none. Held slots in front of it are popped to reach it and pushed back, each costing O(log n).
+func (h *gateHeap) head(cp *Carpark) (int, bool) {
+	var held []int
+	for h.Len() > 0 && !cp.regular(h.slots[0]) {
+		held = append(held, heap.Pop(h).(int))
+	}
+	slotNo, ok := 0, h.Len() > 0
+	if ok {
+		slotNo = h.slots[0]
+	}
+	for _, s := range held {
+		heap.Push(h, s)
+	}
+	return slotNo, ok
+}
+
+// closer reports whether slot a is nearer the gate than slot b, the lower numbered first at the same distance
+func (h *gateHeap) closer(a, b int) bool {
+	if da, db := h.distance(a), h.distance(b); da != db {
+		return da < db
+	}
+	return a < b
+}
+
+// ParkFromGate parks a vehicle arriving through a gate in the free slot nearest to that gate that it fits and
+// returns its ticket, taking it off the front of the gate's queue. Under LeastRecentlyUsed the gate is only used
+// for the queue and the vehicle is parked as by ParkVehicle.
+func (cp *Carpark) ParkFromGate(gate string, registration string, color string, vehicle VehicleType) (Ticket, error) {
+	if _, err := ParseVehicleType(string(vehicle)); err != nil {
+		return Ticket{}, err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if !cp.hasGate(gate) {
+		return Ticket{}, ErrGateNotFound
+	}
+	allocate := cp.allocate
+	if pool := cp.gateHeaps[gate]; pool != nil {
+		allocate = func(now time.Time, vehicle VehicleType) (int, bool) {
+			cp.releaseHeldSlots(now)
+			return pool.nearest(cp, vehicle)
+		}
+	}
+	slotNo, err := cp.parkWith(registration, color, vehicle, false, allocate)
+	if err != nil {
+		return cp.parkedTicket(slotNo, err)
+	}
+	car := cp.Slots[slotNo]
+	cp.enterQueue(gate, car.ParkedAt)
+	return ticketFor(slotNo, car), nil
+}
+
+// hasGate reports whether the lot has a gate with the given name
+func (cp *Carpark) hasGate(name string) bool {
+	for _, g := range cp.Gates {
+		if g.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package parking
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// scanNearest returns the free slot nearest the gate that a vehicle without a permit fits by looking at every
+// free slot, for checking the gate's heaps against
+func scanNearest(cp *Carpark, g Gate, vehicle VehicleType) (int, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.releaseHeldSlots(cp.now())
+
+	h := &gateHeap{distances: g.Distances}
+	best := 0
+	for _, slotNo := range cp.freeSlots() {
+		if vehicle.fits(cp.sizeOf(slotNo)) && cp.regular(slotNo) && (best == 0 || h.closer(slotNo, best)) {
+			best = slotNo
+		}
+	}
+	return best, best > 0
+}
+
+func TestParkFromGateNearest(t *testing.T) {
+	const slots = 40
+	rng := rand.New(rand.NewSource(1))
+	now := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	gate := Gate{Name: "north", Distances: rng.Perm(slots - 5)} // The last five slots are the farthest
+	cp := &Carpark{
+		Clock:      fixedClock(now),
+		Gates:      []Gate{gate},
+		SlotSizes:  map[int]SlotSize{},
+		Accessible: map[int]bool{11: true, 12: true},
+		Reserved:   map[int]string{13: "KA-RES"},
+	}
+	for slotNo := 1; slotNo <= 10; slotNo++ {
+		cp.SlotSizes[slotNo] = SlotCompact
+	}
+	for slotNo := 31; slotNo <= 35; slotNo++ {
+		cp.SlotSizes[slotNo] = SlotLarge
+	}
+	cp.CreateParkingLot(slots)
+
+	vehicles := []VehicleType{VehicleMotorcycle, VehicleCompact, VehicleCar, VehicleTruck}
+	for i := 0; i < 2000; i++ {
+		switch op := rng.Intn(10); {
+		case op < 5:
+			vehicle := vehicles[rng.Intn(len(vehicles))]
+			want, ok := scanNearest(cp, gate, vehicle)
+			ticket, err := cp.ParkFromGate(gate.Name, fmt.Sprintf("KA-%d", i), "White", vehicle)
+			if !ok {
+				if err == nil {
+					t.Fatalf("op %d: parked a %s in slot %d, want none free", i, vehicle, ticket.Slot)
+				}
+				continue
+			}
+			if err != nil || ticket.Slot != want {
+				t.Fatalf("op %d: parked a %s in slot %d, %v; want slot %d", i, vehicle, ticket.Slot, err, want)
+			}
+		case op < 9:
+			if _, err := cp.Leave(rng.Intn(slots) + 1); err != nil && !errors.Is(err, ErrSlotNotFound) {
+				t.Fatal(err)
+			}
+		default:
+			// Holds a slot for a reservation whose window is already open
+			if _, err := cp.Reserve(fmt.Sprintf("MH-%d", i), now, now.Add(time.Hour)); err != nil && !errors.Is(err, ErrFullyReserved) {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, p := range cp.IntegrityStats().Problems {
+		t.Error(p)
+	}
+}
+
+// BenchmarkParkFromGate parks a car through a gate whose nearest half of the slots are compact, so the car
+// never fits the nearest free slot, and lets it leave again
+func BenchmarkParkFromGate(b *testing.B) {
+	const slots = 100000
+	gate := Gate{Name: "north", Distances: make([]int, slots)}
+	cp := &Carpark{Gates: []Gate{gate}, SlotSizes: make(map[int]SlotSize)}
+	for slotNo := 1; slotNo <= slots; slotNo++ {
+		gate.Distances[slotNo-1] = slotNo
+		if slotNo <= slots/2 {
+			cp.SlotSizes[slotNo] = SlotCompact
+		}
+	}
+	cp.CreateParkingLot(slots)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ticket, err := cp.ParkFromGate(gate.Name, "KA-01", "White", VehicleCar)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if ticket.Slot != slots/2+1 {
+			b.Fatalf("parked in slot %d, want %d", ticket.Slot, slots/2+1)
+		}
+		if _, err := cp.Leave(ticket.Slot); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package parking
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// IntHeap implements heap.Interface for a min-heap of integers
+type IntHeap []int
+
+func (h IntHeap) Len() int           { return len(h) }
+func (h IntHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h IntHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *IntHeap) Push(x interface{}) {
+	*h = append(*h, x.(int))
+}
+
+func (h *IntHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// pushFree returns a slot to the pool used by the allocation strategy
+func (cp *Carpark) pushFree(slotNo int) {
+	if cp.Strategy == LeastRecentlyUsed {
+		cp.RotationQueue = append(cp.RotationQueue, slotNo)
+		return
+	}
+	heap.Push(&cp.EmptySlots, slotNo)
+	cp.pushGates(slotNo)
+}
+
+// peekFree returns the next slot the allocation strategy would hand out without taking it, reporting false if none is free
+func (cp *Carpark) peekFree() (int, bool) {
+	if cp.Strategy == LeastRecentlyUsed {
+		if len(cp.RotationQueue) == 0 {
+			return 0, false
+		}
+		return cp.RotationQueue[0], true
+	}
+
+	if cp.EmptySlots.Len() == 0 {
+		return 0, false
+	}
+	return cp.EmptySlots[0], true
+}
+
+// freeCount returns the number of slots in the free pool
+func (cp *Carpark) freeCount() int {
+	if cp.Strategy == LeastRecentlyUsed {
+		return len(cp.RotationQueue)
+	}
+	return cp.EmptySlots.Len()
+}
+
+// isFree reports whether a slot is in the free pool
+func (cp *Carpark) isFree(slotNo int) bool {
+	pool := []int(cp.EmptySlots)
+	if cp.Strategy == LeastRecentlyUsed {
+		pool = cp.RotationQueue
+	}
+	for _, s := range pool {
+		if s == slotNo {
+			return true
+		}
+	}
+	return false
+}
+
+// takeSlot removes a specific slot from the free pool, reporting whether it was free
+func (cp *Carpark) takeSlot(slotNo int) bool {
+	if cp.Strategy == LeastRecentlyUsed {
+		for i, s := range cp.RotationQueue {
+			if s == slotNo {
+				cp.RotationQueue = append(cp.RotationQueue[:i], cp.RotationQueue[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+
+	for i, s := range cp.EmptySlots {
+		if s == slotNo {
+			heap.Remove(&cp.EmptySlots, i)
+			cp.removeGates(slotNo)
+			return true
+		}
+	}
+	return false
+}
+
+// freeSlots returns the contents of the free pool in allocation order
+func (cp *Carpark) freeSlots() []int {
+	if cp.Strategy == LeastRecentlyUsed {
+		return append([]int(nil), cp.RotationQueue...)
+	}
+	free := append([]int(nil), cp.EmptySlots...)
+	sort.Ints(free)
+	return free
+}
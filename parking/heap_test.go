@@ -0,0 +1,256 @@
+package parking
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lotModel is what a lot allocating the lowest free slot should hold after a sequence of operations
+type lotModel struct {
+	slots      int
+	occupied   map[int]string // Registration numbers by slot
+	departures map[string]int // Slots cars that can be restored left, by registration number
+}
+
+func newLotModel(slots int) *lotModel {
+	return &lotModel{slots: slots, occupied: make(map[int]string), departures: make(map[string]int)}
+}
+
+// lowestFree returns the lowest numbered slot without a car, reporting false if every slot has one
+func (m *lotModel) lowestFree() (int, bool) {
+	for slotNo := 1; slotNo <= m.slots; slotNo++ {
+		if _, ok := m.occupied[slotNo]; !ok {
+			return slotNo, true
+		}
+	}
+	return 0, false
+}
+
+// slotOf returns the slot a car is parked in, reporting false if it is not parked
+func (m *lotModel) slotOf(registration string) (int, bool) {
+	for slotNo, r := range m.occupied {
+		if r == registration {
+			return slotNo, true
+		}
+	}
+	return 0, false
+}
+
+// interleaving runs operations against a lot and its model side by side
+type interleaving struct {
+	t     *testing.T
+	cp    *Carpark
+	model *lotModel
+	dir   string
+}
+
+func newInterleaving(t *testing.T, slots int) *interleaving {
+	in := &interleaving{t: t, model: newLotModel(slots), dir: t.TempDir()}
+	in.cp = newRestorableLot()
+	in.cp.CreateParkingLot(slots)
+	return in
+}
+
+// newRestorableLot returns a lot that lets mistaken departures be restored
+func newRestorableLot() *Carpark {
+	return &Carpark{RestoreWindow: time.Hour}
+}
+
+// run applies an operation such as "park A", "leave 2", "restore A", "resize 4", "reload" or "legacy" to the
+// lot and the model, failing the test if the lot hands out a slot other than the model's or breaks an invariant
+func (in *interleaving) run(op string) {
+	t, m := in.t, in.model
+	t.Helper()
+
+	name, arg, _ := strings.Cut(op, " ")
+	switch name {
+	case "park":
+		want, free := m.lowestFree()
+		wantErr := error(nil)
+		if parked, ok := m.slotOf(arg); ok {
+			want, wantErr = parked, ErrAlreadyParked
+		} else if !free {
+			wantErr = ErrLotFull
+		}
+		got, err := in.cp.Park(arg, "White")
+		in.check(op, got, err, want, wantErr)
+		if wantErr == nil {
+			m.occupied[want] = arg
+			delete(m.departures, arg)
+		}
+
+	case "leave":
+		slotNo, _ := strconv.Atoi(arg)
+		registration, ok := m.occupied[slotNo]
+		car, err := in.cp.Leave(slotNo)
+		if !ok {
+			in.check(op, 0, err, 0, ErrSlotNotFound)
+			break
+		}
+		if err != nil || car.Registration != registration {
+			t.Fatalf("%s: got %v, %v; want %s", op, car, err, registration)
+		}
+		delete(m.occupied, slotNo)
+		m.departures[registration] = slotNo
+
+	case "restore":
+		left, ok := m.departures[arg]
+		want, wantErr := left, error(nil)
+		if !ok {
+			want, wantErr = 0, ErrNotFound
+		} else if _, taken := m.occupied[left]; taken {
+			var free bool
+			if want, free = m.lowestFree(); !free {
+				want, wantErr = 0, ErrLotFull
+			}
+		}
+		got, err := in.cp.Restore(arg)
+		in.check(op, got, err, want, wantErr)
+		if wantErr == nil {
+			m.occupied[want] = arg
+			delete(m.departures, arg)
+		}
+
+	case "resize":
+		slots, _ := strconv.Atoi(arg)
+		in.cp.CreateParkingLot(slots)
+		*m = *newLotModel(slots)
+
+	case "reload":
+		path := filepath.Join(in.dir, "lot.json")
+		if err := in.cp.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		in.cp = newRestorableLot()
+		if err := in.cp.Load(path); err != nil {
+			t.Fatal(err)
+		}
+
+	case "legacy":
+		in.loadLegacy()
+
+	default:
+		t.Fatalf("unknown operation %q", op)
+	}
+
+	checkInvariants(t, in.cp)
+	for slotNo, registration := range m.occupied {
+		if car, ok := in.cp.Slots[slotNo]; !ok || car.Registration != registration {
+			t.Fatalf("after %s: slot %d holds %v, want %s", op, slotNo, car, registration)
+		}
+	}
+	if len(in.cp.Slots) != len(m.occupied) {
+		t.Fatalf("after %s: %d cars parked, want %d", op, len(in.cp.Slots), len(m.occupied))
+	}
+}
+
+// check fails the test unless an operation returned the expected slot and error
+func (in *interleaving) check(op string, got int, err error, want int, wantErr error) {
+	in.t.Helper()
+	if !errors.Is(err, wantErr) || err == nil && wantErr != nil || got != want {
+		in.t.Fatalf("%s: got slot %d, %v; want slot %d, %v", op, got, err, want, wantErr)
+	}
+}
+
+// loadLegacy reloads the lot from a snapshot in the format of versions that allocated the slots from
+// next_slot up in order instead of keeping them in the free pool
+func (in *interleaving) loadLegacy() {
+	t := in.t
+	t.Helper()
+
+	data, err := in.cp.marshalSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap map[string]interface{}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatal(err)
+	}
+
+	next := 1
+	for slotNo := range in.model.occupied {
+		next = max(next, slotNo+1)
+	}
+	var pool []int
+	for _, slotNo := range in.cp.EmptySlots {
+		if slotNo < next {
+			pool = append(pool, slotNo)
+		}
+	}
+	snap["next_slot"], snap["empty_slots"] = next, pool
+
+	if data, err = json.Marshal(snap); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(in.dir, "legacy.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	in.cp = newRestorableLot()
+	if err := in.cp.Load(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocationInterleavings(t *testing.T) {
+	tests := []struct {
+		name  string
+		slots int
+		ops   []string
+	}{
+		{"leave frees the lowest slot", 3, []string{"park A", "park B", "park C", "leave 1", "park D", "park E"}},
+		{"restore to the slot left", 3, []string{"park A", "park B", "leave 1", "restore A", "park C", "park D"}},
+		{"restore when the slot was taken", 3, []string{"park A", "leave 1", "park B", "restore A", "park C"}},
+		{"restore into a full lot", 2, []string{"park A", "park B", "leave 1", "park C", "restore A"}},
+		{"restore twice", 3, []string{"park A", "leave 1", "restore A", "restore A", "leave 1", "restore A"}},
+		{"re-park instead of restore", 3, []string{"park A", "leave 1", "park A", "restore A"}},
+		{"resize smaller", 4, []string{"park A", "park B", "park C", "resize 2", "park D", "park E", "park F"}},
+		{"resize larger", 2, []string{"park A", "park B", "park C", "resize 4", "park D", "park E", "park F", "park G", "park H"}},
+		{"restore after resize", 3, []string{"park A", "leave 1", "resize 3", "restore A", "park B"}},
+		{"reload keeps the free pool", 4, []string{"park A", "park B", "park C", "leave 2", "reload", "park D", "park E", "park F"}},
+		{"restore after reload", 3, []string{"park A", "park B", "leave 1", "reload", "restore A", "park C"}},
+		{"legacy snapshot with free slots above next_slot", 5, []string{"park A", "park B", "leave 1", "legacy", "park C", "park D", "park E", "park F", "park G"}},
+		{"legacy snapshot of an empty lot", 3, []string{"legacy", "park A", "park B", "park C", "park D"}},
+		{"legacy snapshot then restore", 3, []string{"park A", "park B", "leave 2", "legacy", "restore B", "park C", "park D"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := newInterleaving(t, tt.slots)
+			for _, op := range tt.ops {
+				in.run(op)
+			}
+		})
+	}
+}
+
+// TestAllocationInterleavingsExhaustive runs every sequence of a few operations on a small lot
+func TestAllocationInterleavingsExhaustive(t *testing.T) {
+	ops := []string{"park A", "park B", "park C", "leave 1", "leave 2", "leave 3", "restore A", "resize 2", "resize 3", "reload", "legacy"}
+	depth := 4
+	if testing.Short() {
+		depth = 3
+	}
+
+	var walk func(seq []string)
+	walk = func(seq []string) {
+		if len(seq) == depth {
+			t.Run(strings.Join(seq, ","), func(t *testing.T) {
+				in := newInterleaving(t, 3)
+				for _, op := range seq {
+					in.run(op)
+				}
+			})
+			return
+		}
+		for _, op := range ops {
+			walk(append(seq, op))
+		}
+	}
+	walk(nil)
+}
@@ -0,0 +1,52 @@
+package parking
+
+import "strings"
+
+// colorShrinkMin is the smallest color bucket worth rebuilding after cars of that color leave
+const colorShrinkMin = 64
+
+// internColor returns the lot's copy of a color name, so every car of a color shares one string
+// and none keeps alive the command line or request body the name was parsed from
+func (cp *Carpark) internColor(color string) string {
+	if interned, ok := cp.colors[color]; ok {
+		return interned
+	}
+	if cp.colors == nil {
+		cp.colors = make(map[string]string)
+	}
+	interned := strings.Clone(color)
+	cp.colors[interned] = interned
+	return interned
+}
+
+// indexColor adds a slot to its color's bucket and notes the bucket's largest size
+func (cp *Carpark) indexColor(color string, slotNo int) {
+	colorSlots := cp.ColorMap[color]
+	if colorSlots == nil {
+		colorSlots = make(map[int]struct{})
+		cp.ColorMap[color] = colorSlots
+	}
+	colorSlots[slotNo] = struct{}{}
+	if cp.colorPeaks == nil {
+		cp.colorPeaks = make(map[string]int)
+	}
+	if len(colorSlots) > cp.colorPeaks[color] {
+		cp.colorPeaks[color] = len(colorSlots)
+	}
+}
+
+// shrinkColor rebuilds a color's bucket once it has emptied to a quarter of its largest size,
+// since a Go map keeps the memory of every entry it ever held
+func (cp *Carpark) shrinkColor(color string) {
+	colorSlots := cp.ColorMap[color]
+	peak := cp.colorPeaks[color]
+	if peak < colorShrinkMin || len(colorSlots)*4 > peak {
+		return
+	}
+	rebuilt := make(map[int]struct{}, len(colorSlots))
+	for slotNo := range colorSlots {
+		rebuilt[slotNo] = struct{}{}
+	}
+	cp.ColorMap[color] = rebuilt
+	cp.colorPeaks[color] = len(rebuilt)
+}
@@ -0,0 +1,68 @@
+package parking
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// liveHeap returns the bytes of live heap after a full collection
+func liveHeap() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// BenchmarkColorIndexChurn fills a lot with cars of one color parsed from command lines, then lets all but
+// 1% of them leave. It reports the live heap per parked car when the lot is full, and the live heap of the
+// color index once the cars have left. Only the exported API and ColorMap are used, so the benchmark also
+// runs on versions before colors were interned, for comparison:
+//
+//	go test -run '^$' -bench ColorIndexChurn -benchtime 3x ./parking
+func BenchmarkColorIndexChurn(b *testing.B) {
+	const slots = 200000
+	var perCar, index float64
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		before := liveHeap()
+		b.StartTimer()
+
+		cp := &Carpark{}
+		cp.CreateParkingLot(slots)
+		for n := 0; n < slots; n++ {
+			// Each color is a slice of the line it was read from, as in the shell
+			line := fmt.Sprintf("park KA-%06d White", n)
+			fields := strings.Fields(line)
+			if _, err := cp.Park(fields[1], fields[2]); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.StopTimer()
+		full := liveHeap()
+		b.StartTimer()
+
+		for slotNo := 1; slotNo <= slots; slotNo++ {
+			if slotNo%100 == 0 {
+				continue
+			}
+			if _, err := cp.Leave(slotNo); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.StopTimer()
+		churned := liveHeap()
+		cp.ColorMap = nil
+		withoutIndex := liveHeap()
+		b.StartTimer()
+
+		perCar += (float64(full) - float64(before)) / slots
+		index += (float64(churned) - float64(withoutIndex)) / 1024
+		runtime.KeepAlive(cp)
+	}
+	b.ReportMetric(perCar/float64(b.N), "B/car")
+	b.ReportMetric(index/float64(b.N), "index-KiB")
+}
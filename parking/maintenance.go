@@ -0,0 +1,135 @@
+package parking
+
+import (
+	"sort"
+	"time"
+)
+
+// SlotNote is a remark about a slot itself rather than the car in it, such as pillar damage or a faulty light
+type SlotNote struct {
+	ID        string    `json:"id"` // ULID, so notes sort by when they were added
+	Slot      int       `json:"slot"`
+	Text      string    `json:"text"`
+	Attention bool      `json:"attention"` // Whether the slot needs maintenance until the note is resolved
+	Time      time.Time `json:"time"`
+	Resolved  time.Time `json:"resolved"` // When the maintenance was done, zero while it is still needed
+}
+
+// SlotDetails is what is recorded about a slot itself: its notes and its assets, such as a charger's serial number
+type SlotDetails struct {
+	Slot   int               `json:"slot"`
+	Notes  []SlotNote        `json:"notes"`
+	Assets map[string]string `json:"assets"`
+}
+
+// AddSlotNote attaches a note to a slot, flagging the slot as needing maintenance if attention is set, and
+// returns the note. It returns ErrNoSlot for a slot number the lot does not have.
+func (cp *Carpark) AddSlotNote(slotNo int, text string, attention bool) (SlotNote, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return SlotNote{}, ErrEvacuating
+	}
+	if slotNo < 1 || slotNo > cp.MaxSlots {
+		return SlotNote{}, ErrNoSlot
+	}
+
+	now := cp.now()
+	id := newULID(now)
+	cp.emit(SlotNoteAdded{Note: id, Slot: slotNo, Text: text, Attention: attention, Time: now})
+	return cp.SlotNotes[cp.slotNote(id)], nil
+}
+
+// ResolveSlotNote records that the maintenance a note asked for was done and returns the note. It returns
+// ErrNotFound if no open note needing attention has the given ID.
+func (cp *Carpark) ResolveSlotNote(id string) (SlotNote, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return SlotNote{}, ErrEvacuating
+	}
+
+	i := cp.slotNote(id)
+	if i < 0 || !cp.SlotNotes[i].Attention || !cp.SlotNotes[i].Resolved.IsZero() {
+		return SlotNote{}, ErrNotFound
+	}
+	cp.emit(SlotNoteResolved{Note: id, Time: cp.now()})
+	return cp.SlotNotes[i], nil
+}
+
+// SetSlotAsset records an asset of a slot, such as the serial number of its charger, under a key.
+// An empty value removes the asset. It returns ErrNoSlot for a slot number the lot does not have.
+func (cp *Carpark) SetSlotAsset(slotNo int, key string, value string) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return ErrEvacuating
+	}
+	if slotNo < 1 || slotNo > cp.MaxSlots {
+		return ErrNoSlot
+	}
+
+	cp.emit(SlotAssetSet{Slot: slotNo, Key: key, Value: value, Time: cp.now()})
+	return nil
+}
+
+// SlotInfo returns the notes, oldest first, and the assets of a slot, or ErrNoSlot for a slot number the lot
+// does not have
+func (cp *Carpark) SlotInfo(slotNo int) (SlotDetails, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	if slotNo < 1 || slotNo > cp.MaxSlots {
+		return SlotDetails{}, ErrNoSlot
+	}
+	details := SlotDetails{Slot: slotNo, Notes: make([]SlotNote, 0), Assets: make(map[string]string)}
+	for _, n := range cp.SlotNotes {
+		if n.Slot == slotNo {
+			details.Notes = append(details.Notes, n)
+		}
+	}
+	for key, value := range cp.Assets[slotNo] {
+		details.Assets[key] = value
+	}
+	return details, nil
+}
+
+// NeedingAttention returns the slots with notes asking for maintenance that has not been done, ordered by slot,
+// each with only those notes and with all of its assets
+func (cp *Carpark) NeedingAttention() []SlotDetails {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	bySlot := make(map[int]*SlotDetails)
+	for _, n := range cp.SlotNotes {
+		if !n.Attention || !n.Resolved.IsZero() {
+			continue
+		}
+		details, ok := bySlot[n.Slot]
+		if !ok {
+			details = &SlotDetails{Slot: n.Slot, Assets: make(map[string]string)}
+			for key, value := range cp.Assets[n.Slot] {
+				details.Assets[key] = value
+			}
+			bySlot[n.Slot] = details
+		}
+		details.Notes = append(details.Notes, n)
+	}
+
+	slots := make([]SlotDetails, 0, len(bySlot))
+	for _, details := range bySlot {
+		slots = append(slots, *details)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Slot < slots[j].Slot })
+	return slots
+}
+
+// slotNote returns the index of the slot note with a given ID, or -1 if there is none
+func (cp *Carpark) slotNote(id string) int {
+	for i, n := range cp.SlotNotes {
+		if n.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,65 @@
+package parking
+
+import "time"
+
+// Mismatch is a vehicle found parked in a slot too small for it, with the slot suggested for moving it to
+type Mismatch struct {
+	Slot         int         `json:"slot"`
+	Registration string      `json:"registration"`
+	Size         SlotSize    `json:"size"`    // Size of the slot the vehicle is parked in
+	Vehicle      VehicleType `json:"vehicle"` // Type the vehicle turned out to be
+	Source       string      `json:"source,omitempty"`
+	Target       int         `json:"target,omitempty"` // Free slot the vehicle fits, zero if there was none
+	Time         time.Time   `json:"time"`
+}
+
+// ReportSizeMismatch records that the parked vehicle with a given registration number is of a type too big
+// for its slot, as flagged by a sensor or an attendant, and suggests the free slot the vehicle would be given
+// now. The slot is not held for the move. It returns ErrNoMismatch if the vehicle fits its slot.
+func (cp *Carpark) ReportSizeMismatch(registration string, vehicle VehicleType, source string) (Mismatch, error) {
+	if _, err := ParseVehicleType(string(vehicle)); err != nil {
+		return Mismatch{}, err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return Mismatch{}, ErrEvacuating
+	}
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return Mismatch{}, ErrNotFound
+	}
+	if vehicle.fits(cp.sizeOf(slotNo)) {
+		return Mismatch{}, ErrNoMismatch
+	}
+
+	now := cp.now()
+	allocate := cp.allocate
+	if cp.Slots[slotNo].Permit {
+		allocate = cp.allocatePermit
+	}
+	target, _ := allocate(now, vehicle)
+	cp.emit(SizeMismatchReported{Slot: slotNo, Registration: registration, Vehicle: vehicle, Source: source, Target: target, Time: now})
+	return cp.Mismatches[len(cp.Mismatches)-1], nil
+}
+
+// OpenMismatches returns the latest report for each vehicle still parked in the slot it was found in,
+// oldest first
+func (cp *Carpark) OpenMismatches() []Mismatch {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	latest := make(map[string]int)
+	for i, m := range cp.Mismatches {
+		latest[m.Registration] = i
+	}
+	open := make([]Mismatch, 0)
+	for i, m := range cp.Mismatches {
+		if car, ok := cp.Slots[m.Slot]; ok && car.Registration == m.Registration && latest[m.Registration] == i {
+			open = append(open, m)
+		}
+	}
+	return open
+}
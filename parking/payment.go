@@ -0,0 +1,184 @@
+package parking
+
+import (
+	"context"
+	"fmt"
+)
+
+// PaymentGateway collects the fees billed at exit from a payment provider. Implementations must be
+// safe for concurrent use; a charge the provider declines is reported as ErrPaymentDeclined.
+type PaymentGateway interface {
+	// Charge collects an amount and returns the provider's ID for the payment
+	Charge(ctx context.Context, req ChargeRequest) (string, error)
+	// Refund returns part or all of a payment to the driver
+	Refund(ctx context.Context, req RefundRequest) error
+	// Status returns how far a payment has got
+	Status(ctx context.Context, paymentID string) (PaymentStatus, error)
+}
+
+// ChargeRequest is an amount to collect for a stay
+type ChargeRequest struct {
+	Amount    int    // In the currency's minor unit
+	Reference string // Ticket ID of the stay, so a retried charge is only collected once
+	Method    string // Provider's token for the driver's card, such as a Stripe PaymentMethod ID
+}
+
+// RefundRequest is an amount to return from a payment
+type RefundRequest struct {
+	PaymentID string
+	Amount    int // In the currency's minor unit
+	Sequence  int // Number of the refund among those of the payment, from 1, so a retried refund is only made once
+}
+
+// PaymentStatus tells how far a payment has got with the provider
+type PaymentStatus string
+
+const (
+	// PaymentPending is a payment the provider is still processing
+	PaymentPending PaymentStatus = "pending"
+	// PaymentSucceeded is a payment that was collected
+	PaymentSucceeded PaymentStatus = "succeeded"
+	// PaymentFailed is a payment that was declined or cancelled
+	PaymentFailed PaymentStatus = "failed"
+	// PaymentRefunded is a payment that was refunded in full
+	PaymentRefunded PaymentStatus = "refunded"
+)
+
+// PayAndExit bills the car with a given registration number, collects the amount through the Gateway
+// with the driver's payment method and frees its slot once paid. The car stays parked if the payment
+// fails. The lot is not locked while the gateway is called, but the stay is marked as being paid for,
+// so another PayAndExit or a service or charging session added to the bill meanwhile fails with
+// ErrExitInProgress.
+func (cp *Carpark) PayAndExit(ctx context.Context, registration string, method string) (Bill, error) {
+	if cp.Gateway == nil {
+		return Bill{}, ErrNoGateway
+	}
+
+	bill, err := cp.startExit(registration)
+	if err != nil {
+		return Bill{}, err
+	}
+	if bill.Amount > 0 {
+		bill.PaymentID, err = cp.Gateway.Charge(ctx, ChargeRequest{Amount: bill.Amount, Reference: bill.Ticket, Method: method})
+	}
+
+	cp.mu.Lock()
+	delete(cp.exiting, bill.Ticket)
+	if err != nil {
+		cp.mu.Unlock()
+		return Bill{}, err
+	}
+	car, exists := cp.Slots[bill.Slot]
+	if !exists || car.Ticket != bill.Ticket {
+		recorded := cp.paymentRecorded(bill.PaymentID)
+		cp.mu.Unlock()
+		// The car left by another exit while the payment was taken. A payment the lot has recorded
+		// was that exit's, so it is kept.
+		if bill.PaymentID != "" && !recorded {
+			if err := cp.Gateway.Refund(ctx, RefundRequest{PaymentID: bill.PaymentID, Amount: bill.Amount, Sequence: 1}); err != nil {
+				return Bill{}, fmt.Errorf("car already left and refunding payment %s failed: %w", bill.PaymentID, err)
+			}
+		}
+		return Bill{}, ErrNotFound
+	}
+	cp.leaveBilled(bill, bill.PaymentID)
+	cp.mu.Unlock()
+
+	return bill, nil
+}
+
+// startExit bills the car with a given registration number and marks its stay as being paid for
+func (cp *Carpark) startExit(registration string) (Bill, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return Bill{}, ErrNotFound
+	}
+	ticket := cp.Slots[slotNo].Ticket
+	if cp.exiting[ticket] {
+		return Bill{}, ErrExitInProgress
+	}
+
+	if cp.exiting == nil {
+		cp.exiting = make(map[string]bool)
+	}
+	cp.exiting[ticket] = true
+	return cp.bill(slotNo, cp.now()), nil
+}
+
+// paymentRecorded reports whether a payment collected through the Gateway is recorded for a stay
+func (cp *Carpark) paymentRecorded(paymentID string) bool {
+	for _, p := range cp.Payments {
+		if paymentID != "" && p.PaymentID == paymentID {
+			return true
+		}
+	}
+	return false
+}
+
+// Refund returns part or all of a payment collected by PayAndExit through the Gateway. The amount is
+// reserved while the gateway makes the refund, so only one refund of a payment can be in progress at a time.
+func (cp *Carpark) Refund(ctx context.Context, paymentID string, amount int) error {
+	if cp.Gateway == nil {
+		return ErrNoGateway
+	}
+
+	sequence, err := cp.reserveRefund(paymentID, amount)
+	if err != nil {
+		return err
+	}
+	err = cp.Gateway.Refund(ctx, RefundRequest{PaymentID: paymentID, Amount: amount, Sequence: sequence})
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	delete(cp.refunding, paymentID)
+	if err != nil {
+		return err
+	}
+	cp.emit(RefundIssued{PaymentID: paymentID, Amount: amount, Time: cp.now()})
+	return nil
+}
+
+// reserveRefund checks that amount can be refunded of a payment and holds it until the refund is made
+// or fails, returning the sequence number of the refund
+func (cp *Carpark) reserveRefund(paymentID string, amount int) (int, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if cp.evacuating() {
+		return 0, ErrEvacuating
+	}
+	refundable, sequence, found := 0, 0, false
+	for _, p := range cp.Payments {
+		if p.PaymentID != "" && p.PaymentID == paymentID {
+			refundable, sequence, found = p.Amount-p.Refunded, p.Refunds+1, true
+		}
+	}
+	if !found {
+		return 0, ErrNotFound
+	}
+	// A refund that failed may still reach the provider, so the next one reuses its sequence number
+	// rather than racing it with another
+	if _, ok := cp.refunding[paymentID]; ok {
+		return 0, ErrRefundInProgress
+	}
+	if amount <= 0 || amount > refundable {
+		return 0, ErrRefundAmount
+	}
+
+	if cp.refunding == nil {
+		cp.refunding = make(map[string]int)
+	}
+	cp.refunding[paymentID] = amount
+	return sequence, nil
+}
+
+// PaymentStatus asks the Gateway how far a payment has got
+func (cp *Carpark) PaymentStatus(ctx context.Context, paymentID string) (PaymentStatus, error) {
+	if cp.Gateway == nil {
+		return "", ErrNoGateway
+	}
+	return cp.Gateway.Status(ctx, paymentID)
+}
@@ -0,0 +1,108 @@
+package parking
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// blockingGateway is a PaymentGateway whose refunds wait for release, failing with fail if it is set
+type blockingGateway struct {
+	entered chan RefundRequest // Receives each refund as it reaches the gateway
+	release chan struct{}
+
+	mu   sync.Mutex
+	fail error
+}
+
+func newBlockingGateway() *blockingGateway {
+	return &blockingGateway{entered: make(chan RefundRequest, 4), release: make(chan struct{})}
+}
+
+func (g *blockingGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	return "pay_1", nil
+}
+
+func (g *blockingGateway) Refund(ctx context.Context, req RefundRequest) error {
+	g.entered <- req
+	<-g.release
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.fail
+}
+
+func (g *blockingGateway) Status(ctx context.Context, paymentID string) (PaymentStatus, error) {
+	return PaymentSucceeded, nil
+}
+
+// refundedOf returns the amount refunded of a payment so far
+func refundedOf(cp *Carpark, paymentID string) int {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	for _, p := range cp.Payments {
+		if p.PaymentID == paymentID {
+			return p.Refunded
+		}
+	}
+	return 0
+}
+
+func TestRefundInProgress(t *testing.T) {
+	ctx := context.Background()
+	gateway := newBlockingGateway()
+	cp := &Carpark{Gateway: gateway, Rates: RateCard{FlatFee: 500, FlatHours: 1}}
+	cp.CreateParkingLot(2)
+	if _, err := cp.Park("KA-01", "White"); err != nil {
+		t.Fatal(err)
+	}
+	bill, err := cp.PayAndExit(ctx, "KA-01", "pm_card_visa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The gateway fails the first refund after a second one has been turned away
+	gateway.fail = errors.New("gateway timed out")
+	done := make(chan error)
+	go func() { done <- cp.Refund(ctx, bill.PaymentID, 500) }()
+	first := <-gateway.entered
+	if err := cp.Refund(ctx, bill.PaymentID, 100); !errors.Is(err, ErrRefundInProgress) {
+		t.Errorf("refund while another is in progress: got %v, want ErrRefundInProgress", err)
+	}
+	gateway.release <- struct{}{}
+	if err := <-done; err == nil {
+		t.Fatal("failed refund returned no error")
+	}
+	if got := refundedOf(cp, bill.PaymentID); got != 0 {
+		t.Errorf("failed refund recorded %d as refunded", got)
+	}
+
+	// The failed refund no longer holds the payment, and its retry has the same sequence number
+	gateway.mu.Lock()
+	gateway.fail = nil
+	gateway.mu.Unlock()
+	go func() { done <- cp.Refund(ctx, bill.PaymentID, 300) }()
+	if retry := <-gateway.entered; retry.Sequence != first.Sequence {
+		t.Errorf("retry has sequence number %d, want %d", retry.Sequence, first.Sequence)
+	}
+	gateway.release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { done <- cp.Refund(ctx, bill.PaymentID, 200) }()
+	if next := <-gateway.entered; next.Sequence != first.Sequence+1 {
+		t.Errorf("next refund has sequence number %d, want %d", next.Sequence, first.Sequence+1)
+	}
+	gateway.release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := refundedOf(cp, bill.PaymentID); got != 500 {
+		t.Errorf("refunded %d, want 500", got)
+	}
+	if err := cp.Refund(ctx, bill.PaymentID, 1); !errors.Is(err, ErrRefundAmount) {
+		t.Errorf("refund beyond the payment: got %v, want ErrRefundAmount", err)
+	}
+}
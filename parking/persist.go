@@ -0,0 +1,213 @@
+package parking
+
+import (
+	"container/heap"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshot is the JSON form of the lot state written by Save. The color,
+// registration and ticket indexes are rebuilt from the slots on Load.
+type snapshot struct {
+	MaxSlots        int                       `json:"max_slots"`
+	NextSlot        int                       `json:"next_slot,omitempty"` // Written by older versions, which kept slots from it up out of the free pool
+	Floors          []Floor                   `json:"floors,omitempty"`
+	SlotSizes       map[int]SlotSize          `json:"slot_sizes,omitempty"`
+	Chargers        map[int]bool              `json:"chargers,omitempty"`
+	Accessible      map[int]bool              `json:"accessible,omitempty"`
+	Reserved        map[int]string            `json:"reserved,omitempty"`
+	Strategy        AllocationStrategy        `json:"strategy"`
+	Slots           map[int]*Car              `json:"slots"`
+	EmptySlots      []int                     `json:"empty_slots"`
+	RotationQueue   []int                     `json:"rotation_queue"`
+	Cooling         map[int]time.Time         `json:"cooling"`
+	Cleaning        map[int]time.Time         `json:"cleaning"`
+	CleaningDue     []int                     `json:"cleaning_due"`
+	CleaningCursor  int                       `json:"cleaning_cursor"`
+	CleaningWindow  time.Time                 `json:"cleaning_window"`
+	Bookings        map[string]*Booking       `json:"bookings"`
+	Reservations    map[string]*Reservation   `json:"reservations"`
+	Departures      map[string]Departure      `json:"departures"`
+	Reconciliations []Reconciliation          `json:"reconciliations"`
+	Payments        []Payment                 `json:"payments"`
+	Mismatches      []Mismatch                `json:"mismatches"`
+	Charging        []ChargingSession         `json:"charging"`
+	Evacuation      *Evacuation               `json:"evacuation,omitempty"`
+	Violations      []Violation               `json:"violations"`
+	Queues          []QueueSample             `json:"queues"`
+	SlotNotes       []SlotNote                `json:"slot_notes"`
+	Assets          map[int]map[string]string `json:"assets"`
+	UsageCount      map[int]int               `json:"usage_count"`
+	VacantSince     map[int]time.Time         `json:"vacant_since"`
+	Arrivals        map[string]map[string]int `json:"arrivals"`
+	LastEvent       uint64                    `json:"last_event"`
+}
+
+// Save writes the lot state to a JSON file, replacing it only once the new contents are fully written and synced to disk
+func (cp *Carpark) Save(path string) error {
+	data, err := cp.marshalSnapshot()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Sync before the rename, or a crash could leave the state file renamed but empty
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// marshalSnapshot encodes the lot state as JSON
+func (cp *Carpark) marshalSnapshot() ([]byte, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	return json.Marshal(snapshot{
+		MaxSlots:        cp.MaxSlots,
+		Floors:          cp.Floors,
+		SlotSizes:       cp.SlotSizes,
+		Chargers:        cp.Chargers,
+		Accessible:      cp.Accessible,
+		Reserved:        cp.Reserved,
+		Strategy:        cp.Strategy,
+		Slots:           cp.Slots,
+		EmptySlots:      cp.EmptySlots,
+		RotationQueue:   cp.RotationQueue,
+		Cooling:         cp.Cooling,
+		Cleaning:        cp.Cleaning,
+		CleaningDue:     cp.CleaningDue,
+		CleaningCursor:  cp.CleaningCursor,
+		CleaningWindow:  cp.CleaningWindow,
+		Bookings:        cp.Bookings,
+		Reservations:    cp.Reservations,
+		Departures:      cp.Departures,
+		Reconciliations: cp.Reconciliations,
+		Payments:        cp.Payments,
+		Mismatches:      cp.Mismatches,
+		Charging:        cp.Charging,
+		Evacuation:      cp.Evacuation,
+		Violations:      cp.Violations,
+		Queues:          cp.Queues,
+		SlotNotes:       cp.SlotNotes,
+		Assets:          cp.Assets,
+		UsageCount:      cp.UsageCount,
+		VacantSince:     cp.VacantSince,
+		Arrivals:        cp.Arrivals,
+		LastEvent:       cp.LastEvent,
+	})
+}
+
+// Load replaces the lot state with the contents of a file written by Save
+func (cp *Carpark) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.MaxSlots = snap.MaxSlots
+	cp.Floors = snap.Floors
+	cp.SlotSizes = snap.SlotSizes
+	cp.Chargers = snap.Chargers
+	cp.Accessible = snap.Accessible
+	cp.Reserved = snap.Reserved
+	cp.indexReservedSlots()
+	cp.Strategy = snap.Strategy
+	cp.Slots = orEmpty(snap.Slots)
+	cp.EmptySlots = IntHeap(snap.EmptySlots)
+	heap.Init(&cp.EmptySlots)
+	cp.gateHeaps = nil
+	cp.RotationQueue = snap.RotationQueue
+	cp.Cooling = orEmpty(snap.Cooling)
+	cp.Cleaning = orEmpty(snap.Cleaning)
+	cp.CleaningDue = snap.CleaningDue
+	cp.CleaningCursor = snap.CleaningCursor
+	cp.CleaningWindow = snap.CleaningWindow
+	cp.Bookings = orEmpty(snap.Bookings)
+	cp.Reservations = orEmpty(snap.Reservations)
+	cp.holds = nil
+	cp.Departures = orEmpty(snap.Departures)
+	cp.Reconciliations = snap.Reconciliations
+	cp.Payments = snap.Payments
+	cp.Mismatches = snap.Mismatches
+	cp.Charging = snap.Charging
+	cp.Evacuation = snap.Evacuation
+	cp.Violations = snap.Violations
+	cp.Queues = snap.Queues
+	cp.SlotNotes = snap.SlotNotes
+	cp.Assets = snap.Assets
+	cp.UsageCount = orEmpty(snap.UsageCount)
+	cp.VacantSince = orEmpty(snap.VacantSince)
+	cp.Arrivals = orEmpty(snap.Arrivals)
+	cp.LastEvent = snap.LastEvent
+
+	cp.ColorMap = make(map[string]map[int]struct{})
+	cp.colors = make(map[string]string)
+	cp.colorPeaks = make(map[string]int)
+	cp.RegMap = make(map[string]int)
+	cp.Tickets = make(map[string]int)
+	for slotNo, car := range cp.Slots {
+		cp.index(slotNo, car)
+	}
+	if snap.NextSlot > 0 {
+		cp.freeUnallocated(snap.NextSlot)
+	}
+	cp.buildGateHeaps()
+
+	// Older versions did not track vacancies, so their empty slots count as vacant from now
+	now := cp.now()
+	for i := 1; i <= cp.MaxSlots; i++ {
+		if _, occupied := cp.Slots[i]; !occupied && cp.VacantSince[i].IsZero() {
+			cp.VacantSince[i] = now
+		}
+	}
+
+	return nil
+}
+
+// freeUnallocated returns the slots from first up that are neither occupied nor held to the free pool
+func (cp *Carpark) freeUnallocated(first int) {
+	free := make(map[int]bool)
+	for _, slotNo := range cp.freeSlots() {
+		free[slotNo] = true
+	}
+	for slotNo := first; slotNo <= cp.MaxSlots; slotNo++ {
+		_, occupied := cp.Slots[slotNo]
+		_, cooling := cp.Cooling[slotNo]
+		_, cleaning := cp.Cleaning[slotNo]
+		if !occupied && !cooling && !cleaning && !free[slotNo] {
+			cp.pushFree(slotNo)
+		}
+	}
+}
+
+// orEmpty returns m, or an empty map if m is nil
+func orEmpty[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return make(map[K]V)
+	}
+	return m
+}
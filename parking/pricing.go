@@ -0,0 +1,39 @@
+package parking
+
+import "sort"
+
+// Pricer adjusts the hourly rates of the rate card for demand when a car is billed
+type Pricer interface {
+	// Rate returns the hourly rate to charge in place of rate while occupancy, from 0 to 1, of the slots are taken
+	Rate(rate int, occupancy float64) int
+}
+
+// PriceStep changes hourly rates by a percentage once the lot is at least a given share full
+type PriceStep struct {
+	Full    int `json:"full"`    // Percentage of slots taken from which the step applies
+	Percent int `json:"percent"` // Change to the rate, such as 25 for a quarter more or -10 for a tenth less
+}
+
+// OccupancyPricer is a Pricer that applies the step with the highest threshold the occupancy has reached
+type OccupancyPricer []PriceStep
+
+// Rate implements Pricer
+func (p OccupancyPricer) Rate(rate int, occupancy float64) int {
+	steps := append(OccupancyPricer(nil), p...)
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Full > steps[j].Full })
+
+	for _, step := range steps {
+		if occupancy*100 >= float64(step.Full) {
+			return rate * (100 + step.Percent) / 100
+		}
+	}
+	return rate
+}
+
+// occupancy returns the share of slots taken, from 0 to 1
+func (cp *Carpark) occupancy() float64 {
+	if cp.MaxSlots == 0 {
+		return 0
+	}
+	return float64(len(cp.Slots)) / float64(cp.MaxSlots)
+}
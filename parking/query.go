@@ -0,0 +1,253 @@
+package parking
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ParkedCar pairs a copy of a parked car with the slot it occupies
+type ParkedCar struct {
+	Slot int `json:"slot"`
+	Car
+}
+
+// OriginShare is the number and share of arrivals from one plate jurisdiction
+type OriginShare struct {
+	Jurisdiction string  `json:"jurisdiction"`
+	Cars         int     `json:"cars"`
+	Share        float64 `json:"share"` // Fraction of all arrivals in the period, between 0 and 1
+}
+
+// LotStats counts the slots by whether they are occupied, free or closed
+type LotStats struct {
+	Slots     int     `json:"slots"`
+	Occupied  int     `json:"occupied"`
+	Free      int     `json:"free"`
+	Closed    int     `json:"closed"`    // Slots held out of allocation while they cool down or are cleaned
+	Occupancy float64 `json:"occupancy"` // Share of slots occupied, from 0 to 1
+}
+
+// Stats counts the occupied, free and closed slots. A slot whose cool-down or cleaning is over counts as free.
+func (cp *Carpark) Stats() LotStats {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	now := cp.now()
+	stats := LotStats{Slots: cp.MaxSlots, Occupied: len(cp.Slots), Free: cp.freeCount(), Occupancy: cp.occupancy()}
+	for _, held := range []map[int]time.Time{cp.Cooling, cp.Cleaning} {
+		for _, until := range held {
+			if now.Before(until) {
+				stats.Closed++
+			} else {
+				stats.Free++
+			}
+		}
+	}
+	return stats
+}
+
+// Vacancy is how long a slot has stood empty
+type Vacancy struct {
+	Slot     int           `json:"slot"`
+	Since    time.Time     `json:"since"`
+	Duration time.Duration `json:"-"`
+	Hours    int           `json:"hours"` // Length of the vacancy in whole hours
+}
+
+// Vacancies returns the empty slots that have stood empty for at least min, longest vacant first
+func (cp *Carpark) Vacancies(min time.Duration) []Vacancy {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	now := cp.now()
+	vacancies := make([]Vacancy, 0)
+	for slotNo, since := range cp.VacantSince {
+		if d := now.Sub(since); d >= min {
+			vacancies = append(vacancies, Vacancy{Slot: slotNo, Since: since, Duration: d, Hours: int(d / time.Hour)})
+		}
+	}
+	sort.Slice(vacancies, func(i, j int) bool {
+		if !vacancies[i].Since.Equal(vacancies[j].Since) {
+			return vacancies[i].Since.Before(vacancies[j].Since)
+		}
+		return vacancies[i].Slot < vacancies[j].Slot
+	})
+	return vacancies
+}
+
+// Status returns the parked cars ordered by slot number
+func (cp *Carpark) Status() []ParkedCar {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.parkedCars()
+}
+
+// StatusDetail returns everything recorded about the car in a slot, including attendant notes
+func (cp *Carpark) StatusDetail(slotNo int) (ParkedCar, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	car, ok := cp.Slots[slotNo]
+	if !ok {
+		return ParkedCar{}, ErrSlotNotFound
+	}
+	return ParkedCar{Slot: slotNo, Car: *car}, nil
+}
+
+// FindCar returns the car with a given registration number and the slot it is parked in
+func (cp *Carpark) FindCar(registration string) (ParkedCar, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return ParkedCar{}, ErrNotFound
+	}
+	return ParkedCar{Slot: slotNo, Car: *cp.Slots[slotNo]}, nil
+}
+
+// slotsForColor returns the slots holding cars of the given color in ascending order
+func (cp *Carpark) slotsForColor(color string) []int {
+	slotNos := make([]int, 0, len(cp.ColorMap[color]))
+	for slotNo := range cp.ColorMap[color] {
+		slotNos = append(slotNos, slotNo)
+	}
+	sort.Ints(slotNos)
+	return slotNos
+}
+
+// EvidenceForRegistration returns the photo references attached to the car with a given registration number
+func (cp *Carpark) EvidenceForRegistration(registration string) ([]string, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return append([]string(nil), cp.Slots[slotNo].Evidence...), nil
+}
+
+// RegistrationNumbersForColor returns registration numbers of all cars with a particular color, ordered by slot
+func (cp *Carpark) RegistrationNumbersForColor(color string) ([]string, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	slotNos := cp.slotsForColor(color)
+	if len(slotNos) == 0 {
+		return nil, ErrNotFound
+	}
+
+	regNumbers := make([]string, 0, len(slotNos))
+	for _, slotNo := range slotNos {
+		if car, exists := cp.Slots[slotNo]; exists {
+			regNumbers = append(regNumbers, car.Registration)
+		}
+	}
+
+	return regNumbers, nil
+}
+
+// SlotNumbersForColor returns slot numbers of all slots where a car of a particular color is parked, in ascending order
+func (cp *Carpark) SlotNumbersForColor(color string) ([]int, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	slotNos := cp.slotsForColor(color)
+	if len(slotNos) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return slotNos, nil
+}
+
+// CarsForColor returns the cars of a particular color ordered by slot, none if no car of that color is parked
+func (cp *Carpark) CarsForColor(color string) []ParkedCar {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	slotNos := cp.slotsForColor(color)
+	cars := make([]ParkedCar, 0, len(slotNos))
+	for _, slotNo := range slotNos {
+		if car, exists := cp.Slots[slotNo]; exists {
+			cars = append(cars, ParkedCar{Slot: slotNo, Car: *car})
+		}
+	}
+	return cars
+}
+
+// SlotNumberForRegistrationNumber returns the slot number for a car with a given registration number
+func (cp *Carpark) SlotNumberForRegistrationNumber(registration string) (int, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return 0, ErrNotFound
+	}
+
+	return slotNo, nil
+}
+
+// SlotUsage returns how many times each slot has been allocated, indexed by slot number
+func (cp *Carpark) SlotUsage() map[int]int {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	usage := make(map[int]int, cp.MaxSlots)
+	for i := 1; i <= cp.MaxSlots; i++ {
+		usage[i] = cp.UsageCount[i]
+	}
+	return usage
+}
+
+// Jurisdiction returns the state or country prefix of a registration number, such as KA for KA-01-HH-1234
+func Jurisdiction(registration string) string {
+	prefix := strings.TrimLeftFunc(registration, unicode.IsSpace)
+	if i := strings.IndexFunc(prefix, func(r rune) bool { return !unicode.IsLetter(r) }); i >= 0 {
+		prefix = prefix[:i]
+	}
+	if prefix == "" {
+		return "Unknown"
+	}
+	return strings.ToUpper(prefix)
+}
+
+// OriginMix returns how many arrivals came from each jurisdiction between two days inclusive, most common first
+func (cp *Carpark) OriginMix(from time.Time, to time.Time) ([]OriginShare, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	first, last := from.Format(time.DateOnly), to.Format(time.DateOnly)
+
+	totals := make(map[string]int)
+	sum := 0
+	for day, counts := range cp.Arrivals {
+		if day < first || day > last {
+			continue
+		}
+		for jurisdiction, n := range counts {
+			totals[jurisdiction] += n
+			sum += n
+		}
+	}
+	if sum == 0 {
+		return nil, ErrNotFound
+	}
+
+	mix := make([]OriginShare, 0, len(totals))
+	for jurisdiction, n := range totals {
+		mix = append(mix, OriginShare{Jurisdiction: jurisdiction, Cars: n, Share: float64(n) / float64(sum)})
+	}
+	sort.Slice(mix, func(i, j int) bool {
+		if mix[i].Cars != mix[j].Cars {
+			return mix[i].Cars > mix[j].Cars
+		}
+		return mix[i].Jurisdiction < mix[j].Jurisdiction
+	})
+
+	return mix, nil
+}
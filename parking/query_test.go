@@ -0,0 +1,98 @@
+package parking
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestColorQueriesAfterRepark(t *testing.T) {
+	cp := &Carpark{}
+	cp.CreateParkingLot(5)
+	for _, car := range []struct{ registration, color string }{
+		{"KA-01", "White"}, {"KA-02", "White"}, {"KA-03", "Red"}, {"KA-04", "White"},
+	} {
+		if _, err := cp.Park(car.registration, car.color); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// KA-02 leaves slot 2 and comes back in another color, which puts it back in slot 2
+	if _, err := cp.Leave(2); err != nil {
+		t.Fatal(err)
+	}
+	if slotNo, err := cp.Park("KA-02", "Red"); err != nil || slotNo != 2 {
+		t.Fatalf("got slot %d, %v; want 2", slotNo, err)
+	}
+	checkColors(t, cp, map[string][]int{"White": {1, 4}, "Red": {2, 3}})
+
+	// KA-01 leaves and comes back in a new color in the same slot
+	if _, err := cp.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if slotNo, err := cp.Park("KA-01", "Blue"); err != nil || slotNo != 1 {
+		t.Fatalf("got slot %d, %v; want 1", slotNo, err)
+	}
+	checkColors(t, cp, map[string][]int{"White": {4}, "Red": {2, 3}, "Blue": {1}})
+
+	// The last white car leaves and a red one takes its slot
+	if _, err := cp.Leave(4); err != nil {
+		t.Fatal(err)
+	}
+	if slotNo, err := cp.Park("KA-04", "Red"); err != nil || slotNo != 4 {
+		t.Fatalf("got slot %d, %v; want 4", slotNo, err)
+	}
+	checkColors(t, cp, map[string][]int{"White": nil, "Red": {2, 3, 4}, "Blue": {1}})
+	checkInvariants(t, cp)
+}
+
+// checkColors fails the test unless the slots and registration numbers of the cars of each color are
+// the expected ones, ordered by slot, and the color index holds no slot whose car has another color
+func checkColors(t *testing.T, cp *Carpark, want map[string][]int) {
+	t.Helper()
+	for color, slots := range want {
+		got, err := cp.SlotNumbersForColor(color)
+		if len(slots) == 0 {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s: got slots %v, %v; want ErrNotFound", color, got, err)
+			}
+			if regs, err := cp.RegistrationNumbersForColor(color); !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s: got registrations %v, %v; want ErrNotFound", color, regs, err)
+			}
+			if cars := cp.CarsForColor(color); len(cars) != 0 {
+				t.Errorf("%s: got cars %v, want none", color, cars)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, slots) {
+			t.Errorf("%s: got slots %v, %v; want %v", color, got, err, slots)
+		}
+
+		var wantRegs []string
+		for _, slotNo := range slots {
+			wantRegs = append(wantRegs, cp.Slots[slotNo].Registration)
+		}
+		if regs, err := cp.RegistrationNumbersForColor(color); err != nil || !reflect.DeepEqual(regs, wantRegs) {
+			t.Errorf("%s: got registrations %v, %v; want %v", color, regs, err, wantRegs)
+		}
+
+		var carSlots []int
+		for _, parked := range cp.CarsForColor(color) {
+			carSlots = append(carSlots, parked.Slot)
+			if parked.Color != color || parked.Registration != cp.Slots[parked.Slot].Registration {
+				t.Errorf("%s: slot %d listed with %+v", color, parked.Slot, parked.Car)
+			}
+		}
+		if !reflect.DeepEqual(carSlots, slots) {
+			t.Errorf("%s: got cars in slots %v, want %v", color, carSlots, slots)
+		}
+	}
+
+	for color, slots := range cp.ColorMap {
+		for slotNo := range slots {
+			if car, ok := cp.Slots[slotNo]; !ok || car.Color != color {
+				t.Errorf("color index lists slot %d as %s, which holds %v", slotNo, color, car)
+			}
+		}
+	}
+}
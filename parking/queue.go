@@ -0,0 +1,179 @@
+package parking
+
+import (
+	"sort"
+	"time"
+)
+
+// queueWindow is how far back the entries through a gate are counted to judge how fast its queue moves
+const queueWindow = 15 * time.Minute
+
+// QueueSample is the length of the queue at an entry gate when it changed
+type QueueSample struct {
+	Gate    string    `json:"gate"`
+	Length  int       `json:"length"`
+	Entered bool      `json:"entered,omitempty"` // Whether the queue changed because a car entered through the gate
+	Time    time.Time `json:"time"`
+}
+
+// GateQueue is the queue at an entry gate with how long a car joining it can expect to wait, for the signs
+type GateQueue struct {
+	Gate        string        `json:"gate"`
+	Length      int           `json:"length"`
+	Wait        time.Duration `json:"-"`
+	WaitMinutes int           `json:"wait_minutes"` // Wait rounded up to whole minutes
+	Updated     time.Time     `json:"updated"`      // When the queue last changed, zero if it never has
+}
+
+// GateThroughput is how many cars entered through a gate in a period and how long its queue got
+type GateThroughput struct {
+	Gate      string `json:"gate"`
+	Entries   int    `json:"entries"`
+	PeakQueue int    `json:"peak_queue"`
+}
+
+// ReportQueue records the number of cars queued at an entry gate, as counted by an attendant or a sensor,
+// and returns the queue. It returns ErrQueueLength for a negative length.
+func (cp *Carpark) ReportQueue(gate string, length int) (GateQueue, error) {
+	if length < 0 {
+		return GateQueue{}, ErrQueueLength
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return GateQueue{}, ErrEvacuating
+	}
+	if !cp.hasGate(gate) {
+		return GateQueue{}, ErrGateNotFound
+	}
+
+	now := cp.now()
+	cp.emit(QueueChanged{Gate: gate, Length: length, Time: now})
+	return cp.gateQueue(gate, now), nil
+}
+
+// JoinQueue records a car joining the queue at an entry gate, as signalled by the gate, and returns the queue
+func (cp *Carpark) JoinQueue(gate string) (GateQueue, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return GateQueue{}, ErrEvacuating
+	}
+	if !cp.hasGate(gate) {
+		return GateQueue{}, ErrGateNotFound
+	}
+
+	now := cp.now()
+	cp.emit(QueueChanged{Gate: gate, Length: cp.queueLength(gate) + 1, Time: now})
+	return cp.gateQueue(gate, now), nil
+}
+
+// GateQueues returns the queue at each entry gate, in the order of Gates
+func (cp *Carpark) GateQueues() []GateQueue {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	now := cp.now()
+	queues := make([]GateQueue, 0, len(cp.Gates))
+	for _, g := range cp.Gates {
+		queues = append(queues, cp.gateQueue(g.Name, now))
+	}
+	return queues
+}
+
+// QueueHistory returns the changes to the queue at an entry gate between two times, oldest first
+func (cp *Carpark) QueueHistory(gate string, from time.Time, to time.Time) ([]QueueSample, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	if !cp.hasGate(gate) {
+		return nil, ErrGateNotFound
+	}
+	samples := make([]QueueSample, 0)
+	for _, s := range cp.Queues {
+		if s.Gate == gate && !s.Time.Before(from) && s.Time.Before(to) {
+			samples = append(samples, s)
+		}
+	}
+	return samples, nil
+}
+
+// GateThroughput counts the cars that entered through each gate between two days inclusive and the longest
+// its queue got, ordered by gate name
+func (cp *Carpark) GateThroughput(from time.Time, to time.Time) []GateThroughput {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	first, last := from.Format(time.DateOnly), to.Format(time.DateOnly)
+	byGate := make(map[string]*GateThroughput)
+	for _, g := range cp.Gates {
+		byGate[g.Name] = &GateThroughput{Gate: g.Name}
+	}
+	for _, s := range cp.Queues {
+		t, ok := byGate[s.Gate]
+		if day := s.Time.Format(time.DateOnly); !ok || day < first || day > last {
+			continue
+		}
+		if s.Entered {
+			t.Entries++
+		}
+		t.PeakQueue = max(t.PeakQueue, s.Length)
+	}
+
+	throughput := make([]GateThroughput, 0, len(byGate))
+	for _, t := range byGate {
+		throughput = append(throughput, *t)
+	}
+	sort.Slice(throughput, func(i, j int) bool { return throughput[i].Gate < throughput[j].Gate })
+	return throughput
+}
+
+// enterQueue records a car entering through a gate, taking it off the front of the gate's queue
+func (cp *Carpark) enterQueue(gate string, now time.Time) {
+	cp.emit(QueueChanged{Gate: gate, Length: max(0, cp.queueLength(gate)-1), Entered: true, Time: now})
+}
+
+// queueLength returns the number of cars last known to be queued at a gate
+func (cp *Carpark) queueLength(gate string) int {
+	if i := cp.lastSample(gate); i >= 0 {
+		return cp.Queues[i].Length
+	}
+	return 0
+}
+
+// lastSample returns the index of the latest change to the queue at a gate, or -1 if it has never changed
+func (cp *Carpark) lastSample(gate string) int {
+	for i := len(cp.Queues) - 1; i >= 0; i-- {
+		if cp.Queues[i].Gate == gate {
+			return i
+		}
+	}
+	return -1
+}
+
+// gateQueue returns the queue at a gate with its wait estimated from how fast cars entered through the gate
+// during the last queueWindow, or from EntryPace if none did
+func (cp *Carpark) gateQueue(gate string, now time.Time) GateQueue {
+	q := GateQueue{Gate: gate}
+	if i := cp.lastSample(gate); i >= 0 {
+		q.Length, q.Updated = cp.Queues[i].Length, cp.Queues[i].Time
+	}
+
+	pace := cp.EntryPace
+	if pace <= 0 {
+		pace = time.Minute
+	}
+	entries := 0
+	for i := len(cp.Queues) - 1; i >= 0 && now.Sub(cp.Queues[i].Time) < queueWindow; i-- {
+		if s := cp.Queues[i]; s.Gate == gate && s.Entered {
+			entries++
+		}
+	}
+	if entries > 0 {
+		pace = queueWindow / time.Duration(entries)
+	}
+	q.Wait = time.Duration(q.Length) * pace
+	q.WaitMinutes = int((q.Wait + time.Minute - 1) / time.Minute)
+	return q
+}
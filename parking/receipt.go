@@ -0,0 +1,31 @@
+package parking
+
+import (
+	"io"
+	"text/template"
+	"time"
+)
+
+// receiptTemplate renders a Bill as a printed receipt
+var receiptTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"amount": FormatAmount,
+	"time":   func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"hour":   func(t time.Time) string { return t.Format("Mon 15:04") },
+	"stay":   func(d time.Duration) string { return d.Round(time.Minute).String() },
+}).Parse(`Receipt
+Ticket:       {{.Ticket}}
+Registration: {{.Registration}}
+Slot:         {{.Slot}}
+Entry:        {{time .ParkedAt}}
+Exit:         {{time .LeftAt}}
+Duration:     {{stay .Duration}}
+{{range .Lines}}{{if .From}}{{printf "%-34s" (printf "%d h at %s from %s" .Hours (amount .Rate) (hour .From))}}{{else if .KWh}}{{printf "%-34s" (printf "%.2f kWh at %s" .KWh (amount .Rate))}}{{else if .Service}}{{printf "%-34s" .Description}}{{else}}{{printf "%-34s" (printf "%s, %d h" .Description .Hours)}}{{end}}{{printf "%10s" (amount .Amount)}}
+{{end}}{{if .Suspended}}Not charged: the lot was being evacuated
+{{end}}{{printf "%-34s" "Total"}}{{printf "%10s" (amount .Amount)}}
+`))
+
+// WriteReceipt renders the bill as a printed receipt with the ticket, entry and exit times, the
+// charges for the stay and the total
+func (b Bill) WriteReceipt(w io.Writer) error {
+	return receiptTemplate.Execute(w, b)
+}
@@ -0,0 +1,175 @@
+package parking
+
+import (
+	"sort"
+	"time"
+)
+
+// ReservationStatus tells what became of an advance reservation
+type ReservationStatus string
+
+const (
+	// ReservationPending is a reservation whose car has not arrived yet
+	ReservationPending ReservationStatus = "pending"
+	// ReservationArrived is a reservation whose car parked during its window
+	ReservationArrived ReservationStatus = "arrived"
+	// ReservationExpired is a reservation whose window ended without the car arriving
+	ReservationExpired ReservationStatus = "expired"
+)
+
+// Reservation is a slot held for a car over a window of time booked in advance. While the window is open the
+// slot is kept from other cars, and the reserved car arriving in it starts a normal stay.
+type Reservation struct {
+	ID           string            `json:"id"` // ULID, so reservations sort by when they were made
+	Registration string            `json:"registration"`
+	Slot         int               `json:"slot"`
+	From         time.Time         `json:"from"`
+	To           time.Time         `json:"to"`
+	Status       ReservationStatus `json:"status"`
+	Ticket       string            `json:"ticket"` // ID of the ticket of the stay the reservation turned into, if any
+	Time         time.Time         `json:"time"`   // When the reservation was made
+}
+
+// Reserve holds a slot for a car from one time to another and returns the reservation. The slot is the lowest
+// numbered standard or large slot without a reservation overlapping the window and, if the window has already
+// started, free now. It returns ErrReservationWindow unless the window ends after it starts and in the future,
+// ErrAlreadyReserved if the car has a pending reservation overlapping the window, and ErrFullyReserved if no
+// slot can be reserved.
+func (cp *Carpark) Reserve(registration string, from time.Time, to time.Time) (Reservation, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return Reservation{}, ErrEvacuating
+	}
+
+	if !cp.validPlate(registration) {
+		return Reservation{}, ErrInvalidRegistration
+	}
+	now := cp.now()
+	if !from.Before(to) || !now.Before(to) {
+		return Reservation{}, ErrReservationWindow
+	}
+	for _, r := range cp.Reservations {
+		if r.Registration == registration && r.Status == ReservationPending && r.From.Before(to) && from.Before(r.To) {
+			return Reservation{}, ErrAlreadyReserved
+		}
+	}
+
+	// A window that has started holds its slot at once, so the slot must be free now rather than occupied,
+	// cooling down or held for cleaning
+	var free map[int]bool
+	if !now.Before(from) {
+		cp.releaseHeldSlots(now)
+		free = make(map[int]bool)
+		for _, slotNo := range cp.freeSlots() {
+			free[slotNo] = true
+		}
+	}
+	for slotNo := 1; slotNo <= cp.MaxSlots; slotNo++ {
+		if _, reserved := cp.Reserved[slotNo]; reserved || cp.Accessible[slotNo] || !VehicleCar.fits(cp.sizeOf(slotNo)) ||
+			cp.reservedDuring(slotNo, from, to) || free != nil && !free[slotNo] {
+			continue
+		}
+		id := newULID(now)
+		cp.emit(ReservationMade{Reservation: id, Registration: registration, Slot: slotNo, From: from, To: to, Time: now})
+		return *cp.Reservations[id], nil
+	}
+	return Reservation{}, ErrFullyReserved
+}
+
+// AdvanceReservation returns a reservation by ID
+func (cp *Carpark) AdvanceReservation(id string) (Reservation, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	r, ok := cp.Reservations[id]
+	if !ok {
+		return Reservation{}, ErrNotFound
+	}
+	return *r, nil
+}
+
+// UpcomingReservations returns the pending reservations whose window has not ended, soonest first
+func (cp *Carpark) UpcomingReservations() []Reservation {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	now := cp.now()
+	upcoming := make([]Reservation, 0)
+	for _, r := range cp.Reservations {
+		if r.Status == ReservationPending && now.Before(r.To) {
+			upcoming = append(upcoming, *r)
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		if !upcoming[i].From.Equal(upcoming[j].From) {
+			return upcoming[i].From.Before(upcoming[j].From)
+		}
+		return upcoming[i].ID < upcoming[j].ID
+	})
+	return upcoming
+}
+
+// ExpireReservations marks pending reservations whose window has ended as expired and returns them.
+// It does nothing during an evacuation.
+func (cp *Carpark) ExpireReservations() []Reservation {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return nil
+	}
+
+	now := cp.now()
+	var ids []string
+	for id, r := range cp.Reservations {
+		if r.Status == ReservationPending && !now.Before(r.To) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+
+	cp.emit(ReservationsExpired{Reservations: ids, Time: now})
+
+	expired := make([]Reservation, 0, len(ids))
+	for _, id := range ids {
+		expired = append(expired, *cp.Reservations[id])
+	}
+	return expired
+}
+
+// reservedDuring reports whether a pending reservation holds a slot at any time between from and to
+func (cp *Carpark) reservedDuring(slotNo int, from time.Time, to time.Time) bool {
+	for _, r := range cp.Reservations {
+		if r.Slot == slotNo && r.Status == ReservationPending && r.From.Before(to) && from.Before(r.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeReservation returns the ID of the pending reservation for a car whose window is open at now, if any
+func (cp *Carpark) activeReservation(registration string, now time.Time) (string, bool) {
+	for id, r := range cp.Reservations {
+		if r.Status == ReservationPending && r.Registration == registration && !now.Before(r.From) && now.Before(r.To) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// holdReservedSlots rebuilds the set of slots held for pending reservations whose window is open at now
+func (cp *Carpark) holdReservedSlots(now time.Time) {
+	clear(cp.holds)
+	for id, r := range cp.Reservations {
+		if r.Status != ReservationPending || now.Before(r.From) || !now.Before(r.To) {
+			continue
+		}
+		if cp.holds == nil {
+			cp.holds = make(map[int]string)
+		}
+		cp.holds[r.Slot] = id
+	}
+}
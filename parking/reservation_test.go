@@ -0,0 +1,64 @@
+package parking
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReserveOverlappingSameCar(t *testing.T) {
+	now := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	cp := &Carpark{Clock: fixedClock(now)}
+	cp.CreateParkingLot(3)
+
+	at := func(hour int) time.Time { return now.Add(time.Duration(hour) * time.Hour) }
+	if _, err := cp.Reserve("KA-01", at(2), at(4)); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []struct{ from, to int }{{3, 5}, {1, 3}, {2, 4}, {1, 6}} {
+		if _, err := cp.Reserve("KA-01", at(w.from), at(w.to)); !errors.Is(err, ErrAlreadyReserved) {
+			t.Errorf("reserve %d:00 to %d:00 over 11:00 to 13:00: got %v, want ErrAlreadyReserved", 9+w.from, 9+w.to, err)
+		}
+	}
+	// Back to back windows and other cars are fine
+	if _, err := cp.Reserve("KA-01", at(4), at(5)); err != nil {
+		t.Errorf("reserve right after the first window: %v", err)
+	}
+	if r, err := cp.Reserve("KA-02", at(2), at(4)); err != nil || r.Slot != 2 {
+		t.Errorf("another car reserved slot %d, %v; want slot 2", r.Slot, err)
+	}
+	if n := len(cp.UpcomingReservations()); n != 3 {
+		t.Errorf("%d reservations pending, want 3", n)
+	}
+}
+
+func TestReserveStartedWindow(t *testing.T) {
+	now := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	cp := &Carpark{Clock: fixedClock(now), GracePeriod: 10 * time.Minute}
+	cp.CreateParkingLot(4)
+
+	// Slot 1 is occupied and slot 2 cooling down after its car left
+	for _, registration := range []string{"KA-01", "KA-02"} {
+		if _, err := cp.Park(registration, "White"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cp.Leave(2); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := cp.Reserve("MH-01", now.Add(-time.Minute), now.Add(time.Hour))
+	if err != nil || r.Slot != 3 {
+		t.Fatalf("reserved slot %d, %v for a window already open; want the free slot 3", r.Slot, err)
+	}
+	// A window still to come may take a slot that is occupied now
+	if r, err := cp.Reserve("MH-02", now.Add(2*time.Hour), now.Add(3*time.Hour)); err != nil || r.Slot != 1 {
+		t.Errorf("reserved slot %d, %v for a later window; want slot 1", r.Slot, err)
+	}
+	if _, err := cp.Reserve("MH-03", now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cp.Reserve("MH-04", now, now.Add(time.Hour)); !errors.Is(err, ErrFullyReserved) {
+		t.Errorf("reserve with no free slot left: got %v, want ErrFullyReserved", err)
+	}
+}
@@ -0,0 +1,51 @@
+package parking
+
+import "time"
+
+// indexReservedSlots rebuilds the index of reserved slots by registration number
+func (cp *Carpark) indexReservedSlots() {
+	cp.reservedSlots = make(map[string]int, len(cp.Reserved))
+	for slotNo, registration := range cp.Reserved {
+		cp.reservedSlots[registration] = slotNo
+	}
+}
+
+// ownSlot returns the slot reserved for a registration number, or else the slot held for its advance reservation,
+// reporting false if it has neither, the vehicle does not fit it or it is not free. A reserved slot still in its
+// grace period is free for its own car.
+func (cp *Carpark) ownSlot(registration string, vehicle VehicleType, now time.Time) (int, bool) {
+	cp.releaseHeldSlots(now)
+	if slotNo, ok := cp.reservedSlots[registration]; ok && vehicle.fits(cp.sizeOf(slotNo)) {
+		if _, cooling := cp.Cooling[slotNo]; cooling || cp.isFree(slotNo) {
+			return slotNo, true
+		}
+	}
+	if id, ok := cp.activeReservation(registration, now); ok {
+		slotNo := cp.Reservations[id].Slot
+		if vehicle.fits(cp.sizeOf(slotNo)) && cp.isFree(slotNo) {
+			return slotNo, true
+		}
+	}
+	return 0, false
+}
+
+// owns reports whether a slot is reserved for a registration number or held for its advance reservation
+func (cp *Carpark) owns(registration string, slotNo int) bool {
+	if owned, ok := cp.reservedSlots[registration]; ok && owned == slotNo {
+		return true
+	}
+	id, held := cp.holds[slotNo]
+	return held && cp.Reservations[id].Registration == registration
+}
+
+// ReservedSlot returns the slot reserved for a registration number, or ErrNotFound if it has none
+func (cp *Carpark) ReservedSlot(registration string) (int, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	slotNo, ok := cp.reservedSlots[registration]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return slotNo, nil
+}
@@ -0,0 +1,151 @@
+package parking
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Payment is the amount billed for a stay by Exit, with the commission owed to the partner that booked it
+type Payment struct {
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Amount       int       `json:"amount"`
+	Booking      string    `json:"booking,omitempty"` // ID of the partner booking the car arrived on
+	Partner      string    `json:"partner,omitempty"`
+	Commission   int       `json:"commission,omitempty"` // Amount owed to the partner
+	PaymentID    string    `json:"payment_id,omitempty"` // Payment gateway's ID for the amount collected
+	Refunded     int       `json:"refunded,omitempty"`   // Amount refunded through the payment gateway
+	Refunds      int       `json:"refunds,omitempty"`    // Number of refunds issued, which numbers the next one
+	Time         time.Time `json:"time"`
+}
+
+// RevenueReport totals the amounts billed between two days and what each partner is owed for them
+type RevenueReport struct {
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Stays       int          `json:"stays"`    // Stays billed
+	Revenue     int          `json:"revenue"`  // Amount billed for all stays
+	Refunded    int          `json:"refunded"` // Amount refunded for the stays
+	Commissions []Commission `json:"commissions"`
+}
+
+// Commission is what a partner is owed for the stays it booked in a period, for invoicing
+type Commission struct {
+	Partner  string `json:"partner"`
+	Bookings int    `json:"bookings"` // Bookings made for days in the period
+	NoShows  int    `json:"no_shows"`
+	Stays    int    `json:"stays"`  // Booked stays billed in the period
+	Billed   int    `json:"billed"` // Amount billed for the booked stays
+	Owed     int    `json:"owed"`
+}
+
+// commission returns the amount owed to the partner behind a booking for a stay billed amount
+func (cp *Carpark) commission(bookingID string, amount int) int {
+	b, ok := cp.Bookings[bookingID]
+	if !ok {
+		return 0
+	}
+	p, ok := cp.partner(b.Partner)
+	if !ok {
+		return 0
+	}
+	return amount * p.Commission / 100
+}
+
+// recordPayment keeps the amount billed for a car leaving, attributed to the partner that booked the stay
+func (cp *Carpark) recordPayment(e CarLeft, car *Car) {
+	payment := Payment{
+		Slot:         e.Slot,
+		Registration: e.Registration,
+		Amount:       e.Amount,
+		Booking:      car.Booking,
+		Commission:   e.Commission,
+		PaymentID:    e.PaymentID,
+		Time:         e.Time,
+	}
+	if b, ok := cp.Bookings[car.Booking]; ok {
+		payment.Partner = b.Partner
+	}
+	cp.Payments = append(cp.Payments, payment)
+}
+
+// RevenueReport totals the stays billed between two days inclusive and the commission owed to each partner
+func (cp *Carpark) RevenueReport(from time.Time, to time.Time) RevenueReport {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	report := RevenueReport{From: from.Format(time.DateOnly), To: to.Format(time.DateOnly)}
+	inPeriod := func(day string) bool { return day >= report.From && day <= report.To }
+
+	byPartner := make(map[string]*Commission)
+	commission := func(partner string) *Commission {
+		if byPartner[partner] == nil {
+			byPartner[partner] = &Commission{Partner: partner}
+		}
+		return byPartner[partner]
+	}
+	for _, p := range cp.Aggregators.Partners {
+		commission(p.Name)
+	}
+
+	for _, b := range cp.Bookings {
+		if !inPeriod(b.Date) {
+			continue
+		}
+		c := commission(b.Partner)
+		c.Bookings++
+		if b.Status == BookingNoShow {
+			c.NoShows++
+		}
+	}
+
+	for _, p := range cp.Payments {
+		if !inPeriod(p.Time.Format(time.DateOnly)) {
+			continue
+		}
+		report.Stays++
+		report.Revenue += p.Amount
+		report.Refunded += p.Refunded
+		if p.Partner == "" {
+			continue
+		}
+		c := commission(p.Partner)
+		c.Stays++
+		c.Billed += p.Amount
+		c.Owed += p.Commission
+	}
+
+	report.Commissions = make([]Commission, 0, len(byPartner))
+	for _, c := range byPartner {
+		report.Commissions = append(report.Commissions, *c)
+	}
+	sort.Slice(report.Commissions, func(i, j int) bool {
+		return report.Commissions[i].Partner < report.Commissions[j].Partner
+	})
+
+	return report
+}
+
+// WriteCommissionsCSV writes the commission owed to each partner as CSV with a header row, for invoicing.
+// Amounts are formatted with FormatAmount.
+func (r RevenueReport) WriteCommissionsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"partner", "from", "to", "bookings", "no_shows", "stays", "billed", "owed"})
+	for _, c := range r.Commissions {
+		cw.Write([]string{
+			c.Partner,
+			r.From,
+			r.To,
+			strconv.Itoa(c.Bookings),
+			strconv.Itoa(c.NoShows),
+			strconv.Itoa(c.Stays),
+			FormatAmount(c.Billed),
+			FormatAmount(c.Owed),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,85 @@
+package parking
+
+import (
+	"fmt"
+	"time"
+)
+
+// Service is a paid extra a lot offers for a stay, such as a car wash or an EV fast-charge premium
+type Service struct {
+	Name        string `json:"name"`                  // Name the service is ordered by, such as "car_wash"
+	Description string `json:"description,omitempty"` // Text printed on the bill, the name if empty
+	Price       int    `json:"price"`
+}
+
+// OrderedService is a service added to a stay at the price it had when it was ordered
+type OrderedService struct {
+	Name  string    `json:"name"`
+	Price int       `json:"price"`
+	Time  time.Time `json:"time"`
+}
+
+// validate checks that the service can be ordered by name and does not pay the driver
+func (s Service) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("service needs a name")
+	}
+	if s.Price < 0 {
+		return fmt.Errorf("service %s has a negative price", s.Name)
+	}
+	return nil
+}
+
+// service returns the service with a given name from the rate card, reporting false if it offers none
+func (rc RateCard) service(name string) (Service, bool) {
+	for _, s := range rc.Services {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+// ServiceCatalog returns the services the lot offers
+func (cp *Carpark) ServiceCatalog() []Service {
+	return append([]Service{}, cp.Rates.Services...)
+}
+
+// AddService adds a service from the rate card to the stay of the parked car with a given registration number,
+// to be billed when it leaves, and returns the services ordered for the stay so far. It returns
+// ErrUnknownService if the lot does not offer the service.
+func (cp *Carpark) AddService(registration string, name string) ([]OrderedService, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return nil, ErrEvacuating
+	}
+
+	slotNo, exists := cp.RegMap[registration]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if cp.exiting[cp.Slots[slotNo].Ticket] {
+		return nil, ErrExitInProgress
+	}
+	s, ok := cp.Rates.service(name)
+	if !ok {
+		return nil, ErrUnknownService
+	}
+
+	cp.emit(ServiceAdded{Slot: slotNo, Registration: registration, Service: s.Name, Price: s.Price, Time: cp.now()})
+	return append([]OrderedService{}, cp.Slots[slotNo].Services...), nil
+}
+
+// serviceLines returns a bill line for each service ordered for a car's stay
+func (cp *Carpark) serviceLines(car *Car) []BillLine {
+	lines := make([]BillLine, 0, len(car.Services))
+	for _, o := range car.Services {
+		description := o.Name
+		if s, ok := cp.Rates.service(o.Name); ok && s.Description != "" {
+			description = s.Description
+		}
+		lines = append(lines, BillLine{Description: description, Service: o.Name, Amount: o.Price})
+	}
+	return lines
+}
@@ -0,0 +1,17 @@
+package parking
+
+import "context"
+
+// Store is a parking lot kept outside the process, such as in a database shared by
+// several gate clients. Implementations must be safe for concurrent use and report
+// the same sentinel errors as Carpark.
+type Store interface {
+	// AllocateSlot parks a car in the nearest free slot and returns the slot number, or ErrLotFull
+	AllocateSlot(ctx context.Context, registration string, color string) (int, error)
+	// FreeSlot frees up a slot and returns the car that was parked in it, or ErrSlotNotFound
+	FreeSlot(ctx context.Context, slotNo int) (*Car, error)
+	// QueryByColor returns the cars of a color ordered by slot, or ErrNotFound if there are none
+	QueryByColor(ctx context.Context, color string) ([]ParkedCar, error)
+	// QueryByReg returns the car with a registration number and its slot, or ErrNotFound
+	QueryByReg(ctx context.Context, registration string) (ParkedCar, error)
+}
@@ -0,0 +1,99 @@
+package parking
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// weekdays are the day names used by tariff bands, indexed by time.Weekday
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Band replaces the hourly rate of a rate card on some days between two hours of the day, such as a
+// night or weekend rate. An hour is priced by the band matching the day and hour it starts in.
+type Band struct {
+	Days       []string `json:"days,omitempty"` // Days the band applies on, such as "sat"; every day if empty
+	From       int      `json:"from"`           // Hour of the day the band starts, from 0 to 23
+	To         int      `json:"to"`             // Hour of the day the band ends; before From if it runs past midnight, equal to it for the whole day
+	HourlyRate int      `json:"hourly_rate"`
+}
+
+// matches reports whether the band applies to an hour starting at t
+func (b Band) matches(t time.Time) bool {
+	if len(b.Days) > 0 && !slices.Contains(b.Days, weekdays[t.Weekday()]) {
+		return false
+	}
+
+	h := t.Hour()
+	switch {
+	case b.From < b.To:
+		return h >= b.From && h < b.To
+	case b.From > b.To:
+		return h >= b.From || h < b.To
+	default:
+		return true
+	}
+}
+
+// validate checks that the band's days and hours are ones it can match
+func (b Band) validate() error {
+	for _, d := range b.Days {
+		if !slices.Contains(weekdays, d) {
+			return fmt.Errorf("unknown day %q, want one of %s", d, strings.Join(weekdays, ", "))
+		}
+	}
+	if b.From < 0 || b.From > 23 || b.To < 0 || b.To > 24 {
+		return fmt.Errorf("hours %d to %d are outside the day", b.From, b.To)
+	}
+	return nil
+}
+
+// rateAt returns the hourly rate for an hour starting at t
+func (rc RateCard) rateAt(t time.Time) int {
+	for _, b := range rc.Bands {
+		if b.matches(t) {
+			return b.HourlyRate
+		}
+	}
+	return rc.HourlyRate
+}
+
+// LoadRateCard reads a rate card with its tariff bands from a JSON file
+func LoadRateCard(path string) (RateCard, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RateCard{}, err
+	}
+
+	var rc RateCard
+	if err := json.Unmarshal(data, &rc); err != nil {
+		return RateCard{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := rc.Validate(); err != nil {
+		return RateCard{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return rc, nil
+}
+
+// Validate checks the bands and services of a rate card, such as one read from a configuration file
+func (rc RateCard) Validate() error {
+	for i, b := range rc.Bands {
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("band %d: %w", i+1, err)
+		}
+	}
+	names := make(map[string]bool)
+	for _, s := range rc.Services {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if names[s.Name] {
+			return fmt.Errorf("service %s is listed more than once", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
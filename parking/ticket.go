@@ -0,0 +1,74 @@
+package parking
+
+import (
+	"errors"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Ticket is issued to the driver of each parked car and returned at the exit
+type Ticket struct {
+	ID           string    `json:"id"` // ULID, so tickets sort by when they were issued
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	EntryTime    time.Time `json:"entry_time"`
+}
+
+// newULID returns a new ID for a ticket or booking made at now
+func newULID(now time.Time) string {
+	return ulid.MustNew(ulid.Timestamp(now), ulid.DefaultEntropy()).String()
+}
+
+// ticketFor returns the ticket of the car in a slot
+func ticketFor(slotNo int, car *Car) Ticket {
+	return Ticket{ID: car.Ticket, Slot: slotNo, Registration: car.Registration, EntryTime: car.ParkedAt}
+}
+
+// parkedTicket returns the ticket of the car just parked in a slot, or with ErrAlreadyParked the ticket of the
+// car that was already parked in it
+func (cp *Carpark) parkedTicket(slotNo int, err error) (Ticket, error) {
+	if err != nil && !errors.Is(err, ErrAlreadyParked) {
+		return Ticket{}, err
+	}
+	return ticketFor(slotNo, cp.Slots[slotNo]), err
+}
+
+// ParkWithTicket parks a car in the parking lot and returns the ticket issued for it
+func (cp *Carpark) ParkWithTicket(registration string, color string) (Ticket, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	return cp.parkedTicket(cp.park(registration, color))
+}
+
+// TicketLookup returns the ticket with a given ID, telling where the car is and when it entered
+func (cp *Carpark) TicketLookup(id string) (Ticket, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	slotNo, exists := cp.Tickets[id]
+	if !exists {
+		return Ticket{}, ErrNotFound
+	}
+	return ticketFor(slotNo, cp.Slots[slotNo]), nil
+}
+
+// Checkout frees the slot of the car with a given ticket ID or registration number and returns its ticket
+func (cp *Carpark) Checkout(ticketOrRegistration string) (Ticket, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	slotNo, exists := cp.Tickets[ticketOrRegistration]
+	if !exists {
+		if slotNo, exists = cp.RegMap[ticketOrRegistration]; !exists {
+			return Ticket{}, ErrNotFound
+		}
+	}
+
+	car, err := cp.leave(slotNo, cp.now())
+	if err != nil {
+		return Ticket{}, err
+	}
+	return ticketFor(slotNo, car), nil
+}
@@ -0,0 +1,111 @@
+package parking
+
+// VehicleType is the kind of vehicle parked, which decides the slots it fits
+type VehicleType string
+
+const (
+	// VehicleMotorcycle fits any slot
+	VehicleMotorcycle VehicleType = "motorcycle"
+	// VehicleCompact is a small car, which fits any slot
+	VehicleCompact VehicleType = "compact"
+	// VehicleCar fits standard and large slots; a car with no recorded type is one
+	VehicleCar VehicleType = "car"
+	// VehicleTruck only fits large slots
+	VehicleTruck VehicleType = "truck"
+)
+
+// SlotSize is the category of a slot, which decides the vehicles it takes
+type SlotSize string
+
+const (
+	// SlotCompact takes motorcycles and compact cars
+	SlotCompact SlotSize = "compact"
+	// SlotStandard takes any vehicle but a truck; slots are standard unless configured otherwise
+	SlotStandard SlotSize = "standard"
+	// SlotLarge takes any vehicle, including trucks
+	SlotLarge SlotSize = "large"
+)
+
+// slotSizes lists the slot sizes from smallest to largest
+var slotSizes = []SlotSize{SlotCompact, SlotStandard, SlotLarge}
+
+// ParseVehicleType returns the vehicle type with the given name, returning ErrVehicleType for an unknown one
+func ParseVehicleType(name string) (VehicleType, error) {
+	switch v := VehicleType(name); v {
+	case VehicleMotorcycle, VehicleCompact, VehicleCar, VehicleTruck:
+		return v, nil
+	}
+	return "", ErrVehicleType
+}
+
+// rank returns the position of a slot size from the smallest, -1 for an unknown size
+func (s SlotSize) rank() int {
+	for i, size := range slotSizes {
+		if size == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// size returns the smallest slot size a vehicle of this type fits
+func (v VehicleType) size() SlotSize {
+	switch v {
+	case VehicleMotorcycle, VehicleCompact:
+		return SlotCompact
+	case VehicleTruck:
+		return SlotLarge
+	}
+	return SlotStandard
+}
+
+// fits reports whether a vehicle of this type may park in a slot of the given size
+func (v VehicleType) fits(size SlotSize) bool {
+	return size.rank() >= v.size().rank()
+}
+
+// sizeOf returns the size of a slot
+func (cp *Carpark) sizeOf(slotNo int) SlotSize {
+	if size, ok := cp.SlotSizes[slotNo]; ok {
+		return size
+	}
+	return SlotStandard
+}
+
+// firstFree returns the free slot a vehicle without a permit fits that is of the smallest size with one, then
+// on the lowest floor with one, then first in the order the allocation strategy hands slots out, reporting false
+// if none is free. Accessible slots are left out.
+func (cp *Carpark) firstFree(vehicle VehicleType) (int, bool) {
+	return cp.firstFreeWhere(vehicle, cp.regular)
+}
+
+// firstFreeWhere returns the slot firstFree picks among the free slots for which want reports true, or among
+// all of them if want is nil
+func (cp *Carpark) firstFreeWhere(vehicle VehicleType, want func(slotNo int) bool) (int, bool) {
+	best, bestRank, bestFloor := 0, 0, 0
+	for _, slotNo := range cp.freeSlots() {
+		size := cp.sizeOf(slotNo)
+		if !vehicle.fits(size) || want != nil && !want(slotNo) {
+			continue
+		}
+		rank, floor := size.rank(), cp.floorOf(slotNo)
+		if best == 0 || rank < bestRank || rank == bestRank && floor < bestFloor {
+			best, bestRank, bestFloor = slotNo, rank, floor
+		}
+	}
+	return best, best != 0
+}
+
+// ParkVehicle parks a vehicle of the given type in the smallest free slot it fits and returns its ticket.
+// It returns ErrNoFittingSlot when slots are free but none fits the vehicle, and ErrAlreadyParked with the
+// ticket of the vehicle if it is already parked.
+func (cp *Carpark) ParkVehicle(registration string, color string, vehicle VehicleType) (Ticket, error) {
+	if _, err := ParseVehicleType(string(vehicle)); err != nil {
+		return Ticket{}, err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	return cp.parkedTicket(cp.parkWith(registration, color, vehicle, false, cp.allocate))
+}
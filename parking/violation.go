@@ -0,0 +1,89 @@
+package parking
+
+import "time"
+
+// Violation is a vehicle found parked outside the managed slots, such as in a fire lane or an aisle. It takes
+// no slot, so it is tracked apart from the parked cars until it is moved or towed.
+type Violation struct {
+	ID           string    `json:"id"` // ULID, so violations sort by when they were first logged
+	Registration string    `json:"registration"`
+	Location     string    `json:"location"` // Where the vehicle is, such as "fire lane by gate B"
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	Cleared      time.Time `json:"cleared"` // When the vehicle was moved or towed, zero while it is still there
+}
+
+// LogViolation records a vehicle parked illegally outside the managed slots and returns the violation.
+// Logging a vehicle that already has an open violation updates its location and when it was last seen.
+func (cp *Carpark) LogViolation(registration string, location string) (Violation, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return Violation{}, ErrEvacuating
+	}
+
+	now := cp.now()
+	id := newULID(now)
+	if i := cp.openViolation(registration); i >= 0 {
+		id = cp.Violations[i].ID
+	}
+	cp.emit(ViolationLogged{Violation: id, Registration: registration, Location: location, Time: now})
+	return cp.Violations[cp.violation(id)], nil
+}
+
+// ClearViolation records that the vehicle of an open violation was moved or towed and returns the violation
+func (cp *Carpark) ClearViolation(id string) (Violation, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.evacuating() {
+		return Violation{}, ErrEvacuating
+	}
+
+	i := cp.violation(id)
+	if i < 0 || !cp.Violations[i].Cleared.IsZero() {
+		return Violation{}, ErrNotFound
+	}
+	cp.emit(ViolationCleared{Violation: id, Time: cp.now()})
+	return cp.Violations[i], nil
+}
+
+// AllViolations returns every logged violation, including cleared ones, oldest first
+func (cp *Carpark) AllViolations() []Violation {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return append([]Violation{}, cp.Violations...)
+}
+
+// TowList returns the violations whose vehicle is still there, longest there first, for towing
+func (cp *Carpark) TowList() []Violation {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	open := make([]Violation, 0)
+	for _, v := range cp.Violations {
+		if v.Cleared.IsZero() {
+			open = append(open, v)
+		}
+	}
+	return open
+}
+
+// violation returns the index of the violation with a given ID, or -1 if there is none
+func (cp *Carpark) violation(id string) int {
+	for i, v := range cp.Violations {
+		if v.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// openViolation returns the index of the open violation of a vehicle, or -1 if it has none
+func (cp *Carpark) openViolation(registration string) int {
+	for i, v := range cp.Violations {
+		if v.Registration == registration && v.Cleared.IsZero() {
+			return i
+		}
+	}
+	return -1
+}
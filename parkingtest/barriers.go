@@ -0,0 +1,45 @@
+package parkingtest
+
+import (
+	"context"
+	"sync"
+)
+
+// Barriers is a parking.BarrierController that records whether the barriers are held open. Setting Err
+// makes every call fail with it, leaving the barriers as they were.
+type Barriers struct {
+	mu   sync.Mutex
+	open bool
+	Err  error
+}
+
+// OpenAll implements parking.BarrierController
+func (b *Barriers) OpenAll(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Err != nil {
+		return b.Err
+	}
+	b.open = true
+	return nil
+}
+
+// Resume implements parking.BarrierController
+func (b *Barriers) Resume(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Err != nil {
+		return b.Err
+	}
+	b.open = false
+	return nil
+}
+
+// Open reports whether the barriers are held open
+func (b *Barriers) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
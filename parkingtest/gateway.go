@@ -0,0 +1,102 @@
+package parkingtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// DeclinedMethod is a payment method the Gateway always declines
+const DeclinedMethod = "pm_card_declined"
+
+// Gateway is a parking.PaymentGateway that keeps payments in memory. Charges with DeclinedMethod are
+// declined, a retried charge for the same reference returns the first payment and a retried refund with the
+// same sequence number is only made once.
+type Gateway struct {
+	mu       sync.Mutex
+	payments map[string]*Payment
+	refs     map[string]string // Map to store payment IDs by charge reference
+	refunds  map[string]bool   // Set of refunds made, by payment ID and sequence number
+}
+
+// Payment is a charge taken by a Gateway
+type Payment struct {
+	ID        string
+	Amount    int
+	Reference string
+	Method    string
+	Refunded  int
+}
+
+// NewGateway returns a Gateway with no payments
+func NewGateway() *Gateway {
+	return &Gateway{payments: make(map[string]*Payment), refs: make(map[string]string), refunds: make(map[string]bool)}
+}
+
+// Charge implements parking.PaymentGateway
+func (g *Gateway) Charge(ctx context.Context, req parking.ChargeRequest) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if req.Method == DeclinedMethod {
+		return "", parking.ErrPaymentDeclined
+	}
+	if id, ok := g.refs[req.Reference]; ok && req.Reference != "" {
+		return id, nil
+	}
+
+	id := fmt.Sprintf("pay_%d", len(g.payments)+1)
+	g.payments[id] = &Payment{ID: id, Amount: req.Amount, Reference: req.Reference, Method: req.Method}
+	g.refs[req.Reference] = id
+	return id, nil
+}
+
+// Refund implements parking.PaymentGateway
+func (g *Gateway) Refund(ctx context.Context, req parking.RefundRequest) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[req.PaymentID]
+	if !ok {
+		return parking.ErrNotFound
+	}
+	key := fmt.Sprintf("%s/%d", req.PaymentID, req.Sequence)
+	if g.refunds[key] {
+		return nil
+	}
+	if req.Amount > p.Amount-p.Refunded {
+		return parking.ErrRefundAmount
+	}
+	p.Refunded += req.Amount
+	g.refunds[key] = true
+	return nil
+}
+
+// Status implements parking.PaymentGateway
+func (g *Gateway) Status(ctx context.Context, paymentID string) (parking.PaymentStatus, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[paymentID]
+	if !ok {
+		return "", parking.ErrNotFound
+	}
+	if p.Refunded == p.Amount {
+		return parking.PaymentRefunded, nil
+	}
+	return parking.PaymentSucceeded, nil
+}
+
+// Payments returns a copy of every payment taken, in no particular order
+func (g *Gateway) Payments() []Payment {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payments := make([]Payment, 0, len(g.payments))
+	for _, p := range g.payments {
+		payments = append(payments, *p)
+	}
+	return payments
+}
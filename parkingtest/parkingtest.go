@@ -0,0 +1,61 @@
+// Package parkingtest runs the parking HTTP API in-process, backed by an in-memory
+// lot, for end-to-end tests of gate clients.
+package parkingtest
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/arjun759/car-parking/parking"
+	"github.com/arjun759/car-parking/server"
+)
+
+// OperatorKey is the operator API key a Server accepts, to send as "Authorization: Bearer " + OperatorKey
+// on refunds and evacuations
+const OperatorKey = "operator-test-key"
+
+// Server is the HTTP API listening on a loopback address, with the lot behind it exposed for
+// setting up and inspecting state directly
+type Server struct {
+	*httptest.Server
+	Lot *parking.Carpark
+
+	mu     sync.Mutex
+	events []parking.Event // Every event the lot has emitted, in order
+}
+
+// NewServer creates a lot with the given number of slots and starts serving it. The configure
+// functions run before the lot is created, to set fields such as GracePeriod or Strategy.
+// Callers should call Close when finished.
+func NewServer(slots int, configure ...func(*parking.Carpark)) *Server {
+	cp := &parking.Carpark{}
+	for _, fn := range configure {
+		fn(cp)
+	}
+
+	s := &Server{Lot: cp}
+	cp.Subscribe(s.record)
+	cp.CreateParkingLot(slots)
+	s.Server = httptest.NewServer(server.New(cp, OperatorKey))
+	return s
+}
+
+// record keeps an event emitted by the lot
+func (s *Server) record(e parking.Event) {
+	s.mu.Lock()
+	s.events = append(s.events, e)
+	s.mu.Unlock()
+}
+
+// Events returns every event the lot has emitted so far, starting with LotCreated
+func (s *Server) Events() []parking.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]parking.Event(nil), s.events...)
+}
+
+// FeedURL returns the WebSocket URL of the live occupancy feed
+func (s *Server) FeedURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/feed"
+}
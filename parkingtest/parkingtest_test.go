@@ -0,0 +1,456 @@
+package parkingtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+	"github.com/arjun759/car-parking/server"
+)
+
+// do sends a request with body encoded as JSON to the server and decodes the response into out,
+// failing the test unless it has the wanted status
+func do(t *testing.T, s *Server, method, path string, body, out interface{}, want int) {
+	t.Helper()
+	doAs(t, s, "", method, path, body, out, want)
+}
+
+// doAs is do with key as the bearer token of the request, if it is not empty
+func doAs(t *testing.T, s *Server, key, method, path string, body, out interface{}, want int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, s.URL+path, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		var e map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&e)
+		t.Fatalf("%s %s: got status %d %v, want %d", method, path, resp.StatusCode, e, want)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+func TestParkAndPay(t *testing.T) {
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	gateway := NewGateway()
+	s := NewServer(3, func(cp *parking.Carpark) {
+		cp.Clock = clock
+		cp.Gateway = gateway
+		cp.Rates = parking.RateCard{FlatFee: 200, FlatHours: 1, HourlyRate: 150}
+	})
+	defer s.Close()
+
+	var parked struct {
+		Slot     int       `json:"slot"`
+		Ticket   string    `json:"ticket"`
+		ParkedAt time.Time `json:"parked_at"`
+	}
+	do(t, s, "POST", "/slots/park", map[string]string{"registration": "KA-01-HH-1234", "color": "White"}, &parked, http.StatusCreated)
+	if parked.Slot != 1 || parked.Ticket == "" || !parked.ParkedAt.Equal(start) {
+		t.Fatalf("parked in slot %d at %v with ticket %q, want slot 1 at %v and a ticket", parked.Slot, parked.ParkedAt, parked.Ticket, start)
+	}
+
+	// Two and a half hours is the flat fee for the first hour and two more hours at the hourly rate
+	clock.Advance(150 * time.Minute)
+
+	var declined struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	do(t, s, "POST", "/cars/KA-01-HH-1234/pay", map[string]string{"payment_method": DeclinedMethod}, &declined, http.StatusPaymentRequired)
+	if declined.Error.Code != server.CodePaymentDeclined {
+		t.Errorf("declined payment returned code %q", declined.Error.Code)
+	}
+	if got := s.Lot.Status(); len(got) != 1 {
+		t.Fatalf("after a declined payment %d cars are parked, want 1", len(got))
+	}
+
+	var bill parking.Bill
+	do(t, s, "POST", "/cars/KA-01-HH-1234/pay", map[string]string{"payment_method": "pm_card_visa"}, &bill, http.StatusOK)
+	if bill.Ticket != parked.Ticket || bill.Slot != 1 || bill.Minutes != 150 || bill.Hours != 3 || bill.Amount != 500 {
+		t.Errorf("got bill %+v, want 500 for 3 hours on ticket %s in slot 1", bill, parked.Ticket)
+	}
+	if !bill.ParkedAt.Equal(start) || !bill.LeftAt.Equal(start.Add(150*time.Minute)) {
+		t.Errorf("bill runs from %v to %v, want the fake clock's times", bill.ParkedAt, bill.LeftAt)
+	}
+
+	payments := gateway.Payments()
+	if len(payments) != 1 {
+		t.Fatalf("gateway took %d payments, want 1", len(payments))
+	}
+	if p := payments[0]; p.ID != bill.PaymentID || p.Amount != 500 || p.Reference != parked.Ticket {
+		t.Errorf("gateway took %+v, want 500 for ticket %s as %s", p, parked.Ticket, bill.PaymentID)
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	do(t, s, "GET", "/payments/"+bill.PaymentID, nil, &status, http.StatusOK)
+	if status.Status != string(parking.PaymentSucceeded) {
+		t.Errorf("payment status is %q, want %q", status.Status, parking.PaymentSucceeded)
+	}
+
+	var cars []struct{}
+	do(t, s, "GET", "/slots", nil, &cars, http.StatusOK)
+	if len(cars) != 0 {
+		t.Errorf("%d cars still parked after paying", len(cars))
+	}
+	do(t, s, "POST", "/cars/KA-01-HH-1234/pay", map[string]string{"payment_method": "pm_card_visa"}, nil, http.StatusNotFound)
+	if n := len(gateway.Payments()); n != 1 {
+		t.Errorf("paying again for a car that left took %d payments, want 1", n)
+	}
+}
+
+func TestOperatorRoutes(t *testing.T) {
+	gateway := NewGateway()
+	s := NewServer(3, func(cp *parking.Carpark) {
+		cp.Gateway = gateway
+		cp.Rates = parking.RateCard{FlatFee: 200, FlatHours: 1}
+	})
+	defer s.Close()
+
+	do(t, s, "POST", "/slots/park", map[string]string{"registration": "KA-01-HH-1234", "color": "White"}, nil, http.StatusCreated)
+	var bill parking.Bill
+	do(t, s, "POST", "/cars/KA-01-HH-1234/pay", map[string]string{"payment_method": "pm_card_visa"}, &bill, http.StatusOK)
+
+	refund := "/payments/" + bill.PaymentID + "/refund"
+	for _, key := range []string{"", "wrong-key"} {
+		var unauthorized struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		doAs(t, s, key, "POST", refund, map[string]int{"amount": 100}, &unauthorized, http.StatusUnauthorized)
+		if unauthorized.Error.Code != server.CodeUnauthorized {
+			t.Errorf("refund with key %q returned code %q", key, unauthorized.Error.Code)
+		}
+		doAs(t, s, key, "POST", "/evacuation", nil, nil, http.StatusUnauthorized)
+		doAs(t, s, key, "DELETE", "/evacuation", nil, nil, http.StatusUnauthorized)
+	}
+	if p := gateway.Payments()[0]; p.Refunded != 0 {
+		t.Errorf("unauthorized refunds returned %d", p.Refunded)
+	}
+	if s.Lot.Evacuating() {
+		t.Error("an unauthorized request started an evacuation")
+	}
+
+	doAs(t, s, OperatorKey, "POST", refund, map[string]int{"amount": 100}, nil, http.StatusOK)
+	if p := gateway.Payments()[0]; p.Refunded != 100 {
+		t.Errorf("refunded %d, want 100", p.Refunded)
+	}
+	doAs(t, s, OperatorKey, "POST", "/evacuation", nil, nil, http.StatusCreated)
+	doAs(t, s, OperatorKey, "DELETE", "/evacuation", nil, nil, http.StatusOK)
+}
+
+func TestCarEvidence(t *testing.T) {
+	s := NewServer(2)
+	defer s.Close()
+
+	do(t, s, "POST", "/slots/park", map[string]string{"registration": "KA-01-HH-1234", "color": "White"}, nil, http.StatusCreated)
+	do(t, s, "POST", "/cars/KA-01-HH-1234/evidence", map[string]string{}, nil, http.StatusBadRequest)
+	do(t, s, "POST", "/cars/KA-09-ZZ-0000/evidence", map[string]string{"ref": "s3://cam/0.jpg"}, nil, http.StatusNotFound)
+	for _, ref := range []string{"s3://cam/1.jpg", "s3://cam/2.jpg"} {
+		do(t, s, "POST", "/cars/KA-01-HH-1234/evidence", map[string]string{"ref": ref}, nil, http.StatusCreated)
+	}
+
+	var got struct {
+		Slot     int      `json:"slot"`
+		Evidence []string `json:"evidence"`
+	}
+	do(t, s, "GET", "/cars/KA-01-HH-1234/evidence", nil, &got, http.StatusOK)
+	if got.Slot != 1 || len(got.Evidence) != 2 || got.Evidence[0] != "s3://cam/1.jpg" || got.Evidence[1] != "s3://cam/2.jpg" {
+		t.Errorf("got slot %d with evidence %v, want slot 1 with both references in order", got.Slot, got.Evidence)
+	}
+	do(t, s, "GET", "/cars/KA-09-ZZ-0000/evidence", nil, nil, http.StatusNotFound)
+}
+
+func TestCarNotes(t *testing.T) {
+	s := NewServer(2)
+	defer s.Close()
+
+	do(t, s, "POST", "/slots/park", map[string]string{"registration": "KA-01-HH-1234", "color": "White"}, nil, http.StatusCreated)
+	do(t, s, "POST", "/cars/KA-01-HH-1234/notes", map[string]string{}, nil, http.StatusBadRequest)
+	do(t, s, "POST", "/cars/KA-09-ZZ-0000/notes", map[string]string{"text": "lights on"}, nil, http.StatusNotFound)
+	do(t, s, "POST", "/cars/KA-01-HH-1234/notes", map[string]interface{}{"text": "lights on"}, nil, http.StatusCreated)
+	do(t, s, "POST", "/cars/KA-01-HH-1234/notes", map[string]interface{}{"text": "dent on rear door", "incident": true}, nil, http.StatusCreated)
+
+	var got struct {
+		Slot  int            `json:"slot"`
+		Notes []parking.Note `json:"notes"`
+	}
+	do(t, s, "GET", "/cars/KA-01-HH-1234/notes", nil, &got, http.StatusOK)
+	want := []parking.Note{{Text: "lights on"}, {Text: "dent on rear door", Incident: true}}
+	if got.Slot != 1 || len(got.Notes) != len(want) {
+		t.Fatalf("got slot %d with notes %+v, want slot 1 with %+v", got.Slot, got.Notes, want)
+	}
+	for i, note := range got.Notes {
+		if note.Text != want[i].Text || note.Incident != want[i].Incident || note.Time.IsZero() {
+			t.Errorf("note %d is %+v, want %+v with the time it was added", i, note, want[i])
+		}
+	}
+	do(t, s, "GET", "/cars/KA-09-ZZ-0000/notes", nil, nil, http.StatusNotFound)
+}
+
+func TestRestore(t *testing.T) {
+	clock := NewClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	s := NewServer(2, func(cp *parking.Carpark) {
+		cp.Clock = clock
+		cp.RestoreWindow = 10 * time.Minute
+	})
+	defer s.Close()
+
+	type car struct {
+		Slot     int       `json:"slot"`
+		Ticket   string    `json:"ticket"`
+		ParkedAt time.Time `json:"parked_at"`
+	}
+	var parked, restored car
+	do(t, s, "POST", "/slots/park", map[string]string{"registration": "KA-01-HH-1234", "color": "White"}, &parked, http.StatusCreated)
+	clock.Advance(time.Hour)
+	do(t, s, "DELETE", "/cars/KA-01-HH-1234", nil, nil, http.StatusOK)
+
+	clock.Advance(5 * time.Minute)
+	do(t, s, "POST", "/cars/KA-01-HH-1234/restore", nil, &restored, http.StatusCreated)
+	if restored != parked {
+		t.Errorf("restored as %+v, want the stay it left as %+v", restored, parked)
+	}
+	do(t, s, "POST", "/cars/KA-01-HH-1234/restore", nil, nil, http.StatusNotFound)
+	do(t, s, "POST", "/cars/KA-09-ZZ-0000/restore", nil, nil, http.StatusNotFound)
+
+	// Past the restore window the car is gone for good
+	do(t, s, "DELETE", "/cars/KA-01-HH-1234", nil, nil, http.StatusOK)
+	clock.Advance(11 * time.Minute)
+	do(t, s, "POST", "/cars/KA-01-HH-1234/restore", nil, nil, http.StatusNotFound)
+}
+
+func TestCarsByColor(t *testing.T) {
+	s := NewServer(4)
+	defer s.Close()
+
+	for _, car := range []struct{ registration, color string }{
+		{"KA-01", "White"}, {"KA-02", "Red"}, {"KA-03", "White"},
+	} {
+		do(t, s, "POST", "/slots/park", map[string]string{"registration": car.registration, "color": car.color}, nil, http.StatusCreated)
+	}
+
+	type car struct {
+		Slot         int    `json:"slot"`
+		Registration string `json:"registration"`
+	}
+	for _, tt := range []struct {
+		query string
+		want  []car
+	}{
+		{"", []car{{1, "KA-01"}, {2, "KA-02"}, {3, "KA-03"}}},
+		{"?color=White", []car{{1, "KA-01"}, {3, "KA-03"}}},
+		{"?color=Blue", []car{}},
+	} {
+		var got []car
+		do(t, s, "GET", "/cars"+tt.query, nil, &got, http.StatusOK)
+		if got == nil || !slices.Equal(got, tt.want) {
+			t.Errorf("GET /cars%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// heldGateway is a Gateway whose charges wait for release once they have reached it
+type heldGateway struct {
+	*Gateway
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (g *heldGateway) Charge(ctx context.Context, req parking.ChargeRequest) (string, error) {
+	g.entered <- struct{}{}
+	<-g.release
+	return g.Gateway.Charge(ctx, req)
+}
+
+// Run with go test -race
+func TestConcurrentPayAndExit(t *testing.T) {
+	ctx := context.Background()
+	rates := parking.RateCard{FlatFee: 200, FlatHours: 1, Services: []parking.Service{{Name: "car_wash", Price: 1500}}}
+
+	// While one exit is with the gateway, a second one and additions to the bill are turned away
+	gateway := &heldGateway{Gateway: NewGateway(), entered: make(chan struct{}), release: make(chan struct{})}
+	cp := &parking.Carpark{Gateway: gateway, Rates: rates}
+	cp.CreateParkingLot(2)
+	if _, err := cp.Park("KA-01", "White"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := cp.PayAndExit(ctx, "KA-01", "pm_card_visa")
+		done <- err
+	}()
+	<-gateway.entered
+	if _, err := cp.PayAndExit(ctx, "KA-01", "pm_card_visa"); !errors.Is(err, parking.ErrExitInProgress) {
+		t.Errorf("second exit: got %v, want ErrExitInProgress", err)
+	}
+	if _, err := cp.AddService("KA-01", "car_wash"); !errors.Is(err, parking.ErrExitInProgress) {
+		t.Errorf("service added while paying: got %v, want ErrExitInProgress", err)
+	}
+	close(gateway.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// However the two exits interleave, the driver pays once and the payment is kept
+	for i := 0; i < 200; i++ {
+		gateway := NewGateway()
+		cp := &parking.Carpark{Gateway: gateway, Rates: rates}
+		cp.CreateParkingLot(2)
+		if _, err := cp.Park("KA-01", "White"); err != nil {
+			t.Fatal(err)
+		}
+
+		start := make(chan struct{})
+		errs := make(chan error, 2)
+		for j := 0; j < 2; j++ {
+			go func() {
+				<-start
+				_, err := cp.PayAndExit(ctx, "KA-01", "pm_card_visa")
+				errs <- err
+			}()
+		}
+		close(start)
+		paid := 0
+		for j := 0; j < 2; j++ {
+			switch err := <-errs; {
+			case err == nil:
+				paid++
+			case !errors.Is(err, parking.ErrExitInProgress) && !errors.Is(err, parking.ErrNotFound):
+				t.Fatalf("concurrent exit: %v", err)
+			}
+		}
+		if paid != 1 {
+			t.Fatalf("%d exits succeeded, want 1", paid)
+		}
+
+		payments := gateway.Payments()
+		if len(payments) != 1 || payments[0].Refunded != 0 {
+			t.Fatalf("gateway holds %+v, want one payment with nothing refunded", payments)
+		}
+		report := cp.RevenueReport(time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 1))
+		if report.Stays != 1 || report.Revenue != 200 || report.Refunded != 0 {
+			t.Fatalf("lot recorded %+v, want one stay paid 200", report)
+		}
+	}
+}
+
+func TestOriginsReport(t *testing.T) {
+	clock := NewClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	s := NewServer(4, func(cp *parking.Carpark) { cp.Clock = clock })
+	defer s.Close()
+
+	for _, registration := range []string{"KA-01", "MH-01", "KA-02"} {
+		do(t, s, "POST", "/slots/park", map[string]string{"registration": registration, "color": "White"}, nil, http.StatusCreated)
+	}
+	path := "/reports/origins?from=2024-03-01&to=2024-03-31"
+	do(t, s, "GET", path, nil, nil, http.StatusUnauthorized)
+	do(t, s, "GET", "/reports/revenue?from=2024-03-01&to=2024-03-31", nil, nil, http.StatusUnauthorized)
+
+	var got []parking.OriginShare
+	doAs(t, s, OperatorKey, "GET", path, nil, &got, http.StatusOK)
+	if len(got) != 2 || got[0].Jurisdiction != "KA" || got[0].Cars != 2 || got[1].Jurisdiction != "MH" || got[1].Cars != 1 {
+		t.Errorf("got origins %+v, want KA with 2 cars then MH with 1", got)
+	}
+	doAs(t, s, OperatorKey, "GET", "/reports/origins?from=2020-01-01&to=2020-01-31", nil, &got, http.StatusOK)
+	if len(got) != 0 {
+		t.Errorf("got origins %+v in a period without arrivals, want none", got)
+	}
+	doAs(t, s, OperatorKey, "GET", "/reports/origins", nil, nil, http.StatusBadRequest)
+}
+
+func TestForceFree(t *testing.T) {
+	s := NewServer(2)
+	defer s.Close()
+
+	do(t, s, "POST", "/slots/park", map[string]string{"registration": "KA-01-HH-1234", "color": "White"}, nil, http.StatusCreated)
+	do(t, s, "POST", "/slots/1/force-free", map[string]string{"reason": "towed"}, nil, http.StatusUnauthorized)
+	doAs(t, s, OperatorKey, "POST", "/slots/1/force-free", map[string]string{}, nil, http.StatusBadRequest)
+
+	var rec parking.Reconciliation
+	doAs(t, s, OperatorKey, "POST", "/slots/1/force-free", map[string]string{"reason": "towed"}, &rec, http.StatusOK)
+	if rec.Slot != 1 || rec.Registration != "KA-01-HH-1234" || rec.Reason != "towed" {
+		t.Errorf("got reconciliation %+v, want KA-01-HH-1234 in slot 1 towed", rec)
+	}
+	if _, err := s.Lot.FindCar("KA-01-HH-1234"); !errors.Is(err, parking.ErrNotFound) {
+		t.Errorf("the car is still found after its slot was forced free: %v", err)
+	}
+	doAs(t, s, OperatorKey, "POST", "/slots/1/force-free", map[string]string{"reason": "towed"}, nil, http.StatusNotFound)
+}
+
+func TestSlotUsage(t *testing.T) {
+	s := NewServer(3, func(cp *parking.Carpark) { cp.Strategy = parking.LeastRecentlyUsed })
+	defer s.Close()
+
+	for _, registration := range []string{"KA-01", "KA-02"} {
+		do(t, s, "POST", "/slots/park", map[string]string{"registration": registration, "color": "White"}, nil, http.StatusCreated)
+	}
+	do(t, s, "DELETE", "/slots/1", nil, nil, http.StatusOK)
+	do(t, s, "POST", "/slots/park", map[string]string{"registration": "KA-03", "color": "White"}, nil, http.StatusCreated)
+
+	var got []struct {
+		Slot        int `json:"slot"`
+		Allocations int `json:"allocations"`
+	}
+	do(t, s, "GET", "/slots/usage", nil, &got, http.StatusOK)
+	if len(got) != 3 {
+		t.Fatalf("got usage of %d slots, want 3", len(got))
+	}
+	for i, u := range got {
+		// Rotation hands out slot 3, never used, before slot 1 again
+		if u.Slot != i+1 || u.Allocations != 1 {
+			t.Errorf("slot %d allocated %d times, want slot %d once", u.Slot, u.Allocations, i+1)
+		}
+	}
+}
+
+func TestParkInSlot(t *testing.T) {
+	s := NewServer(3)
+	defer s.Close()
+
+	var parked struct {
+		Slot   int    `json:"slot"`
+		Ticket string `json:"ticket"`
+	}
+	do(t, s, "POST", "/slots/park", map[string]interface{}{"registration": "KA-01", "color": "White", "slot": 3}, &parked, http.StatusCreated)
+	if parked.Slot != 3 || parked.Ticket == "" {
+		t.Errorf("parked in slot %d with ticket %q, want slot 3 with a ticket", parked.Slot, parked.Ticket)
+	}
+	do(t, s, "POST", "/slots/park", map[string]interface{}{"registration": "KA-02", "color": "Red", "slot": 3}, nil, http.StatusConflict)
+	do(t, s, "POST", "/slots/park", map[string]interface{}{"registration": "KA-02", "color": "Red", "slot": 3, "fallback": true}, &parked, http.StatusCreated)
+	if parked.Slot != 1 {
+		t.Errorf("fell back to slot %d, want the nearest free slot 1", parked.Slot)
+	}
+	do(t, s, "POST", "/slots/park", map[string]interface{}{"registration": "KA-03", "color": "Red", "slot": 2, "vehicle": "truck"}, nil, http.StatusBadRequest)
+	do(t, s, "POST", "/slots/park", map[string]interface{}{"registration": "KA-03", "color": "Red", "fallback": true}, nil, http.StatusBadRequest)
+}
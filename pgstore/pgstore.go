@@ -0,0 +1,215 @@
+// Package pgstore implements parking.Store on PostgreSQL, so gate clients on
+// several hosts can share one parking lot.
+//
+// Every slot of a lot is a row in the slots table; a free slot has a NULL
+// registration, and a registration number can only be in one row of a lot.
+// Allocation takes the lowest free row with FOR UPDATE SKIP LOCKED, so
+// concurrent gates never share the same slot and only wait on each other when
+// every free row is being taken.
+//
+// The caller opens the *sql.DB with a PostgreSQL driver such as
+// github.com/lib/pq or github.com/jackc/pgx/v5/stdlib.
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// schema creates the slots table if it does not already exist, replacing the plain registration index of
+// earlier versions with a unique one
+const schema = `
+CREATE TABLE IF NOT EXISTS slots (
+	lot          text    NOT NULL,
+	slot         integer NOT NULL,
+	registration text,
+	color        text,
+	PRIMARY KEY (lot, slot)
+);
+DROP INDEX IF EXISTS slots_registration;
+CREATE UNIQUE INDEX IF NOT EXISTS slots_lot_registration ON slots (lot, registration) WHERE registration IS NOT NULL;
+CREATE INDEX IF NOT EXISTS slots_color ON slots (lot, color, slot);
+`
+
+// Store is a parking lot kept in PostgreSQL
+type Store struct {
+	db  *sql.DB
+	lot string // Name of the lot, so several lots can share one table
+}
+
+var _ parking.Store = (*Store)(nil)
+
+// New returns a Store for the named lot in db
+func New(db *sql.DB, lot string) *Store {
+	return &Store{db: db, lot: lot}
+}
+
+// uniqueViolation is the SQLSTATE PostgreSQL reports for a row that breaks a unique index
+const uniqueViolation = "23505"
+
+// Migrate creates the slots table and its indexes if they do not already exist. It fails if a
+// registration number is parked twice in a lot, which earlier versions allowed.
+func (s *Store) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, schema)
+	return err
+}
+
+// CreateParkingLot discards any existing state of the lot and creates n free slots
+func (s *Store) CreateParkingLot(ctx context.Context, n int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM slots WHERE lot = $1`, s.lot); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO slots (lot, slot) SELECT $1, generate_series(1, $2::integer)`, s.lot, n); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Capacity returns the number of slots, or zero before CreateParkingLot
+func (s *Store) Capacity(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM slots WHERE lot = $1`, s.lot).Scan(&n)
+	return n, err
+}
+
+// AllocateSlot parks a car in the nearest free slot and returns the slot number. It returns
+// ErrAlreadyParked if the registration number is parked in the lot already.
+func (s *Store) AllocateSlot(ctx context.Context, registration string, color string) (int, error) {
+	for {
+		slotNo, err := s.allocate(ctx, registration, color, "FOR UPDATE SKIP LOCKED")
+		if !errors.Is(err, sql.ErrNoRows) {
+			return slotNo, err
+		}
+
+		// Every free row may be locked by gates taking them, some of which may yet roll back, so
+		// the lot is only full once no row is free
+		var free, parked bool
+		if err := s.db.QueryRowContext(ctx, `SELECT
+			EXISTS (SELECT 1 FROM slots WHERE lot = $1 AND registration IS NULL),
+			EXISTS (SELECT 1 FROM slots WHERE lot = $1 AND registration = $2)`,
+			s.lot, registration).Scan(&free, &parked); err != nil {
+			return 0, err
+		}
+		if parked {
+			return 0, parking.ErrAlreadyParked
+		}
+		if !free {
+			return 0, parking.ErrLotFull
+		}
+		slotNo, err = s.allocate(ctx, registration, color, "FOR UPDATE")
+		if !errors.Is(err, sql.ErrNoRows) {
+			return slotNo, err
+		}
+	}
+}
+
+// allocate records a car in the lowest free row it can lock with the given locking clause, returning
+// sql.ErrNoRows if there is none
+func (s *Store) allocate(ctx context.Context, registration string, color string, lock string) (int, error) {
+	var slotNo int
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE slots SET registration = $2, color = $3
+		WHERE lot = $1 AND slot = (
+			SELECT slot FROM slots
+			WHERE lot = $1 AND registration IS NULL
+			ORDER BY slot
+			LIMIT 1
+			`+lock+`
+		)
+		RETURNING slot`, s.lot, registration, color).Scan(&slotNo)
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == uniqueViolation {
+		return 0, parking.ErrAlreadyParked
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return slotNo, nil
+}
+
+// FreeSlot frees up a slot and returns the car that was parked in it
+func (s *Store) FreeSlot(ctx context.Context, slotNo int) (*parking.Car, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var registration, color sql.NullString
+	err = tx.QueryRowContext(ctx,
+		`SELECT registration, color FROM slots WHERE lot = $1 AND slot = $2 FOR UPDATE`,
+		s.lot, slotNo).Scan(&registration, &color)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !registration.Valid) {
+		return nil, parking.ErrSlotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE slots SET registration = NULL, color = NULL WHERE lot = $1 AND slot = $2`,
+		s.lot, slotNo); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &parking.Car{Registration: registration.String, Color: color.String}, nil
+}
+
+// QueryByColor returns the cars of a color ordered by slot
+func (s *Store) QueryByColor(ctx context.Context, color string) ([]parking.ParkedCar, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT slot, registration FROM slots WHERE lot = $1 AND color = $2 ORDER BY slot`,
+		s.lot, color)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parked []parking.ParkedCar
+	for rows.Next() {
+		p := parking.ParkedCar{Car: parking.Car{Color: color}}
+		if err := rows.Scan(&p.Slot, &p.Registration); err != nil {
+			return nil, err
+		}
+		parked = append(parked, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(parked) == 0 {
+		return nil, parking.ErrNotFound
+	}
+
+	return parked, nil
+}
+
+// QueryByReg returns the car with a registration number and the slot it is parked in
+func (s *Store) QueryByReg(ctx context.Context, registration string) (parking.ParkedCar, error) {
+	p := parking.ParkedCar{Car: parking.Car{Registration: registration}}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT slot, color FROM slots WHERE lot = $1 AND registration = $2`,
+		s.lot, registration).Scan(&p.Slot, &p.Color)
+	if errors.Is(err, sql.ErrNoRows) {
+		return parking.ParkedCar{}, parking.ErrNotFound
+	}
+	if err != nil {
+		return parking.ParkedCar{}, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,181 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+	_ "github.com/lib/pq"
+)
+
+// newTestStore returns a store of n slots in the database at PGSTORE_DSN, skipping the test if it is not set.
+// Each test gets a lot of its own, removed when the test ends.
+func newTestStore(t *testing.T, n int) (*Store, *sql.DB) {
+	t.Helper()
+	dsn := os.Getenv("PGSTORE_DSN")
+	if dsn == "" {
+		t.Skip("PGSTORE_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	lot := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	s := New(db, lot)
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateParkingLot(ctx, n); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM slots WHERE lot = $1`, lot) })
+	return s, db
+}
+
+func TestParkAndFree(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, 3)
+
+	if n, err := s.Capacity(ctx); err != nil || n != 3 {
+		t.Fatalf("capacity %d, %v; want 3", n, err)
+	}
+	for i, car := range []struct{ registration, color string }{
+		{"KA-01", "White"}, {"KA-02", "Red"}, {"KA-03", "White"},
+	} {
+		if slotNo, err := s.AllocateSlot(ctx, car.registration, car.color); err != nil || slotNo != i+1 {
+			t.Fatalf("%s parked in slot %d, %v; want %d", car.registration, slotNo, err, i+1)
+		}
+	}
+	if _, err := s.AllocateSlot(ctx, "KA-04", "Blue"); !errors.Is(err, parking.ErrLotFull) {
+		t.Errorf("park in a full lot: got %v, want ErrLotFull", err)
+	}
+
+	car, err := s.FreeSlot(ctx, 2)
+	if err != nil || car.Registration != "KA-02" || car.Color != "Red" {
+		t.Fatalf("freed %+v, %v; want KA-02", car, err)
+	}
+	if _, err := s.FreeSlot(ctx, 2); !errors.Is(err, parking.ErrSlotNotFound) {
+		t.Errorf("free an empty slot: got %v, want ErrSlotNotFound", err)
+	}
+	if _, err := s.QueryByReg(ctx, "KA-02"); !errors.Is(err, parking.ErrNotFound) {
+		t.Errorf("find a car that left: got %v, want ErrNotFound", err)
+	}
+
+	white, err := s.QueryByColor(ctx, "White")
+	if err != nil || len(white) != 2 || white[0].Slot != 1 || white[1].Slot != 3 {
+		t.Errorf("white cars %+v, %v; want slots 1 and 3", white, err)
+	}
+	if p, err := s.QueryByReg(ctx, "KA-03"); err != nil || p.Slot != 3 || p.Color != "White" {
+		t.Errorf("found KA-03 as %+v, %v; want slot 3", p, err)
+	}
+}
+
+func TestParkDuplicateRegistration(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, 2)
+
+	if _, err := s.AllocateSlot(ctx, "KA-01", "White"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AllocateSlot(ctx, "KA-01", "Black"); !errors.Is(err, parking.ErrAlreadyParked) {
+		t.Errorf("park a parked car: got %v, want ErrAlreadyParked", err)
+	}
+	if _, err := s.AllocateSlot(ctx, "KA-02", "Red"); err != nil {
+		t.Fatal(err)
+	}
+	// With the lot full the car is still reported as parked rather than the lot as full
+	if _, err := s.AllocateSlot(ctx, "KA-01", "Black"); !errors.Is(err, parking.ErrAlreadyParked) {
+		t.Errorf("park a parked car in a full lot: got %v, want ErrAlreadyParked", err)
+	}
+	if p, err := s.QueryByReg(ctx, "KA-01"); err != nil || p.Slot != 1 || p.Color != "White" {
+		t.Errorf("found KA-01 as %+v, %v; want the car parked first in slot 1", p, err)
+	}
+}
+
+func TestParkWhileFreeSlotsLocked(t *testing.T) {
+	ctx := context.Background()
+	s, db := newTestStore(t, 2)
+	if _, err := s.AllocateSlot(ctx, "KA-01", "White"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another gate holds the only free row and gives it up
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT slot FROM slots WHERE lot = $1 AND slot = 2 FOR UPDATE`, s.lot); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		slotNo int
+		err    error
+	}
+	done := make(chan result)
+	go func() {
+		slotNo, err := s.AllocateSlot(ctx, "KA-02", "Red")
+		done <- result{slotNo, err}
+	}()
+	select {
+	case r := <-done:
+		t.Fatalf("parked in slot %d, %v while the free slot was locked; want to wait for it", r.slotNo, r.err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-done; r.err != nil || r.slotNo != 2 {
+		t.Errorf("parked in slot %d, %v; want 2", r.slotNo, r.err)
+	}
+}
+
+// Run with go test -race
+func TestConcurrentPark(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, 10)
+
+	var mu sync.Mutex
+	var slots []int
+	full := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slotNo, err := s.AllocateSlot(ctx, fmt.Sprintf("KA-%02d", i), "White")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, parking.ErrLotFull):
+				full++
+			case err != nil:
+				t.Error(err)
+			default:
+				slots = append(slots, slotNo)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Ints(slots)
+	if full != 10 || len(slots) != 10 {
+		t.Fatalf("%d cars parked and %d turned away, want 10 of each", len(slots), full)
+	}
+	for i, slotNo := range slots {
+		if slotNo != i+1 {
+			t.Fatalf("cars parked in slots %v, want 1 to 10 once each", slots)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package redislot implements a parking lot whose state lives in Redis, so that
+// several gate processes can allocate and free slots in the same lot.
+//
+// Free slots are kept in a sorted set scored by slot number, so the nearest free
+// slot is always the lowest. Parked cars are kept in a hash by slot, indexed by a
+// hash of registration numbers and one sorted set of slots per color. Park and
+// Leave run as Lua scripts so each is applied atomically.
+package redislot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/arjun759/car-parking/parking"
+	"github.com/redis/go-redis/v9"
+)
+
+// Lot is a parking lot stored in Redis under a key prefix
+type Lot struct {
+	rdb    redis.UniversalClient
+	prefix string // Prefix of every key belonging to this lot, such as "lot:main:"
+}
+
+// New returns a Lot that keeps its state in rdb under keys starting with name and a colon
+func New(rdb redis.UniversalClient, name string) *Lot {
+	return &Lot{rdb: rdb, prefix: name + ":"}
+}
+
+// key returns the Redis key for one part of the lot state
+func (l *Lot) key(part string) string {
+	return l.prefix + part
+}
+
+// colorKey returns the key of the sorted set holding the slots of cars of a color
+func (l *Lot) colorKey(color string) string {
+	return l.prefix + "color:" + color
+}
+
+// CreateParkingLot discards any existing state of the lot and creates n free slots
+func (l *Lot) CreateParkingLot(ctx context.Context, n int) error {
+	var colorKeys []string
+	iter := l.rdb.Scan(ctx, 0, l.colorKey("*"), 0).Iterator()
+	for iter.Next(ctx) {
+		colorKeys = append(colorKeys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	free := make([]redis.Z, 0, n)
+	for i := 1; i <= n; i++ {
+		free = append(free, redis.Z{Score: float64(i), Member: i})
+	}
+
+	_, err := l.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, append(colorKeys, l.key("capacity"), l.key("free"), l.key("cars"), l.key("reg"))...)
+		pipe.Set(ctx, l.key("capacity"), n, 0)
+		if n > 0 {
+			pipe.ZAdd(ctx, l.key("free"), free...)
+		}
+		return nil
+	})
+	return err
+}
+
+// Capacity returns the number of slots, or zero before CreateParkingLot
+func (l *Lot) Capacity(ctx context.Context) (int, error) {
+	n, err := l.rdb.Get(ctx, l.key("capacity")).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// parkScript takes the lowest free slot and records the car in it, returning 0 when the lot is full
+// and the negated slot of a car with the same registration that is already parked.
+// KEYS: free, cars, reg, color set. ARGV: registration, car JSON.
+var parkScript = redis.NewScript(`
+local parked = redis.call('HGET', KEYS[3], ARGV[1])
+if parked then
+	return -tonumber(parked)
+end
+local popped = redis.call('ZPOPMIN', KEYS[1])
+if #popped == 0 then
+	return 0
+end
+local slot = popped[1]
+redis.call('HSET', KEYS[2], slot, ARGV[2])
+redis.call('HSET', KEYS[3], ARGV[1], slot)
+redis.call('ZADD', KEYS[4], slot, slot)
+return tonumber(slot)
+`)
+
+// Park parks a car in the nearest free slot and returns the slot number. It returns ErrAlreadyParked with the
+// car's slot if a car with the same registration number is already parked.
+func (l *Lot) Park(ctx context.Context, registration string, color string) (int, error) {
+	car, err := json.Marshal(parking.Car{Registration: registration, Color: color})
+	if err != nil {
+		return 0, err
+	}
+
+	keys := []string{l.key("free"), l.key("cars"), l.key("reg"), l.colorKey(color)}
+	slotNo, err := parkScript.Run(ctx, l.rdb, keys, registration, car).Int()
+	if err != nil {
+		return 0, err
+	}
+	if slotNo == 0 {
+		return 0, parking.ErrLotFull
+	}
+	if slotNo < 0 {
+		return -slotNo, fmt.Errorf("%w in slot %d", parking.ErrAlreadyParked, -slotNo)
+	}
+	return slotNo, nil
+}
+
+// leaveScript removes the car from a slot and returns the slot to the free set, replying with the
+// car's JSON or nil when the slot is empty. The color set key is derived from the car, so it is
+// built from the prefix in ARGV rather than passed in KEYS.
+// KEYS: cars, reg, free. ARGV: slot, color key prefix.
+var leaveScript = redis.NewScript(`
+local car = redis.call('HGET', KEYS[1], ARGV[1])
+if not car then
+	return false
+end
+local decoded = cjson.decode(car)
+redis.call('HDEL', KEYS[1], ARGV[1])
+if redis.call('HGET', KEYS[2], decoded.registration) == ARGV[1] then
+	redis.call('HDEL', KEYS[2], decoded.registration)
+end
+redis.call('ZREM', ARGV[2] .. decoded.color, ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[1], ARGV[1])
+return car
+`)
+
+// Leave frees up a slot and returns the car that was parked in it
+func (l *Lot) Leave(ctx context.Context, slotNo int) (*parking.Car, error) {
+	keys := []string{l.key("cars"), l.key("reg"), l.key("free")}
+	data, err := leaveScript.Run(ctx, l.rdb, keys, slotNo, l.colorKey("")).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, parking.ErrSlotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var car parking.Car
+	if err := json.Unmarshal([]byte(data), &car); err != nil {
+		return nil, err
+	}
+	return &car, nil
+}
+
+// Status returns the parked cars ordered by slot number
+func (l *Lot) Status(ctx context.Context) ([]parking.ParkedCar, error) {
+	cars, err := l.rdb.HGetAll(ctx, l.key("cars")).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	parked := make([]parking.ParkedCar, 0, len(cars))
+	for field, data := range cars {
+		slotNo, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		p := parking.ParkedCar{Slot: slotNo}
+		if err := json.Unmarshal([]byte(data), &p.Car); err != nil {
+			return nil, err
+		}
+		parked = append(parked, p)
+	}
+	sort.Slice(parked, func(i, j int) bool { return parked[i].Slot < parked[j].Slot })
+	return parked, nil
+}
+
+// RegistrationNumbersForColor returns registration numbers of all cars with a particular color, ordered by slot
+func (l *Lot) RegistrationNumbersForColor(ctx context.Context, color string) ([]string, error) {
+	slots, err := l.rdb.ZRange(ctx, l.colorKey(color), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, parking.ErrNotFound
+	}
+
+	cars, err := l.rdb.HMGet(ctx, l.key("cars"), slots...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	regNumbers := make([]string, 0, len(cars))
+	for _, data := range cars {
+		// A car that left between the two reads comes back as nil
+		s, ok := data.(string)
+		if !ok {
+			continue
+		}
+		var car parking.Car
+		if err := json.Unmarshal([]byte(s), &car); err != nil {
+			return nil, err
+		}
+		regNumbers = append(regNumbers, car.Registration)
+	}
+	if len(regNumbers) == 0 {
+		return nil, parking.ErrNotFound
+	}
+
+	return regNumbers, nil
+}
+
+// SlotNumbersForColor returns slot numbers of all slots where a car of a particular color is parked, in ascending order
+func (l *Lot) SlotNumbersForColor(ctx context.Context, color string) ([]int, error) {
+	slots, err := l.rdb.ZRange(ctx, l.colorKey(color), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, parking.ErrNotFound
+	}
+
+	slotNos := make([]int, 0, len(slots))
+	for _, s := range slots {
+		slotNo, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		slotNos = append(slotNos, slotNo)
+	}
+
+	return slotNos, nil
+}
+
+// SlotNumberForRegistrationNumber returns the slot number for a car with a given registration number
+func (l *Lot) SlotNumberForRegistrationNumber(ctx context.Context, registration string) (int, error) {
+	slotNo, err := l.rdb.HGet(ctx, l.key("reg"), registration).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, parking.ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return slotNo, nil
+}
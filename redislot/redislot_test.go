@@ -0,0 +1,70 @@
+package redislot
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/arjun759/car-parking/parking"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestLot returns a lot of n slots kept in an in-process Redis
+func newTestLot(t *testing.T, n int) *Lot {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	l := New(rdb, "test")
+	if err := l.CreateParkingLot(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestParkDuplicateRegistration(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLot(t, 4)
+	for _, registration := range []string{"KA-01", "KA-02"} {
+		if _, err := l.Park(ctx, registration, "White"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := l.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slotNo, err := l.Park(ctx, "KA-02", "Black")
+	if !errors.Is(err, parking.ErrAlreadyParked) {
+		t.Fatalf("got %v, want ErrAlreadyParked", err)
+	}
+	if slotNo != 2 {
+		t.Errorf("got slot %d, want 2", slotNo)
+	}
+
+	after, err := l.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("status changed to %v from %v", after, before)
+	}
+	if got, err := l.SlotNumberForRegistrationNumber(ctx, "KA-02"); err != nil || got != 2 {
+		t.Errorf("KA-02 is in slot %d, %v; want 2", got, err)
+	}
+	if got, err := l.SlotNumbersForColor(ctx, "White"); err != nil || !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("White cars are in %v, %v; want [1 2]", got, err)
+	}
+	if got, err := l.SlotNumbersForColor(ctx, "Black"); !errors.Is(err, parking.ErrNotFound) {
+		t.Errorf("Black cars are in %v, %v; want none", got, err)
+	}
+
+	// The free slot the duplicate would have taken is still handed out next
+	if slotNo, err := l.Park(ctx, "KA-03", "Red"); err != nil || slotNo != 3 {
+		t.Errorf("got slot %d, %v; want 3", slotNo, err)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// Codes identifying what went wrong in an error response
+const (
+	CodeInvalidRequest  = "invalid_request"
+	CodeLotFull         = "lot_full"
+	CodeAlreadyParked   = "already_parked"
+	CodeRegistration    = "invalid_registration"
+	CodeSlotUnavailable = "slot_unavailable"
+	CodeSlotNotFound    = "slot_not_found"
+	CodeNotFound        = "not_found"
+	CodeAllotmentFull   = "allotment_full"
+	CodeQuotaExceeded   = "quota_exceeded"
+	CodeBookingDate     = "booking_date_passed"
+	CodeReservation     = "invalid_reservation_window"
+	CodeFullyReserved   = "fully_reserved"
+	CodeAlreadyReserved = "already_reserved"
+	CodeUnauthorized    = "unauthorized"
+	CodePaymentDeclined = "payment_declined"
+	CodeNoGateway       = "payments_unavailable"
+	CodeRefundAmount    = "invalid_refund_amount"
+	CodeRefunding       = "refund_in_progress"
+	CodeExiting         = "exit_in_progress"
+	CodeFloorNotFound   = "floor_not_found"
+	CodeNoSlot          = "no_such_slot"
+	CodeGateNotFound    = "gate_not_found"
+	CodeQueueLength     = "invalid_queue_length"
+	CodeNoFittingSlot   = "no_fitting_slot"
+	CodeNoMismatch      = "no_mismatch"
+	CodeNoFreeCharger   = "no_free_charger"
+	CodeNoCharger       = "no_charger"
+	CodeCharging        = "already_charging"
+	CodeNotCharging     = "not_charging"
+	CodeUnknownService  = "unknown_service"
+	CodeEvacuating      = "evacuating"
+	CodeNotEvacuating   = "not_evacuating"
+	CodeNotCleaning     = "not_cleaning"
+	CodeInternal        = "internal"
+)
+
+// Error is the body of a failed request, under the "error" key
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"` // Request field that was invalid, if any
+	Retryable bool   `json:"retryable"`       // Whether the same request may succeed if sent again later
+}
+
+// errorJSON is the JSON form of a failed request
+type errorJSON struct {
+	Error Error `json:"error"`
+}
+
+// errorMappings maps the parking sentinel errors to their HTTP status and error code
+var errorMappings = []struct {
+	err       error
+	status    int
+	code      string
+	retryable bool
+}{
+	{parking.ErrLotFull, http.StatusConflict, CodeLotFull, true},
+	{parking.ErrAlreadyParked, http.StatusConflict, CodeAlreadyParked, false},
+	{parking.ErrInvalidRegistration, http.StatusUnprocessableEntity, CodeRegistration, false},
+	{parking.ErrSlotUnavailable, http.StatusConflict, CodeSlotUnavailable, true},
+	{parking.ErrSlotNotFound, http.StatusNotFound, CodeSlotNotFound, false},
+	{parking.ErrNotFound, http.StatusNotFound, CodeNotFound, false},
+	{parking.ErrAllotmentFull, http.StatusConflict, CodeAllotmentFull, false},
+	{parking.ErrQuotaExceeded, http.StatusTooManyRequests, CodeQuotaExceeded, false},
+	{parking.ErrBookingDate, http.StatusUnprocessableEntity, CodeBookingDate, false},
+	{parking.ErrReservationWindow, http.StatusUnprocessableEntity, CodeReservation, false},
+	{parking.ErrFullyReserved, http.StatusConflict, CodeFullyReserved, false},
+	{parking.ErrAlreadyReserved, http.StatusConflict, CodeAlreadyReserved, false},
+	{parking.ErrPaymentDeclined, http.StatusPaymentRequired, CodePaymentDeclined, false},
+	{parking.ErrNoGateway, http.StatusNotImplemented, CodeNoGateway, false},
+	{parking.ErrRefundAmount, http.StatusUnprocessableEntity, CodeRefundAmount, false},
+	{parking.ErrRefundInProgress, http.StatusConflict, CodeRefunding, true},
+	{parking.ErrExitInProgress, http.StatusConflict, CodeExiting, true},
+	{parking.ErrFloorNotFound, http.StatusNotFound, CodeFloorNotFound, false},
+	{parking.ErrNoSlot, http.StatusNotFound, CodeNoSlot, false},
+	{parking.ErrGateNotFound, http.StatusUnprocessableEntity, CodeGateNotFound, false},
+	{parking.ErrQueueLength, http.StatusUnprocessableEntity, CodeQueueLength, false},
+	{parking.ErrNoFittingSlot, http.StatusConflict, CodeNoFittingSlot, true},
+	{parking.ErrNoMismatch, http.StatusUnprocessableEntity, CodeNoMismatch, false},
+	{parking.ErrNoFreeCharger, http.StatusConflict, CodeNoFreeCharger, true},
+	{parking.ErrNoCharger, http.StatusUnprocessableEntity, CodeNoCharger, false},
+	{parking.ErrCharging, http.StatusConflict, CodeCharging, false},
+	{parking.ErrNotCharging, http.StatusConflict, CodeNotCharging, false},
+	{parking.ErrUnknownService, http.StatusUnprocessableEntity, CodeUnknownService, false},
+	{parking.ErrEvacuating, http.StatusServiceUnavailable, CodeEvacuating, true},
+	{parking.ErrNotEvacuating, http.StatusConflict, CodeNotEvacuating, false},
+	{parking.ErrNotCleaning, http.StatusConflict, CodeNotCleaning, false},
+}
+
+// writeInvalid writes a 400 error for a request field that is missing or malformed
+func writeInvalid(w http.ResponseWriter, field string, message string) {
+	writeJSON(w, http.StatusBadRequest, errorJSON{Error{Code: CodeInvalidRequest, Message: message, Field: field}})
+}
+
+// writeErr maps a parking error to its HTTP status and error code and writes it
+func writeErr(w http.ResponseWriter, err error) {
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			writeJSON(w, m.status, errorJSON{Error{Code: m.code, Message: err.Error(), Retryable: m.retryable}})
+			return
+		}
+	}
+	writeJSON(w, http.StatusInternalServerError, errorJSON{Error{Code: CodeInternal, Message: err.Error(), Retryable: true}})
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// feedBuffer is how many events a subscriber may fall behind before it is disconnected
+const feedBuffer = 64
+
+// Event is a change in slot occupancy streamed to live feed subscribers
+type Event struct {
+	Type         string    `json:"type"` // EventSlotAllocated, EventSlotFreed or EventSizeMismatch
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Color        string    `json:"color"`
+	Vehicle      string    `json:"vehicle,omitempty"` // Type the vehicle turned out to be, for EventSizeMismatch
+	Target       int       `json:"target,omitempty"`  // Free slot suggested for moving the vehicle to, for EventSizeMismatch
+	Time         time.Time `json:"time"`
+}
+
+const (
+	// EventSlotAllocated is sent when a car is parked
+	EventSlotAllocated = "slot_allocated"
+	// EventSlotFreed is sent when a slot becomes free
+	EventSlotFreed = "slot_freed"
+	// EventSizeMismatch is sent when a parked vehicle is reported as too big for its slot
+	EventSizeMismatch = "size_mismatch"
+)
+
+// feed fans occupancy events out to subscribers
+type feed struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// subscribe registers a new subscriber and returns its event channel
+func (f *feed) subscribe() chan Event {
+	ch := make(chan Event, feedBuffer)
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan Event]struct{})
+	}
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch
+}
+
+// unsubscribe removes a subscriber and closes its channel if it is still registered
+func (f *feed) unsubscribe(ch chan Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// publish sends an event to every subscriber, dropping any that have fallen too far behind
+func (f *feed) publish(e Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// serveFeed streams occupancy events to one WebSocket client until either side closes
+func (s *Server) serveFeed(ws *websocket.Conn) {
+	ch := s.feed.subscribe()
+	defer s.feed.unsubscribe(ch)
+
+	// Clients only listen; reading detects when they go away.
+	closed := make(chan struct{})
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		close(closed)
+	}()
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				ws.Close()
+				return
+			}
+			if err := websocket.JSON.Send(ws, e); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// bookingRequest is the body of POST /partner/bookings
+type bookingRequest struct {
+	Registration string `json:"registration"`
+	Date         string `json:"date"` // Day the car is due, as 2006-01-02
+}
+
+// partnerHandler serves a request from the partner authenticated by the request's API key
+type partnerHandler func(w http.ResponseWriter, r *http.Request, p parking.Partner)
+
+// authPartner authenticates a partner by the bearer token in the Authorization header before calling h
+func (s *Server) authPartner(h partnerHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		p, known := s.cp.PartnerForKey(key)
+		if !ok || !known {
+			writeJSON(w, http.StatusUnauthorized, errorJSON{Error{Code: CodeUnauthorized, Message: "missing or unknown API key"}})
+			return
+		}
+		h(w, r, p)
+	}
+}
+
+// capacity returns how many bookings the partner may still make for the day in the date query parameter
+func (s *Server) capacity(w http.ResponseWriter, r *http.Request, p parking.Partner) {
+	date, err := time.Parse(time.DateOnly, r.URL.Query().Get("date"))
+	if err != nil {
+		writeInvalid(w, "date", "date must be given as YYYY-MM-DD")
+		return
+	}
+
+	capacity, err := s.cp.PartnerCapacity(p.Name, date)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, capacity)
+}
+
+// book accepts the partner's booking in the request body
+func (s *Server) book(w http.ResponseWriter, r *http.Request, p parking.Partner) {
+	var req bookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Registration == "" {
+		writeInvalid(w, "registration", "registration is required")
+		return
+	}
+	date, err := time.Parse(time.DateOnly, req.Date)
+	if err != nil {
+		writeInvalid(w, "date", "date must be given as YYYY-MM-DD")
+		return
+	}
+
+	booking, err := s.cp.Book(p.Name, req.Registration, date)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, booking)
+}
+
+// booking returns the partner's booking in the path
+func (s *Server) booking(w http.ResponseWriter, r *http.Request, p parking.Partner) {
+	booking, err := s.cp.PartnerBooking(p.Name, r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, booking)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// payRequest is the body of POST /cars/{registration}/pay
+type payRequest struct {
+	PaymentMethod string `json:"payment_method"` // Payment provider's token for the driver's card
+}
+
+// paymentJSON is the JSON form of a payment's status or of a refund of it
+type paymentJSON struct {
+	PaymentID string `json:"payment_id"`
+	Status    string `json:"status,omitempty"`
+	Refunded  int    `json:"refunded,omitempty"`
+}
+
+// refundRequest is the body of POST /payments/{id}/refund
+type refundRequest struct {
+	Amount int `json:"amount"`
+}
+
+// pay collects the amount due for the car in the path with the payment method in the body, then frees
+// its slot and returns the receipt
+func (s *Server) pay(w http.ResponseWriter, r *http.Request) {
+	var req payRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.PaymentMethod == "" {
+		writeInvalid(w, "payment_method", "payment_method is required")
+		return
+	}
+
+	bill, err := s.cp.PayAndExit(r.Context(), r.PathValue("registration"), req.PaymentMethod)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, bill)
+}
+
+// paymentStatus returns how far the payment in the path has got with the payment provider
+func (s *Server) paymentStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	status, err := s.cp.PaymentStatus(r.Context(), id)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, paymentJSON{PaymentID: id, Status: string(status)})
+}
+
+// refund returns the amount in the body of the payment in the path to the driver
+func (s *Server) refund(w http.ResponseWriter, r *http.Request) {
+	var req refundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := s.cp.Refund(r.Context(), id, req.Amount); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, paymentJSON{PaymentID: id, Refunded: req.Amount})
+}
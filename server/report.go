@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// period parses the from and to query parameters giving the first and last day of a report
+func period(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	from, err := time.Parse(time.DateOnly, r.URL.Query().Get("from"))
+	if err != nil {
+		writeInvalid(w, "from", "from must be given as YYYY-MM-DD")
+		return time.Time{}, time.Time{}, false
+	}
+	to, err := time.Parse(time.DateOnly, r.URL.Query().Get("to"))
+	if err != nil {
+		writeInvalid(w, "to", "to must be given as YYYY-MM-DD")
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// revenue returns the amount billed in the period and the commission owed to each partner
+func (s *Server) revenue(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := period(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.cp.RevenueReport(from, to))
+}
+
+// gateThroughput returns how many cars entered through each gate in the period and the longest queue
+func (s *Server) gateThroughput(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := period(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.cp.GateThroughput(from, to))
+}
+
+// origins returns how many arrivals in the period came from each plate jurisdiction, most common first
+func (s *Server) origins(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := period(w, r)
+	if !ok {
+		return
+	}
+
+	mix, err := s.cp.OriginMix(from, to)
+	if err != nil && !errors.Is(err, parking.ErrNotFound) {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, append([]parking.OriginShare{}, mix...))
+}
+
+// commissions returns the commission owed to each partner in the period as CSV for invoicing
+func (s *Server) commissions(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := period(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="commissions.csv"`)
+	s.cp.RevenueReport(from, to).WriteCommissionsCSV(w)
+}
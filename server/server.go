@@ -0,0 +1,941 @@
+// Package server exposes a parking.Carpark over a JSON HTTP API.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arjun759/car-parking/parking"
+	"golang.org/x/net/websocket"
+)
+
+// Server serves the parking lot's HTTP API
+type Server struct {
+	cp           *parking.Carpark
+	mux          *http.ServeMux
+	feed         feed
+	operatorKeys []string // API keys of the lot's operators, who alone may refund payments, force slots free, evacuate the lot and read its reports on revenue and origins
+}
+
+// carJSON is the JSON form of a parked car
+type carJSON struct {
+	Slot         int       `json:"slot"`
+	Registration string    `json:"registration"`
+	Color        string    `json:"color"`
+	Vehicle      string    `json:"vehicle,omitempty"` // Omitted for cars
+	Ticket       string    `json:"ticket,omitempty"`
+	ParkedAt     time.Time `json:"parked_at"`
+}
+
+// evacuationJSON is the JSON form of an evacuation report
+type evacuationJSON struct {
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"` // Omitted while the evacuation is under way
+	Parked    int        `json:"parked"`        // Vehicles in the lot when the evacuation started
+	Left      int        `json:"left"`          // Vehicles that left during the evacuation
+	Remaining []carJSON  `json:"remaining"`     // Vehicles still in the lot, by slot
+}
+
+// violationRequest is the body of POST /violations
+type violationRequest struct {
+	Registration string `json:"registration"`
+	Location     string `json:"location"` // Where the vehicle is, such as "fire lane by gate B"
+}
+
+// reservationRequest is the body of POST /reservations
+type reservationRequest struct {
+	Registration string    `json:"registration"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+}
+
+// slotNoteRequest is the body of POST /slots/{n}/notes
+type slotNoteRequest struct {
+	Text      string `json:"text"`
+	Attention bool   `json:"attention"` // Whether the slot needs maintenance until the note is resolved
+}
+
+// forceFreeRequest is the body of POST /slots/{n}/force-free
+type forceFreeRequest struct {
+	Reason string `json:"reason"` // Why the bay is empty though a car is recorded in it, such as towed
+}
+
+// slotAssetRequest is the body of PUT /slots/{n}/assets/{key}
+type slotAssetRequest struct {
+	Value string `json:"value"`
+}
+
+// mismatchRequest is the body of POST /cars/{registration}/mismatch
+type mismatchRequest struct {
+	Vehicle string `json:"vehicle"`          // Type the vehicle turned out to be
+	Source  string `json:"source,omitempty"` // Sensor or attendant reporting it
+}
+
+// parkRequest is the body of POST /slots/park
+type parkRequest struct {
+	Registration string `json:"registration"`
+	Color        string `json:"color"`
+	Vehicle      string `json:"vehicle,omitempty"`  // Motorcycle, compact, car or truck, a car if empty
+	Gate         string `json:"gate,omitempty"`     // Entry gate the car came through, to park it in the slot nearest that gate
+	Charging     bool   `json:"charging,omitempty"` // Whether to park the car in a slot with an EV charger
+	Permit       bool   `json:"permit,omitempty"`   // Whether the driver holds an accessibility permit, to park in an accessible slot
+	Slot         int    `json:"slot,omitempty"`     // Slot the driver asked for, for a car only
+	Fallback     bool   `json:"fallback,omitempty"` // Whether to park in the nearest free slot when the one asked for is not free
+}
+
+// endChargingRequest is the body of POST /cars/{registration}/charging/end
+type endChargingRequest struct {
+	KWh *float64 `json:"kwh"` // Energy delivered, as metered by the charger
+}
+
+// queueRequest is the body of PUT /gates/{gate}/queue
+type queueRequest struct {
+	Length *int `json:"length"` // Cars counted in the queue
+}
+
+// evidenceRequest is the body of POST /cars/{registration}/evidence
+type evidenceRequest struct {
+	Ref string `json:"ref"` // Photo reference such as a URL or object-store key
+}
+
+// evidenceJSON is the JSON form of the photo references attached to a parked car
+type evidenceJSON struct {
+	Slot         int      `json:"slot"`
+	Registration string   `json:"registration"`
+	Evidence     []string `json:"evidence"`
+}
+
+// noteRequest is the body of POST /cars/{registration}/notes
+type noteRequest struct {
+	Text     string `json:"text"`
+	Incident bool   `json:"incident"` // Whether the note flags an incident such as observed damage or an alarm
+}
+
+// notesJSON is the JSON form of the notes attached to a parked car
+type notesJSON struct {
+	Slot         int            `json:"slot"`
+	Registration string         `json:"registration"`
+	Notes        []parking.Note `json:"notes"`
+}
+
+// slotUsageJSON is the JSON form of how many times a slot has been allocated
+type slotUsageJSON struct {
+	Slot        int `json:"slot"`
+	Allocations int `json:"allocations"`
+}
+
+// serviceRequest is the body of POST /cars/{registration}/services
+type serviceRequest struct {
+	Service string `json:"service"` // Name of a service in the lot's catalog
+}
+
+// New returns a Server for an already created parking lot. Refunds, forced frees, evacuations and the revenue,
+// commissions and origins reports are only accepted from requests bearing one of operatorKeys, so with none they
+// are refused.
+func New(cp *parking.Carpark, operatorKeys ...string) *Server {
+	s := &Server{cp: cp, mux: http.NewServeMux(), operatorKeys: operatorKeys}
+	s.mux.HandleFunc("POST /slots/park", s.park)
+	s.mux.HandleFunc("DELETE /slots/{n}", s.leave)
+	s.mux.HandleFunc("POST /slots/{n}/force-free", s.authOperator(s.forceFree))
+	s.mux.HandleFunc("GET /slots", s.status)
+	s.mux.HandleFunc("GET /floors", s.floors)
+	s.mux.HandleFunc("GET /stats", s.stats)
+	s.mux.HandleFunc("GET /slots/vacant", s.vacancies)
+	s.mux.HandleFunc("GET /slots/usage", s.slotUsage)
+	s.mux.HandleFunc("GET /cars", s.cars)
+	s.mux.HandleFunc("GET /cars/{registration}", s.car)
+	s.mux.HandleFunc("DELETE /cars/{registration}", s.leaveByRegistration)
+	s.mux.HandleFunc("POST /cars/{registration}/exit", s.exit)
+	s.mux.HandleFunc("POST /cars/{registration}/restore", s.restore)
+	s.mux.HandleFunc("POST /cars/{registration}/pay", s.pay)
+	s.mux.HandleFunc("POST /cars/{registration}/mismatch", s.reportMismatch)
+	s.mux.HandleFunc("GET /mismatches", s.mismatches)
+	s.mux.HandleFunc("POST /cars/{registration}/charging", s.startCharging)
+	s.mux.HandleFunc("POST /cars/{registration}/charging/end", s.endCharging)
+	s.mux.HandleFunc("POST /cars/{registration}/services", s.addService)
+	s.mux.HandleFunc("GET /services", s.services)
+	s.mux.HandleFunc("POST /cars/{registration}/evidence", s.attachEvidence)
+	s.mux.HandleFunc("GET /cars/{registration}/evidence", s.evidence)
+	s.mux.HandleFunc("POST /cars/{registration}/notes", s.addNote)
+	s.mux.HandleFunc("GET /cars/{registration}/notes", s.notes)
+	s.mux.HandleFunc("PUT /gates/{gate}/queue", s.reportQueue)
+	s.mux.HandleFunc("POST /gates/{gate}/queue", s.joinQueue)
+	s.mux.HandleFunc("GET /queues", s.queues)
+	s.mux.HandleFunc("POST /violations", s.logViolation)
+	s.mux.HandleFunc("DELETE /violations/{id}", s.clearViolation)
+	s.mux.HandleFunc("GET /violations", s.violations)
+	s.mux.HandleFunc("GET /tow-list", s.towList)
+	s.mux.HandleFunc("POST /reservations", s.reserve)
+	s.mux.HandleFunc("GET /reservations", s.reservations)
+	s.mux.HandleFunc("GET /reservations/{id}", s.reservation)
+	s.mux.HandleFunc("GET /slots/{n}", s.slotInfo)
+	s.mux.HandleFunc("POST /slots/{n}/notes", s.addSlotNote)
+	s.mux.HandleFunc("POST /slots/notes/{id}/resolve", s.resolveSlotNote)
+	s.mux.HandleFunc("PUT /slots/{n}/assets/{key}", s.setSlotAsset)
+	s.mux.HandleFunc("DELETE /slots/{n}/assets/{key}", s.setSlotAsset)
+	s.mux.HandleFunc("GET /maintenance", s.maintenance)
+	s.mux.HandleFunc("GET /cleaning", s.cleaning)
+	s.mux.HandleFunc("DELETE /cleaning/{n}", s.endCleaning)
+	s.mux.HandleFunc("POST /evacuation", s.authOperator(s.startEvacuation))
+	s.mux.HandleFunc("DELETE /evacuation", s.authOperator(s.endEvacuation))
+	s.mux.HandleFunc("GET /evacuation", s.evacuation)
+	s.mux.HandleFunc("GET /payments/{id}", s.paymentStatus)
+	s.mux.HandleFunc("POST /payments/{id}/refund", s.authOperator(s.refund))
+	s.mux.HandleFunc("GET /tickets/{id}", s.ticket)
+	s.mux.HandleFunc("DELETE /tickets/{id}", s.checkout)
+	s.mux.HandleFunc("GET /reports/revenue", s.authOperator(s.revenue))
+	s.mux.HandleFunc("GET /reports/commissions.csv", s.authOperator(s.commissions))
+	s.mux.HandleFunc("GET /reports/origins", s.authOperator(s.origins))
+	s.mux.HandleFunc("GET /reports/gate-throughput", s.gateThroughput)
+	s.mux.HandleFunc("GET /partner/capacity", s.authPartner(s.capacity))
+	s.mux.HandleFunc("POST /partner/bookings", s.authPartner(s.book))
+	s.mux.HandleFunc("GET /partner/bookings/{id}", s.authPartner(s.booking))
+	s.mux.Handle("GET /feed", websocket.Server{Handler: s.serveFeed})
+	cp.Subscribe(s.publish)
+	return s
+}
+
+// authOperator checks that the bearer token in the Authorization header is an operator's API key before calling h
+func (s *Server) authOperator(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || key == "" || !slices.ContainsFunc(s.operatorKeys, func(k string) bool {
+			return subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1
+		}) {
+			writeJSON(w, http.StatusUnauthorized, errorJSON{Error{Code: CodeUnauthorized, Message: "missing or unknown API key"}})
+			return
+		}
+		h(w, r)
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// park allocates a slot for the car in the request body
+func (s *Server) park(w http.ResponseWriter, r *http.Request) {
+	var req parkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Registration == "" {
+		writeInvalid(w, "registration", "registration is required")
+		return
+	}
+	if req.Color == "" {
+		writeInvalid(w, "color", "color is required")
+		return
+	}
+	vehicle := parking.VehicleCar
+	if req.Vehicle != "" {
+		var err error
+		if vehicle, err = parking.ParseVehicleType(req.Vehicle); err != nil {
+			writeInvalid(w, "vehicle", "vehicle must be motorcycle, compact, car or truck")
+			return
+		}
+	}
+
+	if req.Gate != "" && req.Charging {
+		writeInvalid(w, "charging", "a charging slot cannot be requested with a gate")
+		return
+	}
+	if req.Permit && (req.Gate != "" || req.Charging) {
+		writeInvalid(w, "permit", "a permit holder cannot request a gate or a charging slot")
+		return
+	}
+	if req.Slot < 0 || req.Slot > 0 && (vehicle != parking.VehicleCar || req.Gate != "" || req.Charging || req.Permit) {
+		writeInvalid(w, "slot", "a slot can only be requested for a car, without a gate, charging or permit")
+		return
+	}
+	if req.Fallback && req.Slot == 0 {
+		writeInvalid(w, "fallback", "fallback needs a slot")
+		return
+	}
+
+	var ticket parking.Ticket
+	var err error
+	if req.Slot > 0 {
+		ticket, err = s.parkInSlot(req)
+	} else if req.Gate != "" {
+		ticket, err = s.cp.ParkFromGate(req.Gate, req.Registration, req.Color, vehicle)
+	} else if req.Charging {
+		ticket, err = s.cp.ParkCharging(req.Registration, req.Color, vehicle)
+	} else if req.Permit {
+		ticket, err = s.cp.ParkWithPermit(req.Registration, req.Color, vehicle)
+	} else {
+		ticket, err = s.cp.ParkVehicle(req.Registration, req.Color, vehicle)
+	}
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	parked := carJSON{Slot: ticket.Slot, Registration: req.Registration, Color: req.Color, Ticket: ticket.ID, ParkedAt: ticket.EntryTime}
+	if vehicle != parking.VehicleCar {
+		parked.Vehicle = string(vehicle)
+	}
+	writeJSON(w, http.StatusCreated, parked)
+}
+
+// parkInSlot parks the car in the request in the slot it asked for, or in the nearest free slot if that one
+// is not free and the request allows it, and returns its ticket
+func (s *Server) parkInSlot(req parkRequest) (parking.Ticket, error) {
+	policy := parking.RequireSlot
+	if req.Fallback {
+		policy = parking.FallbackToNearest
+	}
+	if _, err := s.cp.ParkInSlot(req.Registration, req.Color, req.Slot, policy); err != nil {
+		return parking.Ticket{}, err
+	}
+	parked, err := s.cp.FindCar(req.Registration)
+	if err != nil {
+		return parking.Ticket{}, err
+	}
+	return parking.Ticket{ID: parked.Ticket, Slot: parked.Slot, Registration: parked.Registration, EntryTime: parked.ParkedAt}, nil
+}
+
+// leave frees the slot in the path
+func (s *Server) leave(w http.ResponseWriter, r *http.Request) {
+	slotNo, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeInvalid(w, "slot", "invalid slot number")
+		return
+	}
+
+	car, err := s.cp.Leave(slotNo)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, carJSON{Slot: slotNo, Registration: car.Registration, Color: car.Color, ParkedAt: car.ParkedAt})
+}
+
+// forceFree frees the slot in the path whose bay is empty though a car is recorded in it, and returns the reconciliation
+func (s *Server) forceFree(w http.ResponseWriter, r *http.Request) {
+	slotNo, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeInvalid(w, "slot", "invalid slot number")
+		return
+	}
+	var req forceFreeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Reason == "" {
+		writeInvalid(w, "reason", "reason is required")
+		return
+	}
+
+	rec, err := s.cp.ForceFree(slotNo, req.Reason)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// leaveByRegistration frees the slot held by the car in the path
+func (s *Server) leaveByRegistration(w http.ResponseWriter, r *http.Request) {
+	registration := r.PathValue("registration")
+
+	parked, err := s.cp.LeaveByRegistration(registration)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, carJSON{Slot: parked.Slot, Registration: parked.Registration, Color: parked.Color, ParkedAt: parked.ParkedAt})
+}
+
+// restore puts back the car in the path, which left by mistake within the restore window
+func (s *Server) restore(w http.ResponseWriter, r *http.Request) {
+	registration := r.PathValue("registration")
+	if _, err := s.cp.Restore(registration); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	parked, err := s.cp.FindCar(registration)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	restored := carJSON{Slot: parked.Slot, Registration: parked.Registration, Color: parked.Color, Ticket: parked.Ticket, ParkedAt: parked.ParkedAt}
+	if parked.Vehicle != "" && parked.Vehicle != parking.VehicleCar {
+		restored.Vehicle = string(parked.Vehicle)
+	}
+	writeJSON(w, http.StatusCreated, restored)
+}
+
+// status lists every parked car ordered by slot, only those on the floor in the query string if one is given
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	parked := s.cp.Status()
+	if v := r.URL.Query().Get("floor"); v != "" {
+		floor, err := strconv.Atoi(v)
+		if err != nil {
+			writeInvalid(w, "floor", "invalid floor number")
+			return
+		}
+		if parked, err = s.cp.FloorStatus(floor); err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+	cars := make([]carJSON, 0, len(parked))
+	for _, p := range parked {
+		cars = append(cars, carJSON{Slot: p.Slot, Registration: p.Registration, Color: p.Color, Vehicle: string(p.Vehicle), ParkedAt: p.ParkedAt})
+	}
+
+	writeJSON(w, http.StatusOK, cars)
+}
+
+// floors reports how many slots on each floor are free
+func (s *Server) floors(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.FreeByFloor())
+}
+
+// stats counts the occupied, free and closed slots
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.Stats())
+}
+
+// vacancies lists the empty slots longest vacant first, only those vacant for at least min_hours if given
+func (s *Server) vacancies(w http.ResponseWriter, r *http.Request) {
+	var hours int
+	if v := r.URL.Query().Get("min_hours"); v != "" {
+		var err error
+		if hours, err = strconv.Atoi(v); err != nil || hours < 0 {
+			writeInvalid(w, "min_hours", "invalid number of hours")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, s.cp.Vacancies(time.Duration(hours)*time.Hour))
+}
+
+// slotUsage lists how many times each slot has been allocated, by slot number
+func (s *Server) slotUsage(w http.ResponseWriter, r *http.Request) {
+	usage := s.cp.SlotUsage()
+	slots := make([]slotUsageJSON, 0, len(usage))
+	for slotNo := 1; slotNo <= len(usage); slotNo++ {
+		slots = append(slots, slotUsageJSON{Slot: slotNo, Allocations: usage[slotNo]})
+	}
+	writeJSON(w, http.StatusOK, slots)
+}
+
+// reportMismatch records that the vehicle in the path is too big for its slot and returns the slot suggested
+// for moving it to
+func (s *Server) reportMismatch(w http.ResponseWriter, r *http.Request) {
+	var req mismatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	vehicle, err := parking.ParseVehicleType(req.Vehicle)
+	if err != nil {
+		writeInvalid(w, "vehicle", "vehicle must be motorcycle, compact, car or truck")
+		return
+	}
+
+	m, err := s.cp.ReportSizeMismatch(r.PathValue("registration"), vehicle, req.Source)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, m)
+}
+
+// mismatches lists the vehicles reported as too big for their slot that are still parked in it
+func (s *Server) mismatches(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.OpenMismatches())
+}
+
+// startCharging starts a charging session for the car in the path
+func (s *Server) startCharging(w http.ResponseWriter, r *http.Request) {
+	session, err := s.cp.StartCharging(r.PathValue("registration"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, session)
+}
+
+// addService adds the service in the body to the stay of the car in the path and returns the services
+// ordered for it so far
+func (s *Server) addService(w http.ResponseWriter, r *http.Request) {
+	var req serviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Service == "" {
+		writeInvalid(w, "service", "service is required")
+		return
+	}
+
+	ordered, err := s.cp.AddService(r.PathValue("registration"), req.Service)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, ordered)
+}
+
+// attachEvidence records the photo reference in the body against the car in the path
+func (s *Server) attachEvidence(w http.ResponseWriter, r *http.Request) {
+	var req evidenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Ref == "" {
+		writeInvalid(w, "ref", "ref is required")
+		return
+	}
+
+	registration := r.PathValue("registration")
+	slotNo, err := s.cp.AttachEvidence(registration, req.Ref)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	evidence, err := s.cp.EvidenceForRegistration(registration)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, evidenceJSON{Slot: slotNo, Registration: registration, Evidence: evidence})
+}
+
+// evidence lists the photo references attached to the car in the path, oldest first
+func (s *Server) evidence(w http.ResponseWriter, r *http.Request) {
+	parked, err := s.cp.FindCar(r.PathValue("registration"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, evidenceJSON{Slot: parked.Slot, Registration: parked.Registration, Evidence: append([]string{}, parked.Evidence...)})
+}
+
+// addNote attaches the note in the body to the car in the path
+func (s *Server) addNote(w http.ResponseWriter, r *http.Request) {
+	var req noteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Text == "" {
+		writeInvalid(w, "text", "text is required")
+		return
+	}
+
+	registration := r.PathValue("registration")
+	if _, err := s.cp.AddNote(registration, req.Text, req.Incident); err != nil {
+		writeErr(w, err)
+		return
+	}
+	parked, err := s.cp.FindCar(registration)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, notesJSON{Slot: parked.Slot, Registration: registration, Notes: parked.Notes})
+}
+
+// notes lists the notes attached to the car in the path, oldest first
+func (s *Server) notes(w http.ResponseWriter, r *http.Request) {
+	parked, err := s.cp.FindCar(r.PathValue("registration"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, notesJSON{Slot: parked.Slot, Registration: parked.Registration, Notes: parked.Notes})
+}
+
+// services lists the services the lot offers with their prices
+func (s *Server) services(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.ServiceCatalog())
+}
+
+// endCharging ends the charging session of the car in the path with the energy in the body
+func (s *Server) endCharging(w http.ResponseWriter, r *http.Request) {
+	var req endChargingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.KWh == nil || *req.KWh < 0 {
+		writeInvalid(w, "kwh", "kwh must be a number of at least 0")
+		return
+	}
+
+	session, err := s.cp.EndCharging(r.PathValue("registration"), *req.KWh)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+// reportQueue records the number of cars in the body as queued at the gate in the path
+func (s *Server) reportQueue(w http.ResponseWriter, r *http.Request) {
+	var req queueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Length == nil {
+		writeInvalid(w, "length", "length is required")
+		return
+	}
+
+	q, err := s.cp.ReportQueue(r.PathValue("gate"), *req.Length)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, q)
+}
+
+// joinQueue records a car joining the queue at the gate in the path
+func (s *Server) joinQueue(w http.ResponseWriter, r *http.Request) {
+	q, err := s.cp.JoinQueue(r.PathValue("gate"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, q)
+}
+
+// queues lists the queue at each gate with the expected wait, for the entry signs
+func (s *Server) queues(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.GateQueues())
+}
+
+// logViolation records the vehicle in the body as parked outside the managed slots
+func (s *Server) logViolation(w http.ResponseWriter, r *http.Request) {
+	var req violationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Registration == "" {
+		writeInvalid(w, "registration", "registration is required")
+		return
+	}
+	if req.Location == "" {
+		writeInvalid(w, "location", "location is required")
+		return
+	}
+
+	v, err := s.cp.LogViolation(req.Registration, req.Location)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, v)
+}
+
+// clearViolation records that the vehicle of the violation in the path was moved or towed
+func (s *Server) clearViolation(w http.ResponseWriter, r *http.Request) {
+	v, err := s.cp.ClearViolation(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// violations lists every logged violation, oldest first
+func (s *Server) violations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.AllViolations())
+}
+
+// towList lists the vehicles still parked outside the managed slots, longest there first
+func (s *Server) towList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.TowList())
+}
+
+// reserve holds a slot for the car in the body over the window in the body
+func (s *Server) reserve(w http.ResponseWriter, r *http.Request) {
+	var req reservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Registration == "" {
+		writeInvalid(w, "registration", "registration is required")
+		return
+	}
+	if req.From.IsZero() || req.To.IsZero() {
+		writeInvalid(w, "", "from and to are required")
+		return
+	}
+
+	reservation, err := s.cp.Reserve(req.Registration, req.From, req.To)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, reservation)
+}
+
+// reservations lists the pending reservations whose window has not ended, soonest first
+func (s *Server) reservations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.UpcomingReservations())
+}
+
+// reservation returns the reservation in the path
+func (s *Server) reservation(w http.ResponseWriter, r *http.Request) {
+	reservation, err := s.cp.AdvanceReservation(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reservation)
+}
+
+// slotInfo returns the notes and assets of the slot in the path
+func (s *Server) slotInfo(w http.ResponseWriter, r *http.Request) {
+	slotNo, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeInvalid(w, "slot", "invalid slot number")
+		return
+	}
+
+	details, err := s.cp.SlotInfo(slotNo)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, details)
+}
+
+// addSlotNote attaches the note in the body to the slot in the path
+func (s *Server) addSlotNote(w http.ResponseWriter, r *http.Request) {
+	slotNo, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeInvalid(w, "slot", "invalid slot number")
+		return
+	}
+	var req slotNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Text == "" {
+		writeInvalid(w, "text", "text is required")
+		return
+	}
+
+	note, err := s.cp.AddSlotNote(slotNo, req.Text, req.Attention)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, note)
+}
+
+// resolveSlotNote records that the maintenance the slot note in the path asked for was done
+func (s *Server) resolveSlotNote(w http.ResponseWriter, r *http.Request) {
+	note, err := s.cp.ResolveSlotNote(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, note)
+}
+
+// setSlotAsset records the asset in the body under the key in the path, or removes it for DELETE, and
+// returns the slot's notes and assets
+func (s *Server) setSlotAsset(w http.ResponseWriter, r *http.Request) {
+	slotNo, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeInvalid(w, "slot", "invalid slot number")
+		return
+	}
+	var req slotAssetRequest
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeInvalid(w, "", "invalid request body")
+			return
+		}
+		if req.Value == "" {
+			writeInvalid(w, "value", "value is required")
+			return
+		}
+	}
+
+	if err := s.cp.SetSlotAsset(slotNo, r.PathValue("key"), req.Value); err != nil {
+		writeErr(w, err)
+		return
+	}
+	details, _ := s.cp.SlotInfo(slotNo)
+	writeJSON(w, http.StatusOK, details)
+}
+
+// maintenance lists the slots needing maintenance with the notes asking for it
+func (s *Server) maintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.NeedingAttention())
+}
+
+// cleaning lists the slots held for cleaning, lowest first
+func (s *Server) cleaning(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cp.CleaningHolds())
+}
+
+// endCleaning returns the slot in the path, held for cleaning, to allocation before its window closes
+func (s *Server) endCleaning(w http.ResponseWriter, r *http.Request) {
+	slotNo, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeInvalid(w, "slot", "invalid slot number")
+		return
+	}
+
+	hold, err := s.cp.EndCleaning(slotNo)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hold)
+}
+
+// startEvacuation puts the lot in evacuation mode and opens the barriers
+func (s *Server) startEvacuation(w http.ResponseWriter, r *http.Request) {
+	if err := s.cp.StartEvacuation(r.Context()); err != nil {
+		writeErr(w, err)
+		return
+	}
+	report, _ := s.cp.LastEvacuation()
+	writeJSON(w, http.StatusCreated, toEvacuationJSON(report))
+}
+
+// endEvacuation takes the lot out of evacuation mode and returns the report of the vehicles that remained
+func (s *Server) endEvacuation(w http.ResponseWriter, r *http.Request) {
+	report, err := s.cp.EndEvacuation(r.Context())
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toEvacuationJSON(report))
+}
+
+// evacuation returns the evacuation under way or the last one, with the vehicles that remained
+func (s *Server) evacuation(w http.ResponseWriter, r *http.Request) {
+	report, err := s.cp.LastEvacuation()
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toEvacuationJSON(report))
+}
+
+// toEvacuationJSON converts an evacuation report to its JSON form
+func toEvacuationJSON(report parking.Evacuation) evacuationJSON {
+	j := evacuationJSON{Start: report.Start, Parked: report.Parked, Left: report.Left, Remaining: make([]carJSON, 0, len(report.Remaining))}
+	if !report.End.IsZero() {
+		j.End = &report.End
+	}
+	for _, p := range report.Remaining {
+		j.Remaining = append(j.Remaining, carJSON{Slot: p.Slot, Registration: p.Registration, Color: p.Color, Vehicle: string(p.Vehicle), ParkedAt: p.ParkedAt})
+	}
+	return j
+}
+
+// cars lists parked cars, optionally only those of the color given in the query string
+func (s *Server) cars(w http.ResponseWriter, r *http.Request) {
+	var parked []parking.ParkedCar
+	if color := r.URL.Query().Get("color"); color != "" {
+		parked = s.cp.CarsForColor(color)
+	} else {
+		parked = s.cp.Status()
+	}
+
+	cars := make([]carJSON, 0, len(parked))
+	for _, p := range parked {
+		cars = append(cars, carJSON{Slot: p.Slot, Registration: p.Registration, Color: p.Color, ParkedAt: p.ParkedAt})
+	}
+
+	writeJSON(w, http.StatusOK, cars)
+}
+
+// car looks up the slot of the car in the path
+func (s *Server) car(w http.ResponseWriter, r *http.Request) {
+	registration := r.PathValue("registration")
+
+	parked, err := s.cp.FindCar(registration)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, carJSON{Slot: parked.Slot, Registration: parked.Registration, Color: parked.Color, ParkedAt: parked.ParkedAt})
+}
+
+// exit frees the slot of the car in the path and returns the receipt for its stay, as text with format=text
+func (s *Server) exit(w http.ResponseWriter, r *http.Request) {
+	bill, err := s.cp.Exit(r.PathValue("registration"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		bill.WriteReceipt(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, bill)
+}
+
+// ticket looks up the ticket in the path
+func (s *Server) ticket(w http.ResponseWriter, r *http.Request) {
+	ticket, err := s.cp.TicketLookup(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ticket)
+}
+
+// checkout frees the slot of the car holding the ticket in the path
+func (s *Server) checkout(w http.ResponseWriter, r *http.Request) {
+	ticket, err := s.cp.Checkout(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ticket)
+}
+
+// publish sends occupancy changes from the lot to live feed subscribers. The lot calls it while
+// locked, so events reach the feed in the order they happened.
+func (s *Server) publish(e parking.Event) {
+	switch e := e.(type) {
+	case parking.CarParked:
+		s.feed.publish(Event{Type: EventSlotAllocated, Slot: e.Slot, Registration: e.Registration, Color: e.Color, Time: e.Time})
+	case parking.CarLeft:
+		s.feed.publish(Event{Type: EventSlotFreed, Slot: e.Slot, Registration: e.Registration, Color: e.Color, Time: e.Time})
+	case parking.SizeMismatchReported:
+		s.feed.publish(Event{Type: EventSizeMismatch, Slot: e.Slot, Registration: e.Registration, Vehicle: string(e.Vehicle), Target: e.Target, Time: e.Time})
+	}
+}
+
+// writeJSON writes v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// StoreServer serves the basic parking routes of a lot kept in a parking.Store, such as a database shared
+// by several servers: parking, freeing slots and finding cars by color or registration number
+type StoreServer struct {
+	st  parking.Store
+	mux *http.ServeMux
+}
+
+// storedCarJSON is the JSON form of a car parked in a parking.Store, which does not record when it arrived
+type storedCarJSON struct {
+	Slot         int    `json:"slot"`
+	Registration string `json:"registration"`
+	Color        string `json:"color"`
+}
+
+// NewStore returns a StoreServer for a lot whose slots are already created in st
+func NewStore(st parking.Store) *StoreServer {
+	s := &StoreServer{st: st, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /slots/park", s.park)
+	s.mux.HandleFunc("DELETE /slots/{n}", s.leave)
+	s.mux.HandleFunc("GET /cars", s.cars)
+	s.mux.HandleFunc("GET /cars/{registration}", s.car)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *StoreServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// park allocates the nearest free slot for the car in the request body
+func (s *StoreServer) park(w http.ResponseWriter, r *http.Request) {
+	var req parkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, "", "invalid request body")
+		return
+	}
+	if req.Registration == "" {
+		writeInvalid(w, "registration", "registration is required")
+		return
+	}
+	if req.Color == "" {
+		writeInvalid(w, "color", "color is required")
+		return
+	}
+	if req.Vehicle != "" || req.Gate != "" || req.Charging || req.Permit || req.Slot != 0 || req.Fallback {
+		writeInvalid(w, "", "vehicle types, gates, charging, permits and requested slots need the in-memory lot")
+		return
+	}
+
+	slotNo, err := s.st.AllocateSlot(r.Context(), req.Registration, req.Color)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, storedCarJSON{Slot: slotNo, Registration: req.Registration, Color: req.Color})
+}
+
+// leave frees the slot in the path
+func (s *StoreServer) leave(w http.ResponseWriter, r *http.Request) {
+	slotNo, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeInvalid(w, "slot", "invalid slot number")
+		return
+	}
+
+	car, err := s.st.FreeSlot(r.Context(), slotNo)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, storedCarJSON{Slot: slotNo, Registration: car.Registration, Color: car.Color})
+}
+
+// cars lists the parked cars of the color in the query string ordered by slot
+func (s *StoreServer) cars(w http.ResponseWriter, r *http.Request) {
+	color := r.URL.Query().Get("color")
+	if color == "" {
+		writeInvalid(w, "color", "color is required")
+		return
+	}
+
+	parked, err := s.st.QueryByColor(r.Context(), color)
+	if err != nil && !errors.Is(err, parking.ErrNotFound) {
+		writeErr(w, err)
+		return
+	}
+	cars := make([]storedCarJSON, 0, len(parked))
+	for _, p := range parked {
+		cars = append(cars, storedCarJSON{Slot: p.Slot, Registration: p.Registration, Color: p.Color})
+	}
+	writeJSON(w, http.StatusOK, cars)
+}
+
+// car looks up the slot of the car in the path
+func (s *StoreServer) car(w http.ResponseWriter, r *http.Request) {
+	parked, err := s.st.QueryByReg(r.Context(), r.PathValue("registration"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, storedCarJSON{Slot: parked.Slot, Registration: parked.Registration, Color: parked.Color})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// store keeps the lot across restarts in a state file, an event log or both, for the shell and the server alike
+type store struct {
+	cp        *parking.Carpark
+	stateFile string    // File the lot is saved to after each change and on exit, empty to keep state in memory only
+	wal       *eventLog // Log of the events since the state file was saved, if any; the state file is then only saved on exit
+	events    *eventLog // Log of the lot's events, if any
+
+	mu sync.Mutex // Serializes saves, so that the state file ends up with the latest snapshot
+}
+
+// openStore loads the lot from the state file if it exists, then applies the events in the event log or
+// write-ahead log and subscribes the log to the lot. Any of the paths may be empty.
+func openStore(cp *parking.Carpark, stateFile, walFile, eventLogFile string) (*store, error) {
+	st := &store{cp: cp, stateFile: stateFile}
+	if stateFile != "" {
+		if err := cp.Load(stateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if eventLogFile != "" {
+		l, events, err := openEventLog(eventLogFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := cp.Apply(events...); err != nil {
+			l.close()
+			return nil, err
+		}
+		cp.Subscribe(l.record)
+		st.events = l
+	}
+	if walFile != "" {
+		w, events, err := openWAL(walFile)
+		if err != nil {
+			st.close()
+			return nil, err
+		}
+		if err := cp.Apply(events...); err != nil {
+			w.close()
+			st.close()
+			return nil, err
+		}
+		cp.Subscribe(w.record)
+		st.wal = w
+	}
+	return st, nil
+}
+
+// commit makes the changes since the last commit durable, reporting whether they could be logged or saved.
+// With a write-ahead log they are already on disk, so the state file is left until save.
+func (st *store) commit() error {
+	if st.events != nil {
+		if err := st.events.failed(); err != nil {
+			return fmt.Errorf("writing event log: %w", err)
+		}
+	}
+	if st.wal != nil {
+		if err := st.wal.failed(); err != nil {
+			return fmt.Errorf("writing log: %w", err)
+		}
+		return nil
+	}
+	return st.save()
+}
+
+// save writes the lot to the state file, if there is one, and empties the log it now covers
+func (st *store) save() error {
+	if st.stateFile == "" {
+		return nil
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.cp.Save(st.stateFile); err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+	if st.wal != nil {
+		if err := st.wal.reset(); err != nil {
+			return fmt.Errorf("resetting log: %w", err)
+		}
+	}
+	return nil
+}
+
+// close closes the logs
+func (st *store) close() {
+	if st.events != nil {
+		st.events.close()
+	}
+	if st.wal != nil {
+		st.wal.close()
+	}
+}
@@ -0,0 +1,162 @@
+// Package stripepay collects parking fees through Stripe. Each charge is a PaymentIntent
+// confirmed immediately with the driver's PaymentMethod, created with the ticket ID and
+// PaymentMethod as its idempotency key so a retried exit is only charged once. Refunds are keyed by the
+// payment and their number among its refunds.
+package stripepay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// DefaultBaseURL is the address of the Stripe API
+const DefaultBaseURL = "https://api.stripe.com"
+
+// Gateway is a parking.PaymentGateway backed by the Stripe API
+type Gateway struct {
+	key      string
+	currency string
+	baseURL  string
+	client   *http.Client
+}
+
+// New returns a Gateway that charges in currency, a three-letter ISO code such as "usd", with a secret API key
+func New(key string, currency string) *Gateway {
+	return &Gateway{key: key, currency: strings.ToLower(currency), baseURL: DefaultBaseURL, client: http.DefaultClient}
+}
+
+// WithBaseURL returns a copy of the Gateway that sends requests to another address, such as a local stub of the API
+func (g *Gateway) WithBaseURL(baseURL string) *Gateway {
+	c := *g
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+	return &c
+}
+
+// paymentIntent is the part of a Stripe PaymentIntent the gateway reads
+type paymentIntent struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	Amount       int    `json:"amount"`
+	LatestCharge *struct {
+		AmountRefunded int `json:"amount_refunded"`
+	} `json:"latest_charge"`
+}
+
+// apiError is the body of a failed Stripe request
+type apiError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Charge implements parking.PaymentGateway by creating and confirming a PaymentIntent
+func (g *Gateway) Charge(ctx context.Context, req parking.ChargeRequest) (string, error) {
+	form := url.Values{
+		"amount":                             {strconv.Itoa(req.Amount)},
+		"currency":                           {g.currency},
+		"payment_method":                     {req.Method},
+		"confirm":                            {"true"},
+		"metadata[ticket]":                   {req.Reference},
+		"automatic_payment_methods[enabled]": {"true"},
+		"automatic_payment_methods[allow_redirects]": {"never"},
+	}
+
+	var pi paymentIntent
+	if err := g.do(ctx, http.MethodPost, "/v1/payment_intents", form, idempotencyKey(req), &pi); err != nil {
+		return "", err
+	}
+	if pi.Status != "succeeded" && pi.Status != "processing" {
+		return "", fmt.Errorf("%w: payment intent %s is %s", parking.ErrPaymentDeclined, pi.ID, pi.Status)
+	}
+	return pi.ID, nil
+}
+
+// idempotencyKey identifies a charge so that retrying it with the same card collects it only once, while
+// a driver whose card was declined can still pay with another
+func idempotencyKey(req parking.ChargeRequest) string {
+	return "exit-" + req.Reference + "-" + req.Method
+}
+
+// Refund implements parking.PaymentGateway, with the payment and the number of the refund as its
+// idempotency key so a retried refund is only made once
+func (g *Gateway) Refund(ctx context.Context, req parking.RefundRequest) error {
+	form := url.Values{
+		"payment_intent": {req.PaymentID},
+		"amount":         {strconv.Itoa(req.Amount)},
+	}
+	key := "refund-" + req.PaymentID + "-" + strconv.Itoa(req.Sequence)
+	return g.do(ctx, http.MethodPost, "/v1/refunds", form, key, nil)
+}
+
+// Status implements parking.PaymentGateway
+func (g *Gateway) Status(ctx context.Context, paymentID string) (parking.PaymentStatus, error) {
+	var pi paymentIntent
+	path := "/v1/payment_intents/" + url.PathEscape(paymentID) + "?expand[]=latest_charge"
+	if err := g.do(ctx, http.MethodGet, path, nil, "", &pi); err != nil {
+		return "", err
+	}
+
+	switch pi.Status {
+	case "succeeded":
+		if pi.LatestCharge != nil && pi.LatestCharge.AmountRefunded >= pi.Amount {
+			return parking.PaymentRefunded, nil
+		}
+		return parking.PaymentSucceeded, nil
+	case "processing", "requires_capture":
+		return parking.PaymentPending, nil
+	default:
+		return parking.PaymentFailed, nil
+	}
+}
+
+// do sends a request to the Stripe API and decodes the response into v, mapping declined cards to
+// parking.ErrPaymentDeclined and unknown objects to parking.ErrNotFound
+func (g *Gateway) do(ctx context.Context, method string, path string, form url.Values, idempotencyKey string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.key, "")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e apiError
+		json.NewDecoder(resp.Body).Decode(&e)
+		err := fmt.Errorf("stripe: %s (%d %s)", e.Error.Message, resp.StatusCode, e.Error.Code)
+		switch {
+		case e.Error.Type == "card_error":
+			return fmt.Errorf("%w: %s", parking.ErrPaymentDeclined, e.Error.Message)
+		case resp.StatusCode == http.StatusNotFound || e.Error.Code == "resource_missing":
+			return fmt.Errorf("%w: %v", parking.ErrNotFound, err)
+		}
+		return err
+	}
+
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("stripe: malformed response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io"
+
+	"github.com/arjun759/car-parking/parking"
+)
+
+// openWAL opens or creates the write-ahead log at path and returns it with the events it holds. The log
+// has the format of the event log but only holds the events emitted since the state file was last saved;
+// each is synced to disk before the change that emitted it is reported, and the events are applied over
+// the state file at startup. Logging events rather than command lines means recovery keeps the tickets and
+// times the lot handed out, and never repeats a charge or refund made through the payment gateway.
+func openWAL(path string) (*eventLog, []parking.Event, error) {
+	return openEventLog(path)
+}
+
+// reset empties the log once its events are reflected in a saved snapshot
+func (l *eventLog) reset() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := l.f.Seek(0, io.SeekStart)
+	return err
+}